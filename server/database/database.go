@@ -0,0 +1,59 @@
+// Package database opens the Postgres or SQLite database named by a DATABASE_URL.
+package database
+
+import (
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// sqlitePragmas are applied to every SQLite connection. SQLite doesn't enforce foreign keys
+// unless asked, and WAL with a busy timeout lets the queue and trash goroutines write
+// alongside requests.
+var sqlitePragmas = []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"}
+
+// Open connects to the database at url. URLs starting with sqlite: or file: open a SQLite
+// database file, such as sqlite:dreams.db or sqlite:///var/lib/dreams/dreams.db, and
+// anything else is treated as a Postgres connection string.
+func Open(url string, config *gorm.Config) (*gorm.DB, error) {
+	if dsn, ok := SQLiteDSN(url); ok {
+		return gorm.Open(sqlite.Open(dsn), config)
+	}
+	return gorm.Open(postgres.Open(url), config)
+}
+
+// SQLiteDSN converts a SQLite database URL into a DSN for the driver, reporting false if
+// url isn't a SQLite URL
+func SQLiteDSN(url string) (string, bool) {
+	var path string
+	switch {
+	case strings.HasPrefix(url, "sqlite://"):
+		path = strings.TrimPrefix(url, "sqlite://")
+	case strings.HasPrefix(url, "sqlite:"):
+		path = strings.TrimPrefix(url, "sqlite:")
+	case strings.HasPrefix(url, "file:"):
+		path = strings.TrimPrefix(url, "file:")
+	default:
+		return "", false
+	}
+
+	path, query, _ := strings.Cut(path, "?")
+	params := make([]string, 0, len(sqlitePragmas)+1)
+	if query != "" {
+		params = append(params, query)
+	}
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		if !strings.Contains(query, "_pragma="+name) {
+			params = append(params, "_pragma="+pragma)
+		}
+	}
+	return "file:" + path + "?" + strings.Join(params, "&"), true
+}
+
+// EscapeLike escapes the LIKE wildcards in s, for patterns compared with ESCAPE '\'
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
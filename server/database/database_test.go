@@ -0,0 +1,51 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		url, want string
+		ok        bool
+	}{
+		{"postgres://postgres@db:5432/dreams?sslmode=disable", "", false},
+		{"sqlite:dreams.db", "file:dreams.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", true},
+		{"sqlite:///var/lib/dreams.db", "file:/var/lib/dreams.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", true},
+		{"file:dreams.db?_pragma=journal_mode(DELETE)", "file:dreams.db?_pragma=journal_mode(DELETE)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", true},
+	}
+
+	for _, tt := range tests {
+		if got, ok := SQLiteDSN(tt.url); got != tt.want || ok != tt.ok {
+			t.Errorf("SQLiteDSN(%q) = %q, %v, want %q, %v", tt.url, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestOpenSQLite(t *testing.T) {
+	db, err := Open("sqlite:"+filepath.Join(t.TempDir(), "dreams.db"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if db.Dialector.Name() != "sqlite" {
+		t.Errorf("expected sqlite dialect, got %s", db.Dialector.Name())
+	}
+
+	var foreignKeys int
+	db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if foreignKeys != 1 {
+		t.Error("expected foreign keys to be enforced")
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := EscapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("unexpected escaped pattern %q", got)
+	}
+}
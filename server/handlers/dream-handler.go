@@ -2,153 +2,276 @@ package handlers
 
 import (
 	"dreams/models"
+	"dreams/repositories"
 	"dreams/services"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-
-	"gorm.io/gorm"
+	"time"
 )
 
 type DreamHandler struct {
-	db           *gorm.DB
+	dreams       repositories.DreamRepository
 	aiService    *services.AIService
 	queueService *services.QueueService
+	emotions     *services.EmotionService
 }
 
-func NewDreamHandler(db *gorm.DB, aiService *services.AIService, queueService *services.QueueService) *DreamHandler {
+func NewDreamHandler(dreams repositories.DreamRepository, aiService *services.AIService, queueService *services.QueueService, emotions *services.EmotionService) *DreamHandler {
 	return &DreamHandler{
-		db:           db,
+		dreams:       dreams,
 		aiService:    aiService,
 		queueService: queueService,
+		emotions:     emotions,
 	}
 }
 
 func (h *DreamHandler) RegisterRoutes() {
 	http.HandleFunc("GET /api/dreams", h.HandleGetAll)
+	http.HandleFunc("GET /api/dreams/search", h.HandleSearch)
 	http.HandleFunc("GET /api/dreams/{id}", h.HandleGetById)
 	http.HandleFunc("POST /api/dreams", h.HandleCreate)
 	http.HandleFunc("POST /api/dreams/{id}/generate-image", h.HandleGenerateImage)
 	http.HandleFunc("PUT /api/dreams/{id}", h.HandleUpdate)
+	http.HandleFunc("PATCH /api/dreams/{id}", h.HandlePatch)
 	http.HandleFunc("DELETE /api/dreams/{id}", h.HandleDelete)
+	http.HandleFunc("GET /api/dreams/{id}/revisions", h.HandleListRevisions)
+	http.HandleFunc("GET /api/dreams/{id}/revisions/diff", h.HandleDiffRevisions)
+	http.HandleFunc("GET /api/dreams/{id}/revisions/{version}", h.HandleGetRevision)
+	http.HandleFunc("POST /api/dreams/{id}/revisions/{version}/restore", h.HandleRestoreRevision)
+	http.HandleFunc("POST /api/images/provenance", h.HandleImageProvenance)
 }
 
+// HandleGetAll lists dreams a page at a time, see parseDreamListQuery for the supported parameters
 func (h *DreamHandler) HandleGetAll(w http.ResponseWriter, r *http.Request) {
-	var dreams []models.Dream
-	if err := h.db.Find(&dreams).Error; err != nil {
+	query, err := parseDreamListQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, err.Error())
+		return
+	}
+
+	dreams, err := h.dreams.List(r.Context(), query)
+	if err != nil {
 		log.Printf("Error fetching dreams: %v", err)
-		http.Error(w, "Failed to fetch dreams", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch dreams")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(dreams); err != nil {
+	if err := json.NewEncoder(w).Encode(newDreamListResponse(dreams, query.Limit)); err != nil {
 		log.Printf("Error encoding dreams: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
 	}
 }
 
+// HandleCreate creates a dream from the same fields PUT accepts. Only the dream text is required.
 func (h *DreamHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
-	var dream models.Dream
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Error reading request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil || fields == nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Request body must be a JSON object")
 		return
 	}
-	if err := json.Unmarshal(body, &dream); err != nil {
-		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+
+	create, err := decodeDreamUpdate(fields, DreamUpdate{})
+	if err == nil {
+		err = create.validate(models.Dream{})
+	}
+	if err != nil {
+		writeValidationError(w, r, err)
 		return
 	}
-	if err := h.db.Create(&dream).Error; err != nil {
+
+	var dream models.Dream
+	create.apply(&dream)
+	// Most dreams are written down the morning after, so default to today
+	if dream.DreamtOn == nil {
+		today := models.NewDate(time.Now())
+		dream.DreamtOn = &today
+	}
+	if err := h.dreams.Create(r.Context(), &dream); err != nil {
 		log.Printf("Error creating dream: %v", err)
-		http.Error(w, "Failed to create dream", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create dream")
 		return
 	}
+	h.scoreEmotions(r, dream)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", dreamETag(dream))
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(dream); err != nil {
 		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
 	}
 }
 
+// HandleUpdate replaces the editable fields of a dream. Fields missing from the body are
+// cleared, so clients that only want to change some fields should use PATCH.
 func (h *DreamHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/dreams/")
-	idStr = strings.TrimSuffix(idStr, "/")
-
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		http.Error(w, "Invalid dream ID", http.StatusBadRequest)
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil || fields == nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Request body must be a JSON object")
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+	h.updateDream(w, r, func(existing models.Dream) (DreamUpdate, error) {
+		return decodeDreamUpdate(fields, DreamUpdate{})
+	})
+}
+
+// HandlePatch applies an RFC 7396 JSON Merge Patch to the editable fields of a dream.
+// A null value clears a field.
+func (h *DreamHandler) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+	if contentType != "application/merge-patch+json" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be application/merge-patch+json")
 		return
 	}
-	defer r.Body.Close()
 
-	var updateData map[string]interface{}
-	if err := json.Unmarshal(body, &updateData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Merge patch must be a JSON object")
 		return
 	}
 
-	var existingDream models.Dream
-	if err := h.db.First(&existingDream, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Dream not found", http.StatusNotFound)
-		} else {
-			log.Printf("Error finding dream: %v", err)
-			http.Error(w, "Failed to find dream", http.StatusInternalServerError)
+	h.updateDream(w, r, func(existing models.Dream) (DreamUpdate, error) {
+		// Round-trip the current fields through JSON so the patch applies to the API representation
+		current, err := json.Marshal(newDreamUpdate(existing))
+		if err != nil {
+			return DreamUpdate{}, err
+		}
+		var target interface{}
+		if err := json.Unmarshal(current, &target); err != nil {
+			return DreamUpdate{}, err
+		}
+
+		merged, err := json.Marshal(mergePatch(target, patch))
+		if err != nil {
+			return DreamUpdate{}, err
 		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(merged, &fields); err != nil {
+			return DreamUpdate{}, err
+		}
+		return decodeDreamUpdate(fields, DreamUpdate{})
+	})
+}
+
+// updateDream loads the dream, builds and validates the update, saves only the updatable
+// columns and responds with the reloaded dream
+func (h *DreamHandler) updateDream(w http.ResponseWriter, r *http.Request, build func(models.Dream) (DreamUpdate, error)) {
+	existingDream, ok := h.findDream(w, r)
+	if !ok {
 		return
 	}
 
-	if err := h.db.Model(&existingDream).Updates(updateData).Error; err != nil {
-		log.Printf("Error updating dream: %v", err)
-		http.Error(w, "Failed to update dream", http.StatusInternalServerError)
+	if status := checkIfMatch(r, existingDream); status != 0 {
+		writePreconditionError(w, r, status)
 		return
 	}
 
+	update, err := build(existingDream)
+	if err == nil {
+		err = update.validate(existingDream)
+	}
+	if err != nil {
+		writeValidationError(w, r, err)
+		return
+	}
+
+	dream := existingDream
+	update.apply(&dream)
+	if err := h.dreams.Update(r.Context(), &dream, existingDream.Version); err != nil {
+		if err == repositories.ErrVersionConflict {
+			writePreconditionError(w, r, http.StatusPreconditionFailed)
+		} else if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		} else {
+			log.Printf("Error updating dream: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to update dream")
+		}
+		return
+	}
+	h.scoreEmotions(r, dream)
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(existingDream); err != nil {
+	w.Header().Set("ETag", dreamETag(dream))
+	if err := json.NewEncoder(w).Encode(dream); err != nil {
 		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
+	}
+}
+
+// scoreEmotions tags a saved dream with its emotions. A failure is only logged, as the
+// background scorer will pick the dream up again.
+func (h *DreamHandler) scoreEmotions(r *http.Request, dream models.Dream) {
+	if _, err := h.emotions.ScoreDream(r.Context(), dream); err != nil {
+		log.Printf("Error scoring dream emotions: %v", err)
 	}
 }
 
+// findDream loads the dream named by the id path value, writing an error if it can't
+func (h *DreamHandler) findDream(w http.ResponseWriter, r *http.Request) (models.Dream, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
+		return models.Dream{}, false
+	}
+
+	dream, err := h.dreams.Get(r.Context(), uint(id))
+	if err != nil {
+		if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		} else {
+			log.Printf("Error finding dream: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
+		}
+		return dream, false
+	}
+	return dream, true
+}
+
 func (h *DreamHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/dreams/")
 	idStr = strings.TrimSuffix(idStr, "/")
 
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
 		return
 	}
 
-	var existingDream models.Dream
-	if err := h.db.First(&existingDream, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Dream not found", http.StatusNotFound)
+	existingDream, err := h.dreams.Get(r.Context(), uint(id))
+	if err != nil {
+		if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
 		} else {
 			log.Printf("Error finding dream: %v", err)
-			http.Error(w, "Failed to find dream", http.StatusInternalServerError)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
 		}
 		return
 	}
 
-	if err := h.db.Delete(&existingDream).Error; err != nil {
-		log.Printf("Error deleting dream: %v", err)
-		http.Error(w, "Failed to delete dream", http.StatusInternalServerError)
+	if status := checkIfMatch(r, existingDream); status != 0 {
+		writePreconditionError(w, r, status)
+		return
+	}
+
+	if err := h.dreams.Delete(r.Context(), existingDream.ID, existingDream.Version); err != nil {
+		if err == repositories.ErrVersionConflict {
+			writePreconditionError(w, r, http.StatusPreconditionFailed)
+		} else if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		} else {
+			log.Printf("Error deleting dream: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete dream")
+		}
 		return
 	}
 
@@ -160,32 +283,33 @@ func (h *DreamHandler) HandleGetById(w http.ResponseWriter, r *http.Request) {
 	re := regexp.MustCompile(`/api/dreams/(\d+)`)
 	matches := re.FindStringSubmatch(r.URL.Path)
 	if len(matches) != 2 {
-		http.Error(w, "Invalid dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
 		return
 	}
 
 	idStr := matches[1]
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
 		return
 	}
 
-	var dream models.Dream
-	if err := h.db.First(&dream, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Dream not found", http.StatusNotFound)
+	dream, err := h.dreams.Get(r.Context(), uint(id))
+	if err != nil {
+		if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
 		} else {
 			log.Printf("Error finding dream: %v", err)
-			http.Error(w, "Failed to find dream", http.StatusInternalServerError)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", dreamETag(dream))
 	if err := json.NewEncoder(w).Encode(dream); err != nil {
 		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
 	}
 }
 
@@ -198,7 +322,7 @@ type GenerateImageResponse struct {
 func (h *DreamHandler) HandleGenerateImage(w http.ResponseWriter, r *http.Request) {
 	log.Println("HandleGenerateImage: Received request")
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		log.Println("HandleGenerateImage: Method not allowed")
 		return
 	}
@@ -208,25 +332,24 @@ func (h *DreamHandler) HandleGenerateImage(w http.ResponseWriter, r *http.Reques
 	path = strings.TrimSuffix(path, "/generate-image")
 	idStr := path
 	if idStr == "" {
-		http.Error(w, "Missing dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Missing dream ID")
 		return
 	}
 
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
 		return
 	}
 
-	// Get only the necessary fields from the database
-	var dream models.Dream
-	if err := h.db.Select("id, dream, image_url").First(&dream, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Dream not found", http.StatusNotFound)
+	dream, err := h.dreams.Get(r.Context(), uint(id))
+	if err != nil {
+		if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
 			return
 		}
 		log.Printf("Error fetching dream %d: %v", id, err)
-		http.Error(w, "Failed to fetch dream", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch dream")
 		return
 	}
 
@@ -235,14 +358,8 @@ func (h *DreamHandler) HandleGenerateImage(w http.ResponseWriter, r *http.Reques
 	// Enqueue the image generation request
 	position, err := h.queueService.EnqueueRequest(dream)
 	if err != nil {
-		errMsg := fmt.Sprintf("Failed to enqueue request: %v", err)
-		log.Printf("HandleGenerateImage: %s", errMsg)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusTooManyRequests)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":   "Image generation already in progress",
-			"message": errMsg,
-		})
+		log.Printf("HandleGenerateImage: Failed to enqueue request: %v", err)
+		writeProblem(w, r, http.StatusTooManyRequests, CodeGenerationInProgress, "Image generation already in progress")
 		return
 	}
 
@@ -262,7 +379,7 @@ func (h *DreamHandler) HandleGenerateImage(w http.ResponseWriter, r *http.Reques
 // HandleCheckImageStatus checks the status of an image generation request
 func (h *DreamHandler) HandleCheckImageStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -271,34 +388,24 @@ func (h *DreamHandler) HandleCheckImageStatus(w http.ResponseWriter, r *http.Req
 	path = strings.TrimSuffix(path, "/status")
 	idStr := path
 	if idStr == "" {
-		http.Error(w, "Missing dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Missing dream ID")
 		return
 	}
 
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		http.Error(w, "Invalid dream ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
 		return
 	}
 
-	// Get only the necessary fields from the database
-	var result struct {
-		ID       uint
-		ImageURL string
-	}
-
-	// Use a more efficient query with only the fields we need
-	if err := h.db.Model(&models.Dream{}).
-		Select("id, image_url").
-		Where("id = ?", id).
-		First(&result).Error; err != nil {
-
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Dream not found", http.StatusNotFound)
+	result, err := h.dreams.Get(r.Context(), uint(id))
+	if err != nil {
+		if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
 			return
 		}
 		log.Printf("Error fetching dream status %d: %v", id, err)
-		http.Error(w, "Failed to fetch dream status", http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch dream status")
 		return
 	}
 
@@ -332,3 +439,69 @@ func (h *DreamHandler) HandleCheckImageStatus(w http.ResponseWriter, r *http.Req
 	// If we get here, the dream is not in the queue and has no image
 	w.WriteHeader(http.StatusNoContent) // 204 No Content
 }
+
+// maxProvenanceUploadSize limits uploads to the provenance endpoint
+const maxProvenanceUploadSize = 20 << 20
+
+// ImageProvenanceResponse is the response for the image provenance endpoint
+type ImageProvenanceResponse struct {
+	Provenance *services.ImageProvenance `json:"provenance"`
+	Dream      *models.Dream             `json:"dream,omitempty"`
+}
+
+// HandleImageProvenance reads the provenance metadata embedded in an uploaded image and
+// looks up the dream it was generated for. The image can be sent as the "image" field of a
+// multipart form or as the raw request body.
+func (h *DreamHandler) HandleImageProvenance(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxProvenanceUploadSize)
+	defer r.Body.Close()
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, formErr := r.FormFile("image")
+		if formErr != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidImage, "Missing image upload")
+			return
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+	} else {
+		data, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		log.Printf("Error reading uploaded image: %v", err)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidImage, "Invalid image upload")
+		return
+	}
+
+	provenance, err := services.ReadProvenance(data)
+	if err != nil {
+		if errors.Is(err, services.ErrNotPNG) {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidImage, "Image must be a PNG")
+		} else {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidImage, "Invalid PNG image")
+		}
+		return
+	}
+	if provenance == nil {
+		writeProblem(w, r, http.StatusNotFound, CodeProvenanceNotFound, "No provenance metadata found in image")
+		return
+	}
+
+	response := ImageProvenanceResponse{Provenance: provenance}
+	if provenance.DreamID != 0 {
+		if dream, err := h.dreams.Get(r.Context(), provenance.DreamID); err == nil {
+			response.Dream = &dream
+		} else if err != repositories.ErrNotFound {
+			log.Printf("Error finding dream %d: %v", provenance.DreamID, err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
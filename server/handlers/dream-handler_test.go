@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dreams/database"
+	"dreams/migrations"
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services"
+	"dreams/services/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testServer wires a DreamHandler to a SQLite database, in-memory storage and a fake AI service
+type testServer struct {
+	t        *testing.T
+	db       *gorm.DB
+	storage  *storage.MemoryStorage
+	queue    *services.QueueService
+	trash    *services.TrashService
+	signs    *services.DreamSignService
+	similar  *services.SimilarityService
+	emotions *services.EmotionService
+	server   *httptest.Server
+	aiCalls  atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	db, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "dreams.db"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	ts := &testServer{t: t, db: db, storage: storage.NewMemoryStorage()}
+
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.aiCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"images": []map[string]string{{"base64": base64.StdEncoding.EncodeToString(testPNG(t, 800, 600))}},
+		})
+	}))
+	t.Cleanup(ai.Close)
+
+	aiService := services.NewAIService(ai.URL, "/api/generate", "test-model", ts.storage)
+	dreams := repositories.NewDreamRepository(db)
+	ts.queue = services.NewQueueService(aiService, dreams)
+	ts.queue.Start()
+	t.Cleanup(ts.queue.Stop)
+
+	ts.emotions = services.NewEmotionService(db, dreams, nil)
+	h := NewDreamHandler(dreams, aiService, ts.queue, ts.emotions)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/dreams", h.HandleGetAll)
+	mux.HandleFunc("POST /api/dreams", h.HandleCreate)
+	mux.HandleFunc("GET /api/dreams/search", h.HandleSearch)
+	mux.HandleFunc("GET /api/dreams/{id}", h.HandleGetById)
+	mux.HandleFunc("PUT /api/dreams/{id}", h.HandleUpdate)
+	mux.HandleFunc("PATCH /api/dreams/{id}", h.HandlePatch)
+	mux.HandleFunc("DELETE /api/dreams/{id}", h.HandleDelete)
+	mux.HandleFunc("GET /api/dreams/{id}/revisions", h.HandleListRevisions)
+	mux.HandleFunc("GET /api/dreams/{id}/revisions/diff", h.HandleDiffRevisions)
+	mux.HandleFunc("GET /api/dreams/{id}/revisions/{version}", h.HandleGetRevision)
+	mux.HandleFunc("POST /api/dreams/{id}/revisions/{version}/restore", h.HandleRestoreRevision)
+	mux.HandleFunc("POST /api/dreams/{id}/generate-image", h.HandleGenerateImage)
+	mux.HandleFunc("GET /api/dreams/{id}/status", h.HandleCheckImageStatus)
+	mux.HandleFunc("POST /api/images/provenance", h.HandleImageProvenance)
+	tags := NewTagHandler(db)
+	mux.HandleFunc("POST /api/dreams/{id}/tags", tags.HandleAddTags)
+	mux.HandleFunc("DELETE /api/dreams/{id}/tags/{tag}", tags.HandleRemoveTag)
+	mux.HandleFunc("GET /api/tags", tags.HandleListTags)
+	ts.trash = services.NewTrashService(db, ts.storage, services.DefaultTrashRetention)
+	trash := NewTrashHandler(db, ts.trash)
+	mux.HandleFunc("GET /api/trash", trash.HandleListTrash)
+	mux.HandleFunc("POST /api/dreams/{id}/restore", trash.HandleRestore)
+	mux.HandleFunc("DELETE /api/trash/{id}", trash.HandlePurge)
+	export := NewExportHandler(services.NewExportService(dreams, ts.storage))
+	mux.HandleFunc("GET /api/export", export.HandleExport)
+	mux.HandleFunc("GET /api/export/book", export.HandleBook)
+	stats := NewStatsHandler(services.NewStatsService(db))
+	mux.HandleFunc("GET /api/stats", stats.HandleStats)
+	ts.signs = services.NewDreamSignService(db, nil)
+	signs := NewDreamSignHandler(ts.signs)
+	mux.HandleFunc("GET /api/dream-signs", signs.HandleListDreamSigns)
+	ts.similar = services.NewSimilarityService(db, dreams, services.NewHashingEmbedder(256))
+	similar := NewSimilarHandler(ts.similar)
+	mux.HandleFunc("GET /api/dreams/{id}/similar", similar.HandleSimilar)
+	emotions := NewEmotionHandler(ts.emotions)
+	mux.HandleFunc("GET /api/dreams/{id}/emotions", emotions.HandleDreamEmotions)
+	mux.HandleFunc("GET /api/stats/moods", emotions.HandleMoods)
+	webhooks := services.NewWebhookNotifier()
+	webhooks.AllowLoopback = true
+	reminders := NewReminderHandler(services.NewReminderService(db, map[string]services.Notifier{
+		models.ReminderWebhook: webhooks,
+	}, "http://localhost:3000"))
+	mux.HandleFunc("GET /api/reminders", reminders.HandleListReminders)
+	mux.HandleFunc("POST /api/reminders", reminders.HandleCreateReminder)
+	mux.HandleFunc("GET /api/reminders/push-key", reminders.HandlePushKey)
+	mux.HandleFunc("GET /api/reminders/{id}", reminders.HandleGetReminder)
+	mux.HandleFunc("PUT /api/reminders/{id}", reminders.HandleUpdateReminder)
+	mux.HandleFunc("DELETE /api/reminders/{id}", reminders.HandleDeleteReminder)
+	mux.HandleFunc("POST /api/reminders/{id}/test", reminders.HandleTestReminder)
+	imports := NewImportHandler(services.NewImportService(dreams, ts.storage))
+	mux.HandleFunc("POST /api/import", imports.HandleImport)
+	mux.HandleFunc("GET /api/import/{id}", imports.HandleImportStatus)
+	ts.server = httptest.NewServer(mux)
+	t.Cleanup(ts.server.Close)
+
+	return ts
+}
+
+// do sends a request and decodes a JSON response body into out when it is non-nil
+func (ts *testServer) do(method, path string, body interface{}, out interface{}) *http.Response {
+	ts.t.Helper()
+	return ts.request(method, path, nil, body, out)
+}
+
+// request is like do with extra headers. Changes default to "If-Match: *" so tests that
+// aren't about concurrency don't need to track versions; pass an empty If-Match to omit it.
+func (ts *testServer) request(method, path string, headers map[string]string, body interface{}, out interface{}) *http.Response {
+	ts.t.Helper()
+
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case []byte:
+		reader = bytes.NewReader(b)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatalf("failed to marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.server.URL+path, reader)
+	if err != nil {
+		ts.t.Fatalf("failed to build request: %v", err)
+	}
+	if body != nil && method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete {
+		req.Header.Set("If-Match", "*")
+	}
+	for name, value := range headers {
+		if value == "" {
+			req.Header.Del(name)
+		} else {
+			req.Header.Set(name, value)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			ts.t.Fatalf("failed to decode %s %s response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+func (ts *testServer) createDream(text string) dreamJSON {
+	ts.t.Helper()
+
+	var dream dreamJSON
+	resp := ts.do(http.MethodPost, "/api/dreams", map[string]string{"dream": text}, &dream)
+	if resp.StatusCode != http.StatusCreated {
+		ts.t.Fatalf("expected 201 creating dream, got %d", resp.StatusCode)
+	}
+	return dream
+}
+
+// waitForImage polls the status endpoint until the dream has an image or the timeout expires
+func (ts *testServer) waitForImage(id uint) string {
+	ts.t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var status struct {
+			ImageURL string `json:"imageUrl"`
+		}
+		resp := ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d/status", id), nil, &status)
+		if resp.StatusCode == http.StatusOK {
+			return status.ImageURL
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	ts.t.Fatalf("timed out waiting for image for dream %d", id)
+	return ""
+}
+
+type dreamJSON struct {
+	ID            uint              `json:"id"`
+	Dream         string            `json:"dream"`
+	ImageURL      string            `json:"image_url"`
+	ImageVariants map[string]string `json:"image_variants"`
+	Tags          []models.Tag      `json:"tags"`
+	Version       uint              `json:"version"`
+	DreamtOn      string            `json:"dreamt_on"`
+	Lucid         bool              `json:"lucid"`
+	Nightmare     bool              `json:"nightmare"`
+	Mood          *int              `json:"mood"`
+	CreatedAt     string            `json:"created_at"`
+}
+
+type dreamListJSON struct {
+	Dreams     []dreamJSON `json:"dreams"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDreamCRUD(t *testing.T) {
+	ts := newTestServer(t)
+
+	created := ts.createDream("I was flying over a flooded school")
+	if created.ID == 0 || created.Dream != "I was flying over a flooded school" {
+		t.Fatalf("unexpected created dream: %+v", created)
+	}
+	if _, err := time.Parse(time.RFC3339, created.CreatedAt); err != nil {
+		t.Errorf("created_at is not RFC3339: %q", created.CreatedAt)
+	}
+
+	var fetched dreamJSON
+	resp := ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d", created.ID), nil, &fetched)
+	if resp.StatusCode != http.StatusOK || fetched.Dream != created.Dream {
+		t.Fatalf("expected to fetch created dream, got %d %+v", resp.StatusCode, fetched)
+	}
+
+	var updated dreamJSON
+	resp = ts.do(http.MethodPut, fmt.Sprintf("/api/dreams/%d", created.ID), map[string]string{"dream": "The school was underwater"}, &updated)
+	if resp.StatusCode != http.StatusOK || updated.Dream != "The school was underwater" {
+		t.Fatalf("expected updated dream, got %d %+v", resp.StatusCode, updated)
+	}
+
+	ts.createDream("Teeth falling out")
+	var all dreamListJSON
+	ts.do(http.MethodGet, "/api/dreams", nil, &all)
+	if len(all.Dreams) != 2 {
+		t.Fatalf("expected 2 dreams, got %d", len(all.Dreams))
+	}
+
+	resp = ts.do(http.MethodDelete, fmt.Sprintf("/api/dreams/%d", created.ID), nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting dream, got %d", resp.StatusCode)
+	}
+	resp = ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d", created.ID), nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", resp.StatusCode)
+	}
+}
+
+func TestDreamHandlerErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"create with invalid JSON", http.MethodPost, "/api/dreams", "{not json", http.StatusBadRequest},
+		{"get with invalid ID", http.MethodGet, "/api/dreams/abc", nil, http.StatusBadRequest},
+		{"get missing dream", http.MethodGet, "/api/dreams/999", nil, http.StatusNotFound},
+		{"update missing dream", http.MethodPut, "/api/dreams/999", map[string]string{"dream": "x"}, http.StatusNotFound},
+		{"update with invalid JSON", http.MethodPut, "/api/dreams/1", "[", http.StatusBadRequest},
+		{"delete missing dream", http.MethodDelete, "/api/dreams/999", nil, http.StatusNotFound},
+		{"generate image for missing dream", http.MethodPost, "/api/dreams/999/generate-image", nil, http.StatusNotFound},
+		{"status of missing dream", http.MethodGet, "/api/dreams/999/status", nil, http.StatusNotFound},
+		{"search without query", http.MethodGet, "/api/dreams/search?q=%20", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.do(tt.method, tt.path, tt.body, nil)
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestSearchDreams(t *testing.T) {
+	ts := newTestServer(t)
+	for _, text := range []string{"Swimming through a flooded school", "A flooded cellar", "Flying over the school"} {
+		ts.createDream(text)
+	}
+
+	var response struct {
+		Results []struct {
+			Dream   dreamJSON `json:"dream"`
+			Snippet string    `json:"snippet"`
+		} `json:"results"`
+		NextOffset int `json:"next_offset"`
+	}
+	resp := ts.do(http.MethodGet, "/api/dreams/search?q=flooded&limit=1", nil, &response)
+	if resp.StatusCode != http.StatusOK || len(response.Results) != 1 || response.NextOffset != 1 {
+		t.Fatalf("unexpected search response %d %+v", resp.StatusCode, response)
+	}
+	if !strings.Contains(response.Results[0].Snippet, "<mark>flooded</mark>") {
+		t.Errorf("expected highlighted snippet, got %q", response.Results[0].Snippet)
+	}
+}
+
+func TestGenerateImage(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("A staircase that never ends")
+
+	resp := ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d/status", dream.ID), nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 before generation, got %d", resp.StatusCode)
+	}
+
+	var queued GenerateImageResponse
+	resp = ts.do(http.MethodPost, fmt.Sprintf("/api/dreams/%d/generate-image", dream.ID), nil, &queued)
+	if resp.StatusCode != http.StatusAccepted || queued.QueuePosition != 1 {
+		t.Fatalf("expected 202 at position 1, got %d %+v", resp.StatusCode, queued)
+	}
+
+	imageURL := ts.waitForImage(dream.ID)
+	if !strings.HasPrefix(imageURL, "/images/") {
+		t.Fatalf("unexpected image URL %q", imageURL)
+	}
+
+	var fetched dreamJSON
+	ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d", dream.ID), nil, &fetched)
+	if fetched.ImageURL != imageURL {
+		t.Errorf("expected dream image_url %q, got %q", imageURL, fetched.ImageURL)
+	}
+	if fetched.Version != dream.Version {
+		t.Errorf("image generation must not bump the edit version, got %d", fetched.Version)
+	}
+	for _, variant := range []string{"thumbnail", "medium", "jpeg"} {
+		if fetched.ImageVariants[variant] == "" {
+			t.Errorf("expected %s variant, got %v", variant, fetched.ImageVariants)
+		}
+	}
+
+	key := strings.TrimPrefix(imageURL, "/images/")
+	data, ok := ts.storage.Object(key)
+	if !ok {
+		t.Fatalf("expected image %q in storage, have %v", key, ts.storage.Keys())
+	}
+	if len(ts.storage.Keys()) != 4 {
+		t.Errorf("expected original and 3 variants in storage, got %v", ts.storage.Keys())
+	}
+
+	var provenance ImageProvenanceResponse
+	resp = ts.do(http.MethodPost, "/api/images/provenance", data, &provenance)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 reading provenance, got %d", resp.StatusCode)
+	}
+	if provenance.Provenance.DreamID != dream.ID || provenance.Provenance.Model != "test-model" {
+		t.Errorf("unexpected provenance %+v", provenance.Provenance)
+	}
+	if provenance.Dream == nil || provenance.Dream.ID != dream.ID {
+		t.Errorf("expected provenance to resolve dream %d, got %+v", dream.ID, provenance.Dream)
+	}
+}
+
+func TestGenerateImageStorageFailure(t *testing.T) {
+	ts := newTestServer(t)
+	ts.storage.SetFaults(storage.Faults{SaveErr: errors.New("disk full")})
+	dream := ts.createDream("Being late for an exam")
+
+	resp := ts.do(http.MethodPost, fmt.Sprintf("/api/dreams/%d/generate-image", dream.ID), nil, nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+
+	// Once the failed request has been processed the dream is neither queued nor has an image
+	deadline := time.Now().Add(10 * time.Second)
+	for ts.aiCalls.Load() == 0 || func() bool { _, queued := ts.queue.GetQueuePosition(dream.ID); return queued }() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the request to be processed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	resp = ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d/status", dream.ID), nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 after failed generation, got %d", resp.StatusCode)
+	}
+	if keys := ts.storage.Keys(); len(keys) != 0 {
+		t.Errorf("expected nothing stored, got %v", keys)
+	}
+}
+
+func TestImageProvenanceRejectsInvalidUploads(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.do(http.MethodPost, "/api/images/provenance", []byte("not an image"), nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for non-PNG upload, got %d", resp.StatusCode)
+	}
+
+	resp = ts.do(http.MethodPost, "/api/images/provenance", testPNG(t, 4, 4), nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for PNG without provenance, got %d", resp.StatusCode)
+	}
+}
+
+func TestDreamMetadata(t *testing.T) {
+	ts := newTestServer(t)
+
+	var plain dreamJSON
+	ts.do(http.MethodPost, "/api/dreams", map[string]interface{}{"dream": "Just a dream"}, &plain)
+	if plain.DreamtOn != time.Now().Format(time.DateOnly) {
+		t.Errorf("expected dreamt_on to default to today, got %q", plain.DreamtOn)
+	}
+
+	var lucid dreamJSON
+	resp := ts.do(http.MethodPost, "/api/dreams", map[string]interface{}{
+		"dream":     "I realised I was dreaming and flew",
+		"dreamt_on": "2025-03-01",
+		"lucid":     true,
+		"mood":      5,
+		"vividness": 4,
+	}, &lucid)
+	if resp.StatusCode != http.StatusCreated || !lucid.Lucid || lucid.DreamtOn != "2025-03-01" || lucid.Mood == nil || *lucid.Mood != 5 {
+		t.Fatalf("unexpected created dream %d %+v", resp.StatusCode, lucid)
+	}
+
+	invalid := []map[string]interface{}{
+		{"dream": "x", "mood": 6},
+		{"dream": "x", "vividness": 0},
+		{"dream": "x", "dreamt_on": "03/01/2025"},
+		{"dream": "x", "dreamt_on": time.Now().AddDate(0, 0, 3).Format(time.DateOnly)},
+	}
+	for _, body := range invalid {
+		if resp := ts.do(http.MethodPost, "/api/dreams", body, nil); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 for %v, got %d", body, resp.StatusCode)
+		}
+	}
+
+	var updated dreamJSON
+	resp = ts.do(http.MethodPatch, fmt.Sprintf("/api/dreams/%d", plain.ID), map[string]interface{}{"nightmare": true, "mood": 1}, &updated)
+	if resp.StatusCode != http.StatusOK || !updated.Nightmare || updated.Mood == nil || *updated.Mood != 1 {
+		t.Fatalf("unexpected updated dream %d %+v", resp.StatusCode, updated)
+	}
+	resp = ts.do(http.MethodPatch, fmt.Sprintf("/api/dreams/%d", plain.ID), map[string]interface{}{"sleep_quality": 9}, nil)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for invalid update, got %d", resp.StatusCode)
+	}
+
+	for query, want := range map[string]uint{
+		"lucid=true":                 lucid.ID,
+		"nightmare=true":             plain.ID,
+		"mood_min=4":                 lucid.ID,
+		"mood_max=2":                 plain.ID,
+		"dreamt_to=2025-12-31":       lucid.ID,
+		"vividness_min=3&lucid=true": lucid.ID,
+	} {
+		var list dreamListJSON
+		ts.do(http.MethodGet, "/api/dreams?"+query, nil, &list)
+		if len(list.Dreams) != 1 || list.Dreams[0].ID != want {
+			t.Errorf("%s: expected dream %d, got %+v", query, want, list.Dreams)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dreams/services"
+)
+
+const (
+	defaultDreamSignLimit    = 20
+	defaultDreamSignMinCount = 2
+)
+
+type DreamSignHandler struct {
+	signs *services.DreamSignService
+}
+
+func NewDreamSignHandler(signs *services.DreamSignService) *DreamSignHandler {
+	return &DreamSignHandler{
+		signs: signs,
+	}
+}
+
+func (h *DreamSignHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/dream-signs", h.HandleListDreamSigns)
+}
+
+// HandleListDreamSigns lists recurring dream signs with the dreams they appear in. The
+// optional min_count parameter sets how many dreams a sign must appear in, two by default.
+func (h *DreamSignHandler) HandleListDreamSigns(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	limit := defaultDreamSignLimit
+	if v := values.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+	minCount := defaultDreamSignMinCount
+	if v := values.Get("min_count"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid min_count")
+			return
+		}
+		minCount = parsed
+	}
+
+	signs, err := h.signs.Signs(r.Context(), minCount, limit)
+	if err != nil {
+		log.Printf("Error fetching dream signs: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch dream signs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(signs); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"dreams/services"
+)
+
+func TestListDreamSigns(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.createDream("Flying over the flooded city at night")
+	ts.createDream("Flying again, this time above a desert")
+	ts.createDream("Cooking dinner with my sister")
+	if err := ts.signs.Analyze(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var signs services.DreamSigns
+	resp := ts.do(http.MethodGet, "/api/dream-signs", nil, &signs)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(signs.Signs) != 1 || signs.Signs[0].Label != "flying" || signs.Signs[0].Count != 2 {
+		t.Fatalf("expected flying to be the only dream sign, got %+v", signs.Signs)
+	}
+	if linked := signs.Signs[0].Dreams; len(linked) != 2 || linked[0].ID != first.ID {
+		t.Errorf("unexpected linked dreams %+v", linked)
+	}
+
+	resp = ts.do(http.MethodGet, "/api/dream-signs?min_count=1&limit=3", nil, &signs)
+	if resp.StatusCode != http.StatusOK || len(signs.Signs) != 3 {
+		t.Errorf("expected 3 signs, got %d %+v", resp.StatusCode, signs.Signs)
+	}
+
+	for _, query := range []string{"limit=0", "min_count=none"} {
+		var problem Problem
+		resp := ts.do(http.MethodGet, "/api/dream-signs?"+query, nil, &problem)
+		if resp.StatusCode != http.StatusBadRequest || problem.Code != CodeInvalidQuery {
+			t.Errorf("%s: expected 400 invalid_query, got %d %+v", query, resp.StatusCode, problem)
+		}
+	}
+}
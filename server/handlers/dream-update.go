@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"dreams/models"
+	"dreams/repositories"
+)
+
+// DreamUpdate holds the fields clients are allowed to change. Anything else, like the ID,
+// image or timestamps, is managed by the server.
+type DreamUpdate struct {
+	Dream        string       `json:"dream"`
+	DreamtOn     *models.Date `json:"dreamt_on"`
+	Lucid        bool         `json:"lucid"`
+	Nightmare    bool         `json:"nightmare"`
+	Recurring    bool         `json:"recurring"`
+	Mood         *int         `json:"mood"`
+	Vividness    *int         `json:"vividness"`
+	SleepQuality *int         `json:"sleep_quality"`
+}
+
+func newDreamUpdate(d models.Dream) DreamUpdate {
+	return DreamUpdate{
+		Dream:        d.Dream,
+		DreamtOn:     d.DreamtOn,
+		Lucid:        d.Lucid,
+		Nightmare:    d.Nightmare,
+		Recurring:    d.Recurring,
+		Mood:         d.Mood,
+		Vividness:    d.Vividness,
+		SleepQuality: d.SleepQuality,
+	}
+}
+
+// apply copies the updatable fields onto the dream
+func (u DreamUpdate) apply(d *models.Dream) {
+	d.Dream = u.Dream
+	d.DreamtOn = u.DreamtOn
+	d.Lucid = u.Lucid
+	d.Nightmare = u.Nightmare
+	d.Recurring = u.Recurring
+	d.Mood = u.Mood
+	d.Vividness = u.Vividness
+	d.SleepQuality = u.SleepQuality
+}
+
+// validate checks the update as it would be applied to the dream
+func (u DreamUpdate) validate(existing models.Dream) error {
+	candidate := existing
+	u.apply(&candidate)
+	return candidate.Validate()
+}
+
+// decodeDreamUpdate decodes a JSON object into a DreamUpdate, reporting unknown fields and
+// type mismatches as field errors. Fields missing from the object keep their value in base.
+func decodeDreamUpdate(fields map[string]json.RawMessage, base DreamUpdate) (DreamUpdate, error) {
+	var errs models.ValidationErrors
+
+	// The JSON fields of DreamUpdate match the columns the repository saves
+	allowed := make(map[string]bool, len(repositories.EditableColumns))
+	for _, column := range repositories.EditableColumns {
+		allowed[column] = true
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !allowed[name] {
+			errs.Add(name, "cannot be updated")
+		}
+	}
+	if len(errs) > 0 {
+		return base, errs
+	}
+
+	update := base
+	for _, name := range names {
+		// Decode field by field so every bad field is reported, not just the first
+		single, _ := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		if err := json.Unmarshal(single, &update); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				errs.Add(name, fmt.Sprintf("must be a %s", jsonTypeName(typeErr.Type.String())))
+			} else {
+				errs.Add(name, err.Error())
+			}
+		}
+	}
+
+	return update, errs.Err()
+}
+
+func jsonTypeName(goType string) string {
+	switch strings.TrimPrefix(goType, "*") {
+	case "int":
+		return "whole number"
+	case "bool":
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to a target document
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
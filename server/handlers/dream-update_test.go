@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396 appendix A
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch, want interface{}
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+		json.Unmarshal([]byte(tt.want), &want)
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateDreamValidation(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("Original text")
+	path := fmt.Sprintf("/api/dreams/%d", dream.ID)
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		fields []string
+	}{
+		{"server-managed fields", map[string]interface{}{"dream": "x", "id": 7, "image_url": "/evil.png", "deleted_at": nil}, []string{"deleted_at", "id", "image_url"}},
+		{"missing dream text", map[string]interface{}{"lucid": true}, []string{"dream"}},
+		{"wrong types", map[string]interface{}{"dream": "x", "mood": "high", "lucid": "yes"}, []string{"lucid", "mood"}},
+		{"out of range", map[string]interface{}{"dream": "x", "mood": 0, "vividness": 6}, []string{"mood", "vividness"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response Problem
+			resp := ts.do(http.MethodPut, path, tt.body, &response)
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("expected 422, got %d", resp.StatusCode)
+			}
+			var fields []string
+			for _, f := range response.Errors {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected errors for %v, got %+v", tt.fields, response.Errors)
+			}
+		})
+	}
+
+	var unchanged dreamJSON
+	ts.do(http.MethodGet, path, nil, &unchanged)
+	if unchanged.Dream != "Original text" || unchanged.ImageURL != "" {
+		t.Errorf("rejected updates must not change the dream, got %+v", unchanged)
+	}
+}
+
+func TestPutReplacesAndPatchMerges(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("Original text")
+	path := fmt.Sprintf("/api/dreams/%d", dream.ID)
+	ts.db.Exec("UPDATE dreams SET image_url = ? WHERE id = ?", "/images/kept.png", dream.ID)
+
+	var put dreamJSON
+	resp := ts.do(http.MethodPut, path, map[string]interface{}{"dream": "Replaced", "lucid": true, "mood": 4}, &put)
+	if resp.StatusCode != http.StatusOK || put.Dream != "Replaced" || !put.Lucid || put.Mood == nil || *put.Mood != 4 {
+		t.Fatalf("unexpected PUT result %d %+v", resp.StatusCode, put)
+	}
+	if put.ImageURL != "/images/kept.png" {
+		t.Errorf("PUT must not touch the image, got %q", put.ImageURL)
+	}
+	if put.DreamtOn != "" {
+		t.Errorf("PUT should clear omitted fields, got dreamt_on %q", put.DreamtOn)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, ts.server.URL+path, bytes.NewReader([]byte(`{"mood":null,"nightmare":true}`)))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", fmt.Sprintf(`"%d"`, put.Version))
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	var patched dreamJSON
+	json.NewDecoder(httpResp.Body).Decode(&patched)
+	if httpResp.StatusCode != http.StatusOK || patched.Dream != "Replaced" || !patched.Lucid || !patched.Nightmare || patched.Mood != nil {
+		t.Fatalf("unexpected PATCH result %d %+v", httpResp.StatusCode, patched)
+	}
+
+	// null clears a field in a merge patch, so a plain JSON body is refused rather than guessed at
+	for _, contentType := range []string{"text/plain", "application/json"} {
+		req, _ = http.NewRequest(http.MethodPatch, ts.server.URL+path, bytes.NewReader([]byte(`{"lucid":false}`)))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", "*")
+		httpResp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415 for a %s patch, got %d", contentType, httpResp.StatusCode)
+		}
+	}
+}
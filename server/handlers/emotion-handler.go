@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dreams/repositories"
+	"dreams/services"
+)
+
+type EmotionHandler struct {
+	emotions *services.EmotionService
+}
+
+func NewEmotionHandler(emotions *services.EmotionService) *EmotionHandler {
+	return &EmotionHandler{
+		emotions: emotions,
+	}
+}
+
+func (h *EmotionHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/dreams/{id}/emotions", h.HandleDreamEmotions)
+	http.HandleFunc("GET /api/stats/moods", h.HandleMoods)
+}
+
+// HandleDreamEmotions returns the fear, joy, sadness, anger and surprise scores of a dream
+func (h *EmotionHandler) HandleDreamEmotions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
+		return
+	}
+
+	emotion, err := h.emotions.Emotions(r.Context(), uint(id))
+	if err == repositories.ErrNotFound {
+		writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error scoring dream emotions: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to score dream emotions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(emotion); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandleMoods returns the average emotion scores of the dreams between the optional from
+// and to dates, per day, week or month as set by the period parameter (week by default)
+func (h *EmotionHandler) HandleMoods(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parseDateRange(query)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, err.Error())
+		return
+	}
+	period := query.Get("period")
+	switch period {
+	case "":
+		period = services.MoodByWeek
+	case services.MoodByDay, services.MoodByWeek, services.MoodByMonth:
+	default:
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "period must be day, week or month")
+		return
+	}
+
+	moods, err := h.emotions.Moods(r.Context(), services.StatsRange{From: from, To: to}, period)
+	if err != nil {
+		log.Printf("Error computing mood trends: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to compute mood trends")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(moods); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dreams/models"
+	"dreams/services"
+)
+
+func TestDreamEmotions(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("Chased by wolves, I was terrified")
+
+	var emotion models.DreamEmotion
+	resp := ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d/emotions", dream.ID), nil, &emotion)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if emotion.Fear == 0 || emotion.Joy != 0 || emotion.Source != models.EmotionLexicon || emotion.DreamVersion != 1 {
+		t.Errorf("expected a fearful dream, got %+v", emotion)
+	}
+
+	// Edits are scored again as they are saved
+	ts.do(http.MethodPatch, fmt.Sprintf("/api/dreams/%d", dream.ID), map[string]interface{}{"dream": "Dancing with wolves, laughing"}, nil)
+	ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d/emotions", dream.ID), nil, &emotion)
+	if emotion.Fear != 0 || emotion.Joy == 0 || emotion.DreamVersion != 2 {
+		t.Errorf("expected the edit to be scored, got %+v", emotion)
+	}
+
+	for path, want := range map[string]int{
+		"/api/dreams/abc/emotions": http.StatusBadRequest,
+		"/api/dreams/999/emotions": http.StatusNotFound,
+	} {
+		var problem Problem
+		if resp := ts.do(http.MethodGet, path, nil, &problem); resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d %+v", path, want, resp.StatusCode, problem)
+		}
+	}
+}
+
+func TestMoods(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createDream("So happy, laughing all night")
+	ts.createDream("A calm and peaceful lake")
+
+	var moods services.MoodTrends
+	resp := ts.do(http.MethodGet, "/api/stats/moods?period=month", nil, &moods)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if moods.Period != services.MoodByMonth || len(moods.Periods) != 1 || moods.Periods[0].Dreams != 2 || moods.Average.Joy == 0 {
+		t.Errorf("unexpected moods %+v", moods)
+	}
+
+	resp = ts.do(http.MethodGet, "/api/stats/moods?from=2000-01-01&to=2000-12-31", nil, &moods)
+	if resp.StatusCode != http.StatusOK || moods.Period != services.MoodByWeek || moods.Periods == nil || moods.Dreams != 0 {
+		t.Errorf("expected empty weekly moods, got %d %+v", resp.StatusCode, moods)
+	}
+
+	for _, query := range []string{"period=year", "from=2024-02-01&to=2024-01-01"} {
+		var problem Problem
+		resp := ts.do(http.MethodGet, "/api/stats/moods?"+query, nil, &problem)
+		if resp.StatusCode != http.StatusBadRequest || problem.Code != CodeInvalidQuery {
+			t.Errorf("%s: expected 400 invalid_query, got %d %+v", query, resp.StatusCode, problem)
+		}
+	}
+}
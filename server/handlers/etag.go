@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dreams/models"
+)
+
+// dreamETag is a strong entity tag for the edit version of a dream. It only changes when
+// the dream is edited by a user, so background changes like a newly generated image don't
+// make pending edits fail.
+func dreamETag(dream models.Dream) string {
+	return `"` + strconv.FormatUint(uint64(dream.Version), 10) + `"`
+}
+
+// checkIfMatch enforces the If-Match precondition for changing a dream. It returns 0 when the
+// request may proceed, 428 when the header is missing and 412 when no tag matches.
+func checkIfMatch(r *http.Request, dream models.Dream) int {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return http.StatusPreconditionRequired
+	}
+	if header == "*" {
+		return 0
+	}
+
+	current := dreamETag(dream)
+	for _, tag := range strings.Split(header, ",") {
+		// Weak tags never match under the strong comparison If-Match requires
+		if strings.TrimSpace(tag) == current {
+			return 0
+		}
+	}
+	return http.StatusPreconditionFailed
+}
+
+// writePreconditionError writes the response for a failed checkIfMatch
+func writePreconditionError(w http.ResponseWriter, r *http.Request, status int) {
+	if status == http.StatusPreconditionRequired {
+		writeProblem(w, r, status, CodePreconditionRequired, "If-Match header is required")
+		return
+	}
+	writeProblem(w, r, status, CodeVersionConflict, "Dream was modified by another request")
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestOptimisticConcurrency(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("Two tabs editing")
+	path := fmt.Sprintf("/api/dreams/%d", dream.ID)
+
+	resp := ts.do(http.MethodGet, path, nil, nil)
+	etag := resp.Header.Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	// Missing If-Match is rejected for every kind of change
+	for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		resp := ts.request(method, path, map[string]string{"If-Match": ""}, map[string]string{"dream": "x"}, nil)
+		if resp.StatusCode != http.StatusPreconditionRequired {
+			t.Errorf("%s without If-Match: expected 428, got %d", method, resp.StatusCode)
+		}
+	}
+
+	// The first tab saves and gets the new ETag
+	var first dreamJSON
+	resp = ts.request(http.MethodPatch, path, map[string]string{"If-Match": etag}, map[string]string{"dream": "First tab"}, &first)
+	if resp.StatusCode != http.StatusOK || first.Version != 2 || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("expected version 2, got %d %+v ETag %q", resp.StatusCode, first, resp.Header.Get("ETag"))
+	}
+
+	// The second tab still has the old ETag and must not clobber the first
+	for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		resp := ts.request(method, path, map[string]string{"If-Match": etag}, map[string]string{"dream": "Second tab"}, nil)
+		if resp.StatusCode != http.StatusPreconditionFailed {
+			t.Errorf("%s with stale If-Match: expected 412, got %d", method, resp.StatusCode)
+		}
+	}
+
+	resp = ts.request(http.MethodDelete, path, map[string]string{"If-Match": `"0", "2"`}, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected delete with current ETag in a list to succeed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"dreams/services"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+func (h *ExportHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/export", h.HandleExport)
+	http.HandleFunc("GET /api/export/book", h.HandleBook)
+}
+
+// exportFormats maps each export format to its content type and file extension
+var exportFormats = map[services.ExportFormat]struct {
+	contentType string
+	extension   string
+}{
+	services.ExportJSON:     {"application/json", "json"},
+	services.ExportMarkdown: {"text/markdown; charset=utf-8", "md"},
+	services.ExportZip:      {"application/zip", "zip"},
+}
+
+// HandleExport streams every dream as a download in the format given by the format
+// parameter, json by default
+func (h *ExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	format := services.ExportFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = services.ExportJSON
+	}
+	exportFormat, ok := exportFormats[format]
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "format must be json, markdown or zip")
+		return
+	}
+
+	filename := fmt.Sprintf("dreams-%s.%s", time.Now().Format(time.DateOnly), exportFormat.extension)
+	download := &downloadWriter{w: w, contentType: exportFormat.contentType, filename: filename}
+	err := h.exportService.Export(r.Context(), download, format)
+	if err == nil {
+		return
+	}
+	log.Printf("Error exporting dreams as %s: %v", format, err)
+	// Once streaming has started the status can't change, so later failures leave the
+	// download truncated
+	if !download.started {
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to export dreams")
+	}
+}
+
+// downloadWriter sets the download headers on the first write, so a failure before any
+// output can still be sent as a problem
+type downloadWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.w.Header().Set("Content-Type", d.contentType)
+		d.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.filename))
+	}
+	return d.w.Write(p)
+}
+
+// bookContentTypes maps each book format to its content type
+var bookContentTypes = map[services.BookFormat]string{
+	services.BookEPUB: "application/epub+zip",
+	services.BookPDF:  "application/pdf",
+}
+
+// HandleBook renders the dreams between the from and to dates (YYYY-MM-DD, inclusive) as
+// an EPUB or PDF book, given by the format parameter
+func (h *ExportHandler) HandleBook(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	format := services.BookFormat(values.Get("format"))
+	if format == "" {
+		format = services.BookEPUB
+	}
+	contentType, ok := bookContentTypes[format]
+	if !ok {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "format must be epub or pdf")
+		return
+	}
+
+	from, to, err := parseDateRange(values)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, err.Error())
+		return
+	}
+
+	book, err := h.exportService.Book(r.Context(), services.BookRequest{Title: values.Get("title"), From: from, To: to})
+	if errors.Is(err, services.ErrBookTooLarge) {
+		writeProblem(w, r, http.StatusUnprocessableEntity, CodeInvalidQuery, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error collecting dreams for book: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create book")
+		return
+	}
+
+	// Books are rendered before sending so a failure can still be reported
+	var buf bytes.Buffer
+	if err := services.WriteBook(r.Context(), &buf, format, book); err != nil {
+		log.Printf("Error rendering book as %s: %v", format, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create book")
+		return
+	}
+
+	filename := fmt.Sprintf("dreams-%s.%s", time.Now().Format(time.DateOnly), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error writing book: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dreams/services"
+)
+
+func (ts *testServer) export(format string) (*http.Response, []byte) {
+	ts.t.Helper()
+	return ts.download("/api/export?format=" + format)
+}
+
+func (ts *testServer) download(path string) (*http.Response, []byte) {
+	ts.t.Helper()
+
+	resp, err := http.Get(ts.server.URL + path)
+	if err != nil {
+		ts.t.Fatalf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ts.t.Fatalf("failed to read download: %v", err)
+	}
+	return resp, body
+}
+
+func TestExport(t *testing.T) {
+	ts := newTestServer(t)
+	first := ts.createDream("Swimming through a flooded school")
+	ts.do(http.MethodPost, fmt.Sprintf("/api/dreams/%d/tags", first.ID), map[string][]string{"tags": {"water"}}, nil)
+	ts.do(http.MethodPatch, fmt.Sprintf("/api/dreams/%d", first.ID), map[string]interface{}{"lucid": true, "mood": 4}, nil)
+	if _, err := ts.storage.SaveImage(t.Context(), testPNG(t, 4, 4), "school.png"); err != nil {
+		t.Fatal(err)
+	}
+	ts.db.Exec("UPDATE dreams SET image_url = ? WHERE id = ?", ts.storage.GetImageURL("school.png"), first.ID)
+	ts.createDream("A staircase that never ends")
+
+	t.Run("json", func(t *testing.T) {
+		resp, body := ts.export("json")
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment;") {
+			t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+		}
+		var document services.ExportDocument
+		if err := json.Unmarshal(body, &document); err != nil {
+			t.Fatalf("export is not valid JSON: %v\n%s", err, body)
+		}
+		if document.Version != services.ExportVersion || len(document.Dreams) != 2 {
+			t.Fatalf("unexpected export %+v", document)
+		}
+		dream := document.Dreams[0]
+		if dream.Dream != first.Dream || !dream.Lucid || dream.Mood == nil || *dream.Mood != 4 || fmt.Sprint(dream.Tags) != "[water]" {
+			t.Errorf("unexpected exported dream %+v", dream)
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		resp, body := ts.export("markdown")
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/markdown") {
+			t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+		}
+		for _, want := range []string{"# Dream journal", "*Tags: water · Lucid · Mood 4/5*", "A staircase that never ends"} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("expected markdown to contain %q:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		resp, body := ts.export("zip")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+			t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("export is not a valid ZIP: %v", err)
+		}
+		files := map[string]string{}
+		for _, file := range archive.File {
+			r, _ := file.Open()
+			data, _ := io.ReadAll(r)
+			r.Close()
+			files[file.Name] = string(data)
+		}
+		if len(files) != 4 || files["images/school.png"] == "" {
+			t.Fatalf("expected index, two dreams and an image, got %v", len(files))
+		}
+		markdown := files[fmt.Sprintf("dreams/%s-%d.md", first.DreamtOn, first.ID)]
+		for _, want := range []string{"---\n", "lucid: true\n", "image: images/school.png\n", "- water\n", "![](../images/school.png)", first.Dream} {
+			if !strings.Contains(markdown, want) {
+				t.Errorf("expected dream file to contain %q:\n%s", want, markdown)
+			}
+		}
+		if !strings.Contains(files["index.md"], fmt.Sprintf("(dreams/%s-%d.md) Swimming", first.DreamtOn, first.ID)) {
+			t.Errorf("expected index to link the dream:\n%s", files["index.md"])
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		var problem Problem
+		resp := ts.do(http.MethodGet, "/api/export?format=pdf", nil, &problem)
+		if resp.StatusCode != http.StatusBadRequest || problem.Code != CodeInvalidQuery {
+			t.Errorf("expected 400 invalid_query, got %d %+v", resp.StatusCode, problem)
+		}
+	})
+}
+
+func TestExportReportsEarlyFailures(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createDream("A library with no doors")
+	if err := ts.db.Exec("ALTER TABLE dreams RENAME TO lost_dreams").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"json", "markdown", "zip"} {
+		var problem Problem
+		resp := ts.do(http.MethodGet, "/api/export?format="+format, nil, &problem)
+		if resp.StatusCode != http.StatusInternalServerError || problem.Code != CodeInternal {
+			t.Errorf("%s: expected 500 internal, got %d %+v", format, resp.StatusCode, problem)
+		}
+		if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+			t.Errorf("%s: expected no download headers, got %q", format, disposition)
+		}
+	}
+}
+
+func TestExportBook(t *testing.T) {
+	ts := newTestServer(t)
+	for _, dream := range []struct{ text, dreamtOn string }{
+		{"Riding a bicycle across the sea", "2024-02-27"},
+		{"A lighthouse made of glass", "2024-03-02"},
+		{"Lost in an airport", "2024-05-10"},
+	} {
+		created := ts.createDream(dream.text)
+		ts.do(http.MethodPatch, fmt.Sprintf("/api/dreams/%d", created.ID), map[string]interface{}{"dreamt_on": dream.dreamtOn}, nil)
+	}
+
+	t.Run("epub", func(t *testing.T) {
+		resp, body := ts.download("/api/export/book?format=epub&from=2024-02-01&to=2024-03-31&title=Winter")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/epub+zip" {
+			t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("book is not a valid EPUB: %v", err)
+		}
+		var text strings.Builder
+		for _, file := range archive.File {
+			r, _ := file.Open()
+			data, _ := io.ReadAll(r)
+			r.Close()
+			text.Write(data)
+		}
+		for _, want := range []string{"Winter", "February 2024", "March 2024", "Riding a bicycle", "A lighthouse"} {
+			if !strings.Contains(text.String(), want) {
+				t.Errorf("expected book to contain %q", want)
+			}
+		}
+		if strings.Contains(text.String(), "airport") {
+			t.Error("expected dreams outside the range to be left out")
+		}
+	})
+
+	t.Run("pdf", func(t *testing.T) {
+		resp, body := ts.download("/api/export/book?format=pdf")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/pdf" {
+			t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+		}
+		if !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+			t.Errorf("expected a PDF document")
+		}
+	})
+
+	for _, query := range []string{"format=mobi", "from=March", "from=2024-03-01&to=2024-02-01"} {
+		t.Run(query, func(t *testing.T) {
+			var problem Problem
+			resp := ts.do(http.MethodGet, "/api/export/book?"+query, nil, &problem)
+			if resp.StatusCode != http.StatusBadRequest || problem.Code != CodeInvalidQuery {
+				t.Errorf("expected 400 invalid_query, got %d %+v", resp.StatusCode, problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"dreams/services/storage"
+)
+
+// ImageHandler serves stored images with caching headers. S3 images are served by S3 itself,
+// so this is only registered for local and in-memory storage.
+type ImageHandler struct {
+	storageProvider storage.StorageProvider
+}
+
+func NewImageHandler(storageProvider storage.StorageProvider) *ImageHandler {
+	return &ImageHandler{
+		storageProvider: storageProvider,
+	}
+}
+
+func (h *ImageHandler) RegisterRoutes() {
+	http.HandleFunc("GET /images/{key...}", h.HandleGetImage)
+}
+
+// HandleGetImage serves an image with a strong ETag and a Cache-Control policy based on its key.
+// Range, If-Range and If-None-Match are handled by http.ServeContent.
+func (h *ImageHandler) HandleGetImage(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeProblem(w, r, http.StatusNotFound, CodeImageNotFound, "Missing image key")
+		return
+	}
+
+	// Content-addressed keys already carry their hash, so a cached copy can be confirmed
+	// with an existence check instead of reading the image
+	etag := ""
+	if storage.IsContentKey(key) {
+		etag = `"` + strings.TrimSuffix(path.Base(key), path.Ext(key)) + `"`
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			exists, err := h.storageProvider.Exists(r.Context(), key)
+			if err != nil {
+				log.Printf("Error checking image %s: %v", key, err)
+				writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to read image")
+				return
+			}
+			if !exists {
+				writeProblem(w, r, http.StatusNotFound, CodeImageNotFound, "Image not found")
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", storage.CacheControl(key))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	data, err := h.storageProvider.GetImage(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			writeProblem(w, r, http.StatusNotFound, CodeImageNotFound, "Image not found")
+		} else {
+			log.Printf("Error reading image %s: %v", key, err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to read image")
+		}
+		return
+	}
+
+	if etag == "" {
+		sum := sha256.Sum256(data)
+		etag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", storage.CacheControl(key))
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	// A zero modification time leaves validation to the ETag
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(data))
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag, using the weak
+// comparison RFC 9110 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
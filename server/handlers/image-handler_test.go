@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dreams/services/storage"
+)
+
+func newImageTestServer(t *testing.T) (*httptest.Server, *storage.MemoryStorage) {
+	t.Helper()
+
+	store := storage.NewMemoryStorage()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /images/{key...}", NewImageHandler(store).HandleGetImage)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+func getImage(t *testing.T, url string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestImageHandlerCaching(t *testing.T) {
+	server, store := newImageTestServer(t)
+
+	data := testPNG(t, 16, 16)
+	key := storage.ContentKey(data, ".png")
+	if _, err := store.SaveImage(context.Background(), data, key); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := getImage(t, server.URL+"/images/"+key, nil)
+	if resp.StatusCode != http.StatusOK || len(body) != len(data) {
+		t.Fatalf("expected full image, got %d with %d bytes", resp.StatusCode, len(body))
+	}
+	if got := resp.Header.Get("Cache-Control"); got != storage.ImmutableCacheControl {
+		t.Errorf("expected immutable Cache-Control, got %q", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("expected image/png, got %q", got)
+	}
+	etag := resp.Header.Get("ETag")
+	if len(etag) != 66 || etag[0] != '"' {
+		t.Fatalf("expected strong ETag, got %q", etag)
+	}
+
+	resp, body = getImage(t, server.URL+"/images/"+key, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+		t.Errorf("expected 304 for matching ETag, got %d", resp.StatusCode)
+	}
+
+	resp, body = getImage(t, server.URL+"/images/"+key, map[string]string{"Range": "bytes=0-7"})
+	if resp.StatusCode != http.StatusPartialContent || string(body) != string(data[:8]) {
+		t.Errorf("expected first 8 bytes, got %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Range"); got == "" {
+		t.Error("expected Content-Range header")
+	}
+
+	resp, _ = getImage(t, server.URL+"/images/"+key, map[string]string{"If-None-Match": `"other", ` + etag})
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != etag {
+		t.Errorf("expected 304 for an ETag in a list, got %d", resp.StatusCode)
+	}
+
+	// A deleted image is gone, however the client validates
+	store.DeleteImage(context.Background(), key)
+	for _, match := range []string{etag, "*"} {
+		resp, _ = getImage(t, server.URL+"/images/"+key, map[string]string{"If-None-Match": match})
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 for a deleted image with If-None-Match %s, got %d", match, resp.StatusCode)
+		}
+	}
+}
+
+func TestImageHandlerNonContentKeys(t *testing.T) {
+	server, store := newImageTestServer(t)
+
+	if _, err := store.SaveImage(context.Background(), testPNG(t, 4, 4), "legacy/image_1_2.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := getImage(t, server.URL+"/images/legacy/image_1_2.png", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != storage.DefaultCacheControl {
+		t.Errorf("expected default Cache-Control for legacy keys, got %q", got)
+	}
+
+	etag := resp.Header.Get("ETag")
+	resp, _ = getImage(t, server.URL+"/images/legacy/image_1_2.png", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %d", resp.StatusCode)
+	}
+
+	resp, _ = getImage(t, server.URL+"/images/missing.png", nil)
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("Content-Type") != "application/problem+json" {
+		t.Errorf("expected a 404 problem for missing image, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+
+	"dreams/services"
+)
+
+// maxImportSize is the largest file accepted for import
+const maxImportSize = 256 << 20
+
+type ImportHandler struct {
+	importService *services.ImportService
+}
+
+func NewImportHandler(importService *services.ImportService) *ImportHandler {
+	return &ImportHandler{
+		importService: importService,
+	}
+}
+
+func (h *ImportHandler) RegisterRoutes() {
+	http.HandleFunc("POST /api/import", h.HandleImport)
+	http.HandleFunc("GET /api/import/{id}", h.HandleImportStatus)
+}
+
+// HandleImport starts a background import of an uploaded file and returns the job with
+// 202 Accepted. The multipart form has the file in "file" and optionally:
+//   - format: json, zip or csv, guessed from the file when omitted
+//   - dry_run: true to preview the import without saving anything
+//   - mapping: for CSV, a JSON object mapping dream fields to column names
+func (h *ImportHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Upload the file as multipart/form-data")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid multipart body")
+		return
+	}
+
+	var req services.ImportRequest
+	var path, filename string
+	var head []byte
+	defer func() {
+		// The job owns the file once it has started
+		if path != "" {
+			os.Remove(path)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.writeUploadError(w, r, err)
+			return
+		}
+
+		if part.FormName() == "file" {
+			if path != "" {
+				writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Upload a single file")
+				return
+			}
+			filename = part.FileName()
+			path, head, err = saveUpload(part)
+			if err != nil {
+				h.writeUploadError(w, r, err)
+				return
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, 64<<10))
+		if err != nil {
+			h.writeUploadError(w, r, err)
+			return
+		}
+		switch part.FormName() {
+		case "format":
+			req.Format = services.ImportFormat(value)
+		case "dry_run":
+			if req.DryRun, err = strconv.ParseBool(string(value)); err != nil {
+				writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "dry_run must be true or false")
+				return
+			}
+		case "mapping":
+			if err := json.Unmarshal(value, &req.Mapping); err != nil {
+				writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "mapping must be a JSON object of field names to column names")
+				return
+			}
+		}
+	}
+
+	if path == "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "file is required")
+		return
+	}
+	if req.Format == "" {
+		format, ok := services.DetectImportFormat(filename, head)
+		if !ok {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Could not tell the file's format, set format to json, zip or csv")
+			return
+		}
+		req.Format = format
+	}
+	switch req.Format {
+	case services.ImportJSON, services.ImportZip, services.ImportCSV:
+	default:
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "format must be json, zip or csv")
+		return
+	}
+	if err := req.Mapping.Validate(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+
+	job := h.importService.Start(path, req)
+	path = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/import/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandleImportStatus returns the progress of an import job
+func (h *ImportHandler) HandleImportStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.importService.Job(r.PathValue("id"))
+	if !ok {
+		writeProblem(w, r, http.StatusNotFound, CodeImportNotFound, "Import not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (h *ImportHandler) writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, CodeFileTooLarge, "Imports are limited to "+strconv.Itoa(maxImportSize>>20)+" MB")
+		return
+	}
+	log.Printf("Error reading import upload: %v", err)
+	writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Failed to read upload")
+}
+
+// saveUpload copies an uploaded file to a temporary file and returns its path and first
+// bytes, which are used to detect the format
+func saveUpload(r io.Reader) (string, []byte, error) {
+	file, err := os.CreateTemp("", "dreams-import-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(r)
+	head, _ := buffered.Peek(512)
+	head = append([]byte(nil), head...)
+	if _, err := io.Copy(file, buffered); err != nil {
+		os.Remove(file.Name())
+		return "", nil, err
+	}
+	return file.Name(), head, nil
+}
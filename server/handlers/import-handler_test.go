@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"dreams/services"
+)
+
+// startImport uploads a file to the import endpoint with the given form fields
+func (ts *testServer) startImport(filename string, data []byte, fields map[string]string) (*http.Response, services.ImportJob) {
+	ts.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	file, _ := form.CreateFormFile("file", filename)
+	file.Write(data)
+	form.Close()
+
+	resp, err := http.Post(ts.server.URL+"/api/import", form.FormDataContentType(), &body)
+	if err != nil {
+		ts.t.Fatalf("import failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var job services.ImportJob
+	json.NewDecoder(resp.Body).Decode(&job)
+	return resp, job
+}
+
+// waitForImport polls the status endpoint until the job finishes
+func (ts *testServer) waitForImport(id string) services.ImportJob {
+	ts.t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var job services.ImportJob
+		ts.do(http.MethodGet, "/api/import/"+id, nil, &job)
+		if job.Status == services.ImportCompleted || job.Status == services.ImportFailed {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	ts.t.Fatalf("timed out waiting for import %s", id)
+	return services.ImportJob{}
+}
+
+func TestImportExportedZip(t *testing.T) {
+	source := newTestServer(t)
+	first := source.createDream("Swimming through a flooded school")
+	source.do(http.MethodPost, fmt.Sprintf("/api/dreams/%d/tags", first.ID), map[string][]string{"tags": {"water"}}, nil)
+	source.storage.SaveImage(t.Context(), testPNG(t, 8, 8), "school.png")
+	source.db.Exec("UPDATE dreams SET image_url = ? WHERE id = ?", source.storage.GetImageURL("school.png"), first.ID)
+	source.createDream("A staircase that never ends")
+	_, archive := source.export("zip")
+
+	ts := newTestServer(t)
+	ts.createDream("A staircase that never ends")
+
+	resp, job := ts.startImport("journal.zip", archive, map[string]string{"dry_run": "true"})
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") != "/api/import/"+job.ID || job.Format != services.ImportZip {
+		t.Fatalf("unexpected response %d %+v", resp.StatusCode, job)
+	}
+	job = ts.waitForImport(job.ID)
+	if job.Status != services.ImportCompleted || job.Imported != 1 || job.Duplicates != 1 || len(job.Preview) != 1 {
+		t.Fatalf("unexpected dry run %+v", job)
+	}
+	var list dreamListJSON
+	if ts.do(http.MethodGet, "/api/dreams", nil, &list); len(list.Dreams) != 1 {
+		t.Fatalf("dry run must not save dreams, got %d", len(list.Dreams))
+	}
+
+	_, job = ts.startImport("journal.zip", archive, nil)
+	job = ts.waitForImport(job.ID)
+	if job.Status != services.ImportCompleted || job.Imported != 1 || job.Duplicates != 1 || job.Failed != 0 {
+		t.Fatalf("unexpected import %+v", job)
+	}
+	ts.do(http.MethodGet, "/api/dreams?order=asc", nil, &list)
+	if len(list.Dreams) != 2 {
+		t.Fatalf("expected 2 dreams after import, got %d", len(list.Dreams))
+	}
+	// The import keeps the original creation time, so it sorts before the existing dream
+	imported := list.Dreams[0]
+	if imported.CreatedAt != first.CreatedAt || imported.Dream != first.Dream || imported.DreamtOn != first.DreamtOn || len(imported.Tags) != 1 || imported.Tags[0].Name != "water" || imported.ImageURL == "" {
+		t.Errorf("unexpected imported dream %+v", imported)
+	}
+
+	// Importing the same file again finds only duplicates
+	_, job = ts.startImport("journal.zip", archive, nil)
+	if job = ts.waitForImport(job.ID); job.Imported != 0 || job.Duplicates != 2 {
+		t.Errorf("expected a repeat import to skip every dream, got %+v", job)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	ts := newTestServer(t)
+	csv := "When,Entry,Labels\n2021-06-01,Talking to a cat,animals\n2021-06-02,,\n2021-06-03,Talking to a cat,animals\n"
+
+	_, job := ts.startImport("journal.csv", []byte(csv), map[string]string{
+		"mapping": `{"dream":"Entry","dreamt_on":"When","tags":"Labels"}`,
+	})
+	job = ts.waitForImport(job.ID)
+	if job.Status != services.ImportCompleted || job.Imported != 2 || job.Failed != 1 || job.Progress != 1 {
+		t.Fatalf("unexpected import %+v", job)
+	}
+	if len(job.Errors) != 1 || job.Errors[0].Source != "line 3" {
+		t.Errorf("expected line 3 to be reported, got %+v", job.Errors)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		fields   map[string]string
+		status   int
+	}{
+		{"unknown format", "notes.txt", "hello", nil, http.StatusBadRequest},
+		{"bad dry_run", "journal.json", "[]", map[string]string{"dry_run": "perhaps"}, http.StatusBadRequest},
+		{"unknown mapping field", "journal.csv", "a\n", map[string]string{"mapping": `{"title":"a"}`}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp, _ := ts.startImport(tt.filename, []byte(tt.data), tt.fields); resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+
+	_, job := ts.startImport("journal.json", []byte(`{"dreams": 5}`), nil)
+	if job = ts.waitForImport(job.ID); job.Status != services.ImportFailed || job.Error == "" {
+		t.Errorf("expected an unreadable file to fail the job, got %+v", job)
+	}
+
+	var problem Problem
+	if resp := ts.do(http.MethodGet, "/api/import/missing", nil, &problem); resp.StatusCode != http.StatusNotFound || problem.Code != CodeImportNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d %+v", resp.StatusCode, problem)
+	}
+}
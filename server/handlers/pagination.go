@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// encodeCursor turns the position after the last dream of a page into an opaque base64
+// string, so the keyset can change without breaking the API
+func encodeCursor(c repositories.DreamCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*repositories.DreamCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor repositories.DreamCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// parseDreamListQuery reads the list options from the query string:
+// limit, cursor, order (asc|desc), from and to (RFC 3339 or YYYY-MM-DD), has_image (bool),
+// tags (comma-separated or repeated), tag_mode (and|or), lucid, nightmare and recurring (bool),
+// dreamt_from and dreamt_to (YYYY-MM-DD) and <rating>_min/<rating>_max for mood, vividness
+// and sleep_quality
+func parseDreamListQuery(values url.Values) (repositories.DreamListQuery, error) {
+	query := repositories.DreamListQuery{
+		Limit:   defaultPageSize,
+		Order:   repositories.SortNewest,
+		TagMode: repositories.TagModeAnd,
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		query.Limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return query, err
+		}
+		query.Cursor = cursor
+	}
+
+	switch repositories.SortOrder(values.Get("order")) {
+	case "", repositories.SortNewest:
+	case repositories.SortOldest:
+		query.Order = repositories.SortOldest
+	default:
+		return query, fmt.Errorf("order must be %q or %q", repositories.SortOldest, repositories.SortNewest)
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(values, "from", false); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTimeParam(values, "to", true); err != nil {
+		return query, err
+	}
+
+	if v := values.Get("has_image"); v != "" {
+		hasImage, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("has_image must be a boolean")
+		}
+		query.HasImage = &hasImage
+	}
+
+	seen := make(map[string]bool)
+	for _, param := range values["tags"] {
+		for _, tag := range strings.Split(param, ",") {
+			if strings.TrimSpace(tag) == "" {
+				continue
+			}
+			name, err := models.NormalizeTagName(tag)
+			if err != nil {
+				return query, err
+			}
+			if !seen[name] {
+				seen[name] = true
+				query.Tags = append(query.Tags, name)
+			}
+		}
+	}
+
+	switch repositories.TagMode(values.Get("tag_mode")) {
+	case "", repositories.TagModeAnd:
+	case repositories.TagModeOr:
+		query.TagMode = repositories.TagModeOr
+	default:
+		return query, fmt.Errorf("tag_mode must be %q or %q", repositories.TagModeAnd, repositories.TagModeOr)
+	}
+
+	for _, column := range repositories.FlagColumns {
+		if v := values.Get(column); v != "" {
+			flag, err := strconv.ParseBool(v)
+			if err != nil {
+				return query, fmt.Errorf("%s must be a boolean", column)
+			}
+			if query.Flags == nil {
+				query.Flags = make(map[string]bool)
+			}
+			query.Flags[column] = flag
+		}
+	}
+
+	for _, bound := range []struct {
+		name string
+		dest **models.Date
+	}{{"dreamt_from", &query.DreamtFrom}, {"dreamt_to", &query.DreamtTo}} {
+		if v := values.Get(bound.name); v != "" {
+			date, err := models.ParseDate(v)
+			if err != nil {
+				return query, fmt.Errorf("%s must be a YYYY-MM-DD date", bound.name)
+			}
+			*bound.dest = &date
+		}
+	}
+
+	for _, column := range repositories.RatingColumns {
+		rating := repositories.RatingRange{Column: column, Min: models.MinRating, Max: models.MaxRating}
+		filtered := false
+		for _, bound := range []struct {
+			suffix string
+			dest   *int
+		}{{"_min", &rating.Min}, {"_max", &rating.Max}} {
+			v := values.Get(column + bound.suffix)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < models.MinRating || n > models.MaxRating {
+				return query, fmt.Errorf("%s%s must be between %d and %d", column, bound.suffix, models.MinRating, models.MaxRating)
+			}
+			*bound.dest = n
+			filtered = true
+		}
+		if filtered {
+			query.Ratings = append(query.Ratings, rating)
+		}
+	}
+
+	return query, nil
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a plain date. A plain date used as an
+// upper bound covers the whole day.
+func parseTimeParam(values url.Values, name string, endOfDay bool) (*time.Time, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// DreamListResponse is the response envelope for the list endpoint
+type DreamListResponse struct {
+	Dreams     []models.Dream `json:"dreams"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// newDreamListResponse trims the extra row fetched by the repository and sets the cursor for the next page
+func newDreamListResponse(dreams []models.Dream, limit int) DreamListResponse {
+	response := DreamListResponse{Dreams: dreams}
+	if response.Dreams == nil {
+		response.Dreams = []models.Dream{}
+	}
+	if len(dreams) > limit {
+		response.Dreams = dreams[:limit]
+		last := response.Dreams[limit-1]
+		response.NextCursor = encodeCursor(repositories.DreamCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return response
+}
+
+// parseDateRange reads the inclusive from and to dates (YYYY-MM-DD) from the query string,
+// either of which can be left out
+func parseDateRange(values url.Values) (from, to *models.Date, err error) {
+	for _, bound := range []struct {
+		name string
+		dest **models.Date
+	}{{"from", &from}, {"to", &to}} {
+		if v := values.Get(bound.name); v != "" {
+			date, err := models.ParseDate(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s must be a YYYY-MM-DD date", bound.name)
+			}
+			*bound.dest = &date
+		}
+	}
+	if from != nil && to != nil && to.Before(from.Time) {
+		return nil, nil, fmt.Errorf("to must not be before from")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+func gormModelAt(t time.Time) gorm.Model {
+	return gorm.Model{CreatedAt: t, UpdatedAt: t}
+}
+
+// seedDreams inserts dreams created one day apart starting at 2025-01-01, with the
+// fourth and fifth sharing a timestamp to exercise the id tie-breaker
+func seedDreams(t *testing.T, ts *testServer) []models.Dream {
+	t.Helper()
+
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	offsets := []int{0, 1, 2, 3, 3, 4}
+	dreams := make([]models.Dream, len(offsets))
+	for i, days := range offsets {
+		dreams[i] = models.Dream{Dream: "dream", Model: gormModelAt(base.AddDate(0, 0, days))}
+		if i%2 == 0 {
+			dreams[i].ImageURL = "/images/x.png"
+		}
+		if err := ts.db.Create(&dreams[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dreams
+}
+
+// listAll follows next_cursor until the last page and returns the ids in order
+func listAll(t *testing.T, ts *testServer, params url.Values) []uint {
+	t.Helper()
+
+	var ids []uint
+	for page := 0; page < 10; page++ {
+		var list dreamListJSON
+		resp := ts.do(http.MethodGet, "/api/dreams?"+params.Encode(), nil, &list)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		for _, d := range list.Dreams {
+			ids = append(ids, d.ID)
+		}
+		if list.NextCursor == "" {
+			return ids
+		}
+		params.Set("cursor", list.NextCursor)
+	}
+	t.Fatal("pagination did not terminate")
+	return nil
+}
+
+func TestListDreamsPagination(t *testing.T) {
+	ts := newTestServer(t)
+	seedDreams(t, ts)
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   []uint
+	}{
+		{"newest first", url.Values{"limit": {"2"}}, []uint{6, 5, 4, 3, 2, 1}},
+		{"oldest first", url.Values{"limit": {"4"}, "order": {"asc"}}, []uint{1, 2, 3, 4, 5, 6}},
+		{"with image", url.Values{"limit": {"1"}, "has_image": {"true"}}, []uint{5, 3, 1}},
+		{"without image", url.Values{"has_image": {"false"}}, []uint{6, 4, 2}},
+		{"date range", url.Values{"from": {"2025-01-02"}, "to": {"2025-01-04"}, "limit": {"1"}}, []uint{5, 4, 3, 2}},
+		{"timestamp range", url.Values{"from": {"2025-01-05T00:00:00Z"}}, []uint{6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := listAll(t, ts, tt.params)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestListDreamsInvalidParameters(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, query := range []string{"limit=0", "limit=1000", "cursor=bogus", "order=sideways", "from=yesterday", "has_image=maybe"} {
+		resp := ts.do(http.MethodGet, "/api/dreams?"+query, nil, nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
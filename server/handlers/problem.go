@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"dreams/models"
+)
+
+// Machine-readable problem codes, stable across changes to the human-readable detail
+const (
+	CodeInvalidID            = "invalid_id"
+	CodeInvalidBody          = "invalid_body"
+	CodeInvalidQuery         = "invalid_query"
+	CodeInvalidImage         = "invalid_image"
+	CodeValidationFailed     = "validation_failed"
+	CodeDreamNotFound        = "dream_not_found"
+	CodeRevisionNotFound     = "revision_not_found"
+	CodeTagNotFound          = "tag_not_found"
+	CodeProvenanceNotFound   = "provenance_not_found"
+	CodeImportNotFound       = "import_not_found"
+	CodeImageNotFound        = "image_not_found"
+	CodeReminderNotFound     = "reminder_not_found"
+	CodeFileTooLarge         = "file_too_large"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePreconditionRequired = "precondition_required"
+	CodeVersionConflict      = "version_conflict"
+	CodeGenerationInProgress = "generation_in_progress"
+	CodeEmbeddingFailed      = "embedding_failed"
+	CodeNotificationFailed   = "notification_failed"
+	CodeNotImplemented       = "not_implemented"
+	CodeInternal             = "internal_error"
+)
+
+// problemContentType is the media type for RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response. Code identifies the kind of problem,
+// so the type is always about:blank and the title is the HTTP status text.
+type Problem struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Code     string                  `json:"code"`
+	Errors   models.ValidationErrors `json:"errors,omitempty"`
+}
+
+func newProblem(r *http.Request, status int, code, detail string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+// writeProblem writes a problem details response
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	encodeProblem(w, newProblem(r, status, code, detail))
+}
+
+// writeValidationError reports field errors as a 422 problem listing every field, or any
+// other error as a 400 invalid body problem
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var errs models.ValidationErrors
+	if !errors.As(err, &errs) {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	}
+
+	problem := newProblem(r, http.StatusUnprocessableEntity, CodeValidationFailed, "Validation failed")
+	problem.Errors = errs
+	encodeProblem(w, problem)
+}
+
+func encodeProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
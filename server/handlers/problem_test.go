@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dreams/models"
+)
+
+func TestProblemResponses(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("A corridor of doors")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+		fields []string
+	}{
+		{"empty dream", http.MethodPost, "/api/dreams", map[string]string{"dream": "  "}, http.StatusUnprocessableEntity, CodeValidationFailed, []string{"dream"}},
+		{"missing dream", http.MethodPost, "/api/dreams", map[string]bool{"lucid": true}, http.StatusUnprocessableEntity, CodeValidationFailed, []string{"dream"}},
+		{"dream too long", http.MethodPost, "/api/dreams", map[string]string{"dream": strings.Repeat("z", models.MaxDreamLength+1)}, http.StatusUnprocessableEntity, CodeValidationFailed, []string{"dream"}},
+		{"server-managed field on create", http.MethodPost, "/api/dreams", map[string]string{"dream": "x", "image_url": "/evil.png"}, http.StatusUnprocessableEntity, CodeValidationFailed, []string{"image_url"}},
+		{"body is not an object", http.MethodPost, "/api/dreams", "[]", http.StatusBadRequest, CodeInvalidBody, nil},
+		{"invalid ID", http.MethodGet, "/api/dreams/abc", nil, http.StatusBadRequest, CodeInvalidID, nil},
+		{"missing dream", http.MethodGet, "/api/dreams/999", nil, http.StatusNotFound, CodeDreamNotFound, nil},
+		{"invalid list query", http.MethodGet, "/api/dreams?limit=0", nil, http.StatusBadRequest, CodeInvalidQuery, nil},
+		{"missing revision", http.MethodGet, fmt.Sprintf("/api/dreams/%d/revisions/9", dream.ID), nil, http.StatusNotFound, CodeRevisionNotFound, nil},
+		{"search without query", http.MethodGet, "/api/dreams/search?q=", nil, http.StatusBadRequest, CodeInvalidQuery, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var problem Problem
+			resp := ts.do(tt.method, tt.path, tt.body, &problem)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != problemContentType {
+				t.Errorf("expected Content-Type %s, got %q", problemContentType, ct)
+			}
+			if problem.Status != tt.status || problem.Code != tt.code || problem.Title != http.StatusText(tt.status) || problem.Instance != strings.Split(tt.path, "?")[0] {
+				t.Errorf("unexpected problem %+v", problem)
+			}
+			var fields []string
+			for _, f := range problem.Errors {
+				fields = append(fields, f.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.fields) {
+				t.Errorf("expected field errors for %v, got %+v", tt.fields, problem.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dreams/models"
+	"dreams/services"
+)
+
+type ReminderHandler struct {
+	reminders *services.ReminderService
+}
+
+func NewReminderHandler(reminders *services.ReminderService) *ReminderHandler {
+	return &ReminderHandler{
+		reminders: reminders,
+	}
+}
+
+func (h *ReminderHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/reminders", h.HandleListReminders)
+	http.HandleFunc("POST /api/reminders", h.HandleCreateReminder)
+	http.HandleFunc("GET /api/reminders/push-key", h.HandlePushKey)
+	http.HandleFunc("GET /api/reminders/{id}", h.HandleGetReminder)
+	http.HandleFunc("PUT /api/reminders/{id}", h.HandleUpdateReminder)
+	http.HandleFunc("DELETE /api/reminders/{id}", h.HandleDeleteReminder)
+	http.HandleFunc("POST /api/reminders/{id}/test", h.HandleTestReminder)
+}
+
+// reminderRequest is the body of POST and PUT. Reminders are enabled unless the request
+// says otherwise.
+type reminderRequest struct {
+	TimeOfDay    string                   `json:"time_of_day"`
+	TimeZone     string                   `json:"time_zone"`
+	Weekdays     models.Weekdays          `json:"weekdays"`
+	Channel      string                   `json:"channel"`
+	Target       string                   `json:"target"`
+	Subscription *models.PushSubscription `json:"subscription"`
+	Enabled      *bool                    `json:"enabled"`
+}
+
+// decodeReminder reads a reminder from the request body, writing an error if it can't
+func decodeReminder(w http.ResponseWriter, r *http.Request) (models.Reminder, bool) {
+	var req reminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return models.Reminder{}, false
+	}
+	reminder := models.Reminder{
+		TimeOfDay:    req.TimeOfDay,
+		TimeZone:     req.TimeZone,
+		Weekdays:     req.Weekdays,
+		Channel:      req.Channel,
+		Target:       req.Target,
+		Subscription: req.Subscription,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+	}
+	return reminder, true
+}
+
+// reminderID parses the id path value, writing an error if it isn't valid
+func reminderID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid reminder ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeReminderError writes the problem for an error from the reminder service
+func writeReminderError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	var validation models.ValidationErrors
+	switch {
+	case errors.As(err, &validation):
+		writeValidationError(w, r, err)
+	case errors.Is(err, services.ErrReminderNotFound):
+		writeProblem(w, r, http.StatusNotFound, CodeReminderNotFound, "Reminder not found")
+	case errors.Is(err, services.ErrNotificationFailed):
+		// The error can quote the target's response, which mustn't be reflected to clients
+		log.Printf("Error sending reminder: %v", err)
+		writeProblem(w, r, http.StatusBadGateway, CodeNotificationFailed, "The reminder could not be delivered, check its target")
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to "+action)
+	}
+}
+
+func writeReminder(w http.ResponseWriter, status int, reminder interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(reminder); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (h *ReminderHandler) HandleListReminders(w http.ResponseWriter, r *http.Request) {
+	reminders, err := h.reminders.List(r.Context())
+	if err != nil {
+		writeReminderError(w, r, err, "list reminders")
+		return
+	}
+	writeReminder(w, http.StatusOK, reminders)
+}
+
+// HandleCreateReminder schedules a reminder, such as
+// {"time_of_day": "07:00", "time_zone": "Europe/London", "weekdays": ["mon", "tue"],
+// "channel": "email", "target": "me@example.com"}
+func (h *ReminderHandler) HandleCreateReminder(w http.ResponseWriter, r *http.Request) {
+	reminder, ok := decodeReminder(w, r)
+	if !ok {
+		return
+	}
+	if err := h.reminders.Create(r.Context(), &reminder); err != nil {
+		writeReminderError(w, r, err, "create reminder")
+		return
+	}
+	writeReminder(w, http.StatusCreated, reminder)
+}
+
+func (h *ReminderHandler) HandleGetReminder(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderID(w, r)
+	if !ok {
+		return
+	}
+	reminder, err := h.reminders.Get(r.Context(), id)
+	if err != nil {
+		writeReminderError(w, r, err, "find reminder")
+		return
+	}
+	writeReminder(w, http.StatusOK, reminder)
+}
+
+// HandleUpdateReminder replaces a reminder's schedule and channel
+func (h *ReminderHandler) HandleUpdateReminder(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderID(w, r)
+	if !ok {
+		return
+	}
+	reminder, ok := decodeReminder(w, r)
+	if !ok {
+		return
+	}
+	reminder.ID = id
+	if err := h.reminders.Update(r.Context(), &reminder); err != nil {
+		writeReminderError(w, r, err, "update reminder")
+		return
+	}
+	writeReminder(w, http.StatusOK, reminder)
+}
+
+func (h *ReminderHandler) HandleDeleteReminder(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.reminders.Delete(r.Context(), id); err != nil {
+		writeReminderError(w, r, err, "delete reminder")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTestReminder sends a reminder straight away so its channel can be checked
+func (h *ReminderHandler) HandleTestReminder(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.reminders.Send(r.Context(), id); err != nil {
+		writeReminderError(w, r, err, "send reminder")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePushKey returns the VAPID public key the webapp subscribes to Web Push with
+func (h *ReminderHandler) HandlePushKey(w http.ResponseWriter, r *http.Request) {
+	key := h.reminders.PushPublicKey()
+	if key == "" {
+		writeProblem(w, r, http.StatusNotImplemented, CodeNotImplemented, "Web Push reminders are not configured on this server")
+		return
+	}
+	writeReminder(w, http.StatusOK, map[string]string{"public_key": key})
+}
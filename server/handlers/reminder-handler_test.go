@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dreams/models"
+)
+
+func TestReminders(t *testing.T) {
+	ts := newTestServer(t)
+	hooks := 0
+	status := http.StatusOK
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hooks++
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			io.WriteString(w, "internal admin console")
+		}
+	}))
+	defer hook.Close()
+
+	var reminder models.Reminder
+	resp := ts.do(http.MethodPost, "/api/reminders", map[string]interface{}{
+		"time_of_day": "07:00",
+		"time_zone":   "Europe/London",
+		"weekdays":    []string{"mon", "tue"},
+		"channel":     "webhook",
+		"target":      hook.URL,
+	}, &reminder)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	if reminder.ID == 0 || !reminder.Enabled || len(reminder.Weekdays) != 2 {
+		t.Errorf("unexpected reminder %+v", reminder)
+	}
+	path := fmt.Sprintf("/api/reminders/%d", reminder.ID)
+
+	resp = ts.do(http.MethodPut, path, map[string]interface{}{
+		"time_of_day": "06:30",
+		"time_zone":   "Europe/London",
+		"weekdays":    []string{"sat", "sun"},
+		"channel":     "webhook",
+		"target":      hook.URL,
+		"enabled":     false,
+	}, &reminder)
+	if resp.StatusCode != http.StatusOK || reminder.TimeOfDay != "06:30" || reminder.Enabled {
+		t.Errorf("expected the reminder to be updated, got %d %+v", resp.StatusCode, reminder)
+	}
+
+	var reminders []models.Reminder
+	ts.do(http.MethodGet, "/api/reminders", nil, &reminders)
+	if len(reminders) != 1 || reminders[0].TimeOfDay != "06:30" {
+		t.Errorf("unexpected reminders %+v", reminders)
+	}
+
+	if resp := ts.do(http.MethodPost, path+"/test", nil, nil); resp.StatusCode != http.StatusNoContent || hooks != 1 {
+		t.Errorf("expected a test webhook, got %d with %d hooks", resp.StatusCode, hooks)
+	}
+	status = http.StatusInternalServerError
+	var problem Problem
+	if resp := ts.do(http.MethodPost, path+"/test", nil, &problem); resp.StatusCode != http.StatusBadGateway || problem.Code != CodeNotificationFailed {
+		t.Errorf("expected a failed test webhook, got %d %+v", resp.StatusCode, problem)
+	}
+	if strings.Contains(problem.Detail, "admin console") {
+		t.Errorf("expected the webhook's response to stay private, got %q", problem.Detail)
+	}
+
+	if resp := ts.do(http.MethodDelete, path, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", resp.StatusCode)
+	}
+	if resp := ts.do(http.MethodGet, path, nil, &problem); resp.StatusCode != http.StatusNotFound || problem.Code != CodeReminderNotFound {
+		t.Errorf("expected 404, got %d %+v", resp.StatusCode, problem)
+	}
+}
+
+func TestReminderErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	for name, tc := range map[string]struct {
+		method, path string
+		body         interface{}
+		want         int
+	}{
+		"invalid time": {http.MethodPost, "/api/reminders", map[string]interface{}{"time_of_day": "25:00", "time_zone": "UTC", "weekdays": []string{"mon"}, "channel": "webhook", "target": "http://example.com"}, http.StatusUnprocessableEntity},
+		"no email":     {http.MethodPost, "/api/reminders", map[string]interface{}{"time_of_day": "07:00", "time_zone": "UTC", "weekdays": []string{"mon"}, "channel": "email", "target": "me@example.com"}, http.StatusUnprocessableEntity},
+		"bad body":     {http.MethodPost, "/api/reminders", "not a reminder", http.StatusBadRequest},
+		"bad id":       {http.MethodGet, "/api/reminders/abc", nil, http.StatusBadRequest},
+		"missing":      {http.MethodPut, "/api/reminders/999", map[string]interface{}{"time_of_day": "07:00", "time_zone": "UTC", "weekdays": []string{"mon"}, "channel": "webhook", "target": "http://example.com"}, http.StatusNotFound},
+		"no push":      {http.MethodGet, "/api/reminders/push-key", nil, http.StatusNotImplemented},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var problem Problem
+			if resp := ts.do(tc.method, tc.path, tc.body, &problem); resp.StatusCode != tc.want {
+				t.Errorf("expected %d, got %d %+v", tc.want, resp.StatusCode, problem)
+			}
+		})
+	}
+}
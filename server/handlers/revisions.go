@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services"
+)
+
+// DreamRevisionDiff is a word-level diff between two revisions of a dream
+type DreamRevisionDiff struct {
+	DreamID uint              `json:"dream_id"`
+	From    uint              `json:"from"`
+	To      uint              `json:"to"`
+	Changes []services.DiffOp `json:"changes"`
+}
+
+// HandleListRevisions lists the stored revisions of a dream, newest first
+func (h *DreamHandler) HandleListRevisions(w http.ResponseWriter, r *http.Request) {
+	dream, ok := h.findDream(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.dreams.Revisions(r.Context(), dream.ID)
+	if err != nil {
+		log.Printf("Error fetching revisions for dream %d: %v", dream.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch revisions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revisions); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandleGetRevision returns the dream text at one version
+func (h *DreamHandler) HandleGetRevision(w http.ResponseWriter, r *http.Request) {
+	dream, ok := h.findDream(w, r)
+	if !ok {
+		return
+	}
+	revision, ok := h.findRevision(w, r, dream.ID, r.PathValue("version"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revision); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandleDiffRevisions compares the revisions given by the from and to versions word by word.
+// to defaults to the latest revision.
+func (h *DreamHandler) HandleDiffRevisions(w http.ResponseWriter, r *http.Request) {
+	dream, ok := h.findDream(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "from is required")
+		return
+	}
+	from, ok := h.findRevision(w, r, dream.ID, query.Get("from"))
+	if !ok {
+		return
+	}
+	to, ok := h.findRevision(w, r, dream.ID, query.Get("to"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(DreamRevisionDiff{
+		DreamID: dream.ID,
+		From:    from.Version,
+		To:      to.Version,
+		Changes: services.DiffWords(from.Dream, to.Dream),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandleRestoreRevision makes the text of an older revision current again. Like any other
+// edit it needs If-Match and creates a new revision, so the restore itself can be undone.
+func (h *DreamHandler) HandleRestoreRevision(w http.ResponseWriter, r *http.Request) {
+	dream, ok := h.findDream(w, r)
+	if !ok {
+		return
+	}
+	revision, ok := h.findRevision(w, r, dream.ID, r.PathValue("version"))
+	if !ok {
+		return
+	}
+
+	h.updateDream(w, r, func(existing models.Dream) (DreamUpdate, error) {
+		update := newDreamUpdate(existing)
+		update.Dream = revision.Dream
+		return update, nil
+	})
+}
+
+// findRevision loads one revision of a dream, or the latest when versionStr is empty,
+// writing an error if it can't
+func (h *DreamHandler) findRevision(w http.ResponseWriter, r *http.Request, dreamID uint, versionStr string) (models.DreamRevision, bool) {
+	var version uint64
+	if versionStr != "" {
+		var err error
+		if version, err = strconv.ParseUint(versionStr, 10, 32); err != nil || version == 0 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid revision version")
+			return models.DreamRevision{}, false
+		}
+	}
+
+	revision, err := h.dreams.Revision(r.Context(), dreamID, uint(version))
+	if err != nil {
+		if err == repositories.ErrNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeRevisionNotFound, "Revision not found")
+		} else {
+			log.Printf("Error finding revision: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find revision")
+		}
+		return revision, false
+	}
+	return revision, true
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dreams/models"
+	"dreams/services"
+)
+
+func TestDreamRevisions(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("A red door in the forest")
+	path := fmt.Sprintf("/api/dreams/%d", dream.ID)
+
+	ts.do(http.MethodPatch, path, map[string]string{"dream": "A blue door in the forest"}, nil)
+	// Metadata-only edits don't add a revision
+	ts.do(http.MethodPatch, path, map[string]bool{"lucid": true}, nil)
+	ts.do(http.MethodPatch, path, map[string]string{"dream": "A blue door in the dark forest"}, nil)
+
+	var revisions []models.DreamRevision
+	resp := ts.do(http.MethodGet, path+"/revisions", nil, &revisions)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 listing revisions, got %d", resp.StatusCode)
+	}
+	var versions []uint
+	for _, revision := range revisions {
+		versions = append(versions, revision.Version)
+	}
+	if fmt.Sprint(versions) != "[4 2 1]" {
+		t.Fatalf("expected revisions [4 2 1], got %v", versions)
+	}
+
+	var first models.DreamRevision
+	resp = ts.do(http.MethodGet, path+"/revisions/1", nil, &first)
+	if resp.StatusCode != http.StatusOK || first.Dream != "A red door in the forest" {
+		t.Fatalf("expected the original text, got %d %+v", resp.StatusCode, first)
+	}
+
+	var diff DreamRevisionDiff
+	resp = ts.do(http.MethodGet, path+"/revisions/diff?from=1", nil, &diff)
+	if resp.StatusCode != http.StatusOK || diff.From != 1 || diff.To != 4 {
+		t.Fatalf("expected diff from 1 to 4, got %d %+v", resp.StatusCode, diff)
+	}
+	want := []services.DiffOp{
+		{Type: services.DiffEqual, Text: "A "},
+		{Type: services.DiffDelete, Text: "red"},
+		{Type: services.DiffInsert, Text: "blue"},
+		{Type: services.DiffEqual, Text: " door in the"},
+		{Type: services.DiffInsert, Text: " dark"},
+		{Type: services.DiffEqual, Text: " forest"},
+	}
+	if fmt.Sprint(diff.Changes) != fmt.Sprint(want) {
+		t.Errorf("unexpected diff %v", diff.Changes)
+	}
+
+	// Restoring is an edit, so it needs the current ETag and adds a revision
+	resp = ts.do(http.MethodPost, path+"/revisions/1/restore", nil, nil)
+	if resp.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 restoring without If-Match, got %d", resp.StatusCode)
+	}
+	resp = ts.request(http.MethodPost, path+"/revisions/1/restore", map[string]string{"If-Match": `"2"`}, nil, nil)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 restoring with a stale ETag, got %d", resp.StatusCode)
+	}
+
+	var restored dreamJSON
+	resp = ts.request(http.MethodPost, path+"/revisions/1/restore", map[string]string{"If-Match": `"4"`}, nil, &restored)
+	if resp.StatusCode != http.StatusOK || restored.Dream != "A red door in the forest" || restored.Version != 5 || !restored.Lucid {
+		t.Fatalf("expected restored text at version 5 keeping metadata, got %d %+v", resp.StatusCode, restored)
+	}
+	ts.do(http.MethodGet, path+"/revisions", nil, &revisions)
+	if len(revisions) != 4 || revisions[0].Version != 5 {
+		t.Errorf("expected the restore to add revision 5, got %+v", revisions)
+	}
+}
+
+func TestDreamRevisionErrors(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("Falling")
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"missing dream", "/api/dreams/999/revisions", http.StatusNotFound},
+		{"invalid version", fmt.Sprintf("/api/dreams/%d/revisions/abc", dream.ID), http.StatusBadRequest},
+		{"missing revision", fmt.Sprintf("/api/dreams/%d/revisions/7", dream.ID), http.StatusNotFound},
+		{"diff without from", fmt.Sprintf("/api/dreams/%d/revisions/diff", dream.ID), http.StatusBadRequest},
+		{"diff with missing revision", fmt.Sprintf("/api/dreams/%d/revisions/diff?from=1&to=7", dream.ID), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.do(http.MethodGet, tt.path, nil, nil)
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
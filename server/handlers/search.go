@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"dreams/repositories"
+)
+
+const maxSearchQueryLength = 500
+
+// DreamSearchResponse is the response for the search endpoint
+type DreamSearchResponse struct {
+	Results    []repositories.DreamSearchResult `json:"results"`
+	NextOffset int                              `json:"next_offset,omitempty"`
+}
+
+type dreamSearchQuery struct {
+	Text   string
+	Limit  int
+	Offset int
+}
+
+// parseDreamSearchQuery reads q, limit and offset from the query string
+func parseDreamSearchQuery(values url.Values) (dreamSearchQuery, error) {
+	query := dreamSearchQuery{
+		Text:  strings.TrimSpace(values.Get("q")),
+		Limit: defaultPageSize,
+	}
+	if query.Text == "" {
+		return query, fmt.Errorf("q is required")
+	}
+	if len(query.Text) > maxSearchQueryLength {
+		return query, fmt.Errorf("q must be at most %d characters", maxSearchQueryLength)
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		query.Limit = limit
+	}
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return query, fmt.Errorf("offset must be a non-negative integer")
+		}
+		query.Offset = offset
+	}
+
+	return query, nil
+}
+
+// HandleSearch runs a ranked full-text search over dream text.
+// Dreams are not owned by users yet, so like the list endpoint this searches every dream.
+func (h *DreamHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	query, err := parseDreamSearchQuery(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, err.Error())
+		return
+	}
+
+	results, err := h.dreams.Search(r.Context(), query.Text, query.Limit, query.Offset)
+	if err == repositories.ErrSearchUnsupported {
+		writeProblem(w, r, http.StatusNotImplemented, CodeNotImplemented, "Search is not supported by this database")
+		return
+	}
+	if err != nil {
+		log.Printf("Error searching dreams: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to search dreams")
+		return
+	}
+
+	response := DreamSearchResponse{Results: results}
+	if len(results) > query.Limit {
+		response.Results = results[:query.Limit]
+		response.NextOffset = query.Offset + query.Limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
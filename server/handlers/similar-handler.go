@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"dreams/repositories"
+	"dreams/services"
+)
+
+const defaultSimilarLimit = 5
+
+type SimilarHandler struct {
+	similarity *services.SimilarityService
+}
+
+func NewSimilarHandler(similarity *services.SimilarityService) *SimilarHandler {
+	return &SimilarHandler{
+		similarity: similarity,
+	}
+}
+
+func (h *SimilarHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/dreams/{id}/similar", h.HandleSimilar)
+}
+
+// HandleSimilar lists the dreams most like the given one, most similar first. The
+// optional limit parameter sets how many, five by default.
+func (h *SimilarHandler) HandleSimilar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
+		return
+	}
+	limit := defaultSimilarLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	similar, err := h.similarity.Similar(r.Context(), uint(id), limit)
+	if err == repositories.ErrNotFound {
+		writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		return
+	}
+	if errors.Is(err, services.ErrEmbeddingFailed) {
+		log.Printf("Error embedding dream: %v", err)
+		writeProblem(w, r, http.StatusBadGateway, CodeEmbeddingFailed, "The embedding model is unavailable")
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding similar dreams: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find similar dreams")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(similar); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
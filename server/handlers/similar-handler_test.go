@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dreams/services"
+)
+
+func TestSimilarDreams(t *testing.T) {
+	ts := newTestServer(t)
+	lighthouse := ts.createDream("A lighthouse on a cliff, its light sweeping over the waves")
+	related := ts.createDream("I climbed the lighthouse stairs while waves hit the cliff")
+	ts.createDream("Shopping for shoes in a crowded mall")
+	if _, err := ts.similar.IndexStale(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	var similar []services.SimilarDream
+	resp := ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d/similar", lighthouse.ID), nil, &similar)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(similar) != 1 || similar[0].Dream.ID != related.ID {
+		t.Errorf("expected only the other lighthouse dream, got %+v", similar)
+	}
+
+	for path, want := range map[string]int{
+		"/api/dreams/abc/similar":                                 http.StatusBadRequest,
+		"/api/dreams/999/similar":                                 http.StatusNotFound,
+		fmt.Sprintf("/api/dreams/%d/similar?limit=0", related.ID): http.StatusBadRequest,
+	} {
+		var problem Problem
+		if resp := ts.do(http.MethodGet, path, nil, &problem); resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d %+v", path, want, resp.StatusCode, problem)
+		}
+	}
+}
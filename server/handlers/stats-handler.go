@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"dreams/services"
+)
+
+type StatsHandler struct {
+	stats *services.StatsService
+}
+
+func NewStatsHandler(stats *services.StatsService) *StatsHandler {
+	return &StatsHandler{
+		stats: stats,
+	}
+}
+
+func (h *StatsHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/stats", h.HandleStats)
+}
+
+// HandleStats returns journal statistics for the dreams between the optional from and to
+// dates (YYYY-MM-DD, inclusive), placing each dream on the night it happened
+func (h *StatsHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, err.Error())
+		return
+	}
+
+	stats, err := h.stats.Stats(r.Context(), services.StatsRange{From: from, To: to})
+	if err != nil {
+		log.Printf("Error computing stats: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to compute stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
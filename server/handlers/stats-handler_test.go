@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dreams/services"
+)
+
+func TestStats(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createDream("Flying over the harbour")
+	lucid := ts.createDream("Flying again, and I knew it was a dream")
+	ts.do(http.MethodPatch, fmt.Sprintf("/api/dreams/%d", lucid.ID), map[string]interface{}{"lucid": true}, nil)
+
+	var stats services.DreamStats
+	resp := ts.do(http.MethodGet, "/api/stats", nil, &stats)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if stats.TotalDreams != 2 || stats.LucidRatio != 0.5 || stats.CurrentStreak != 1 || len(stats.PerMonth) != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(stats.TopWords) == 0 || stats.TopWords[0].Word != "flying" {
+		t.Errorf("unexpected top words %v", stats.TopWords)
+	}
+
+	resp = ts.do(http.MethodGet, "/api/stats?from=2000-01-01&to=2000-12-31", nil, &stats)
+	if resp.StatusCode != http.StatusOK || stats.TotalDreams != 0 || stats.PerWeek == nil {
+		t.Errorf("expected empty stats, got %d %+v", resp.StatusCode, stats)
+	}
+
+	for _, query := range []string{"from=yesterday", "from=2024-02-01&to=2024-01-01"} {
+		var problem Problem
+		resp := ts.do(http.MethodGet, "/api/stats?"+query, nil, &problem)
+		if resp.StatusCode != http.StatusBadRequest || problem.Code != CodeInvalidQuery {
+			t.Errorf("%s: expected 400 invalid_query, got %d %+v", query, resp.StatusCode, problem)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dreams/database"
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTagLimit = 50
+	maxTagsPerDream = 30
+)
+
+type TagHandler struct {
+	db *gorm.DB
+}
+
+func NewTagHandler(db *gorm.DB) *TagHandler {
+	return &TagHandler{
+		db: db,
+	}
+}
+
+func (h *TagHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/tags", h.HandleListTags)
+	http.HandleFunc("POST /api/dreams/{id}/tags", h.HandleAddTags)
+	http.HandleFunc("DELETE /api/dreams/{id}/tags/{tag}", h.HandleRemoveTag)
+}
+
+// HandleListTags lists tags with the number of dreams using them, most used first.
+// The optional prefix parameter narrows the list for autocomplete.
+func (h *TagHandler) HandleListTags(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTagLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	query := h.db.Table("tags").
+		Select("tags.id, tags.name, COUNT(dreams.id) AS count").
+		Joins("LEFT JOIN dream_tags ON dream_tags.tag_id = tags.id").
+		Joins("LEFT JOIN dreams ON dreams.id = dream_tags.dream_id AND dreams.deleted_at IS NULL").
+		Group("tags.id, tags.name").
+		Order("count DESC, tags.name ASC").
+		Limit(limit)
+
+	if prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix"))); prefix != "" {
+		query = query.Where(`tags.name LIKE ? ESCAPE '\'`, database.EscapeLike(prefix)+"%")
+	}
+
+	tags := []models.TagCount{}
+	if err := query.Scan(&tags).Error; err != nil {
+		log.Printf("Error fetching tags: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// AddTagsRequest is the request body for adding tags to a dream
+type AddTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// HandleAddTags adds tags to a dream, creating any that don't exist yet, and returns the dream
+func (h *TagHandler) HandleAddTags(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
+		return
+	}
+
+	var req AddTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if len(req.Tags) == 0 || len(req.Tags) > maxTagsPerDream {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Provide between 1 and "+strconv.Itoa(maxTagsPerDream)+" tags")
+		return
+	}
+
+	names := make([]string, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		name, err := models.NormalizeTagName(tag)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+			return
+		}
+		names = append(names, name)
+	}
+
+	var dream models.Dream
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&dream, id).Error; err != nil {
+			return err
+		}
+
+		tags := make([]models.Tag, len(names))
+		for i, name := range names {
+			if err := tx.Where(models.Tag{Name: name}).FirstOrCreate(&tags[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&dream).Association("Tags").Append(tags)
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		} else {
+			log.Printf("Error adding tags to dream %d: %v", id, err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to add tags")
+		}
+		return
+	}
+
+	h.writeDreamWithTags(w, r, uint(id))
+}
+
+// HandleRemoveTag removes a tag from a dream. The tag itself is kept for other dreams.
+func (h *TagHandler) HandleRemoveTag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
+		return
+	}
+	name, err := models.NormalizeTagName(r.PathValue("tag"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, err.Error())
+		return
+	}
+
+	var dream models.Dream
+	if err := h.db.First(&dream, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found")
+		} else {
+			log.Printf("Error finding dream: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
+		}
+		return
+	}
+
+	var tag models.Tag
+	if err := h.db.Where("name = ?", name).First(&tag).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeTagNotFound, "Tag not found")
+		} else {
+			log.Printf("Error finding tag: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find tag")
+		}
+		return
+	}
+
+	if err := h.db.Model(&dream).Association("Tags").Delete(&tag); err != nil {
+		log.Printf("Error removing tag from dream %d: %v", id, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to remove tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TagHandler) writeDreamWithTags(w http.ResponseWriter, r *http.Request, id uint) {
+	var dream models.Dream
+	if err := h.db.Preload("Tags").First(&dream, id).Error; err != nil {
+		log.Printf("Error reloading dream %d: %v", id, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", dreamETag(dream))
+	if err := json.NewEncoder(w).Encode(dream); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"dreams/models"
+)
+
+func (ts *testServer) addTags(id uint, tags ...string) dreamJSON {
+	ts.t.Helper()
+
+	var dream dreamJSON
+	resp := ts.do(http.MethodPost, fmt.Sprintf("/api/dreams/%d/tags", id), AddTagsRequest{Tags: tags}, &dream)
+	if resp.StatusCode != http.StatusOK {
+		ts.t.Fatalf("expected 200 adding tags, got %d", resp.StatusCode)
+	}
+	return dream
+}
+
+func TestDreamTags(t *testing.T) {
+	ts := newTestServer(t)
+	flying := ts.createDream("Flying over the sea")
+	school := ts.createDream("Back at school, flying")
+	teeth := ts.createDream("Teeth falling out")
+
+	dream := ts.addTags(flying.ID, "Flying", "water ", "flying")
+	if len(dream.Tags) != 2 {
+		t.Fatalf("expected 2 normalised tags, got %+v", dream.Tags)
+	}
+	ts.addTags(school.ID, "flying", "school")
+	ts.addTags(teeth.ID, "teeth")
+
+	var counts []models.TagCount
+	ts.do(http.MethodGet, "/api/tags", nil, &counts)
+	if len(counts) != 4 || counts[0].Name != "flying" || counts[0].Count != 2 {
+		t.Fatalf("expected flying to be the most used tag, got %+v", counts)
+	}
+
+	var suggestions []models.TagCount
+	ts.do(http.MethodGet, "/api/tags?prefix=Sc", nil, &suggestions)
+	if len(suggestions) != 1 || suggestions[0].Name != "school" {
+		t.Errorf("expected autocomplete to suggest school, got %+v", suggestions)
+	}
+	ts.do(http.MethodGet, "/api/tags?prefix=%25", nil, &suggestions)
+	if len(suggestions) != 0 {
+		t.Errorf("expected LIKE wildcards to be escaped, got %+v", suggestions)
+	}
+
+	listIDs := func(params url.Values) []uint {
+		var list dreamListJSON
+		ts.do(http.MethodGet, "/api/dreams?"+params.Encode(), nil, &list)
+		ids := make([]uint, 0, len(list.Dreams))
+		for _, d := range list.Dreams {
+			ids = append(ids, d.ID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+	if got := listIDs(url.Values{"tags": {"flying,water"}}); fmt.Sprint(got) != fmt.Sprint([]uint{flying.ID}) {
+		t.Errorf("AND filter: expected [%d], got %v", flying.ID, got)
+	}
+	if got := listIDs(url.Values{"tags": {"water", "teeth"}, "tag_mode": {"or"}}); fmt.Sprint(got) != fmt.Sprint([]uint{flying.ID, teeth.ID}) {
+		t.Errorf("OR filter: expected [%d %d], got %v", flying.ID, teeth.ID, got)
+	}
+
+	resp := ts.do(http.MethodDelete, fmt.Sprintf("/api/dreams/%d/tags/water", flying.ID), nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 removing tag, got %d", resp.StatusCode)
+	}
+	var fetched dreamJSON
+	ts.do(http.MethodGet, fmt.Sprintf("/api/dreams/%d", flying.ID), nil, &fetched)
+	if len(fetched.Tags) != 1 || fetched.Tags[0].Name != "flying" {
+		t.Errorf("expected only flying to remain, got %+v", fetched.Tags)
+	}
+}
+
+func TestDreamTagErrors(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("A dream")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"no tags", http.MethodPost, fmt.Sprintf("/api/dreams/%d/tags", dream.ID), AddTagsRequest{}, http.StatusBadRequest},
+		{"blank tag", http.MethodPost, fmt.Sprintf("/api/dreams/%d/tags", dream.ID), AddTagsRequest{Tags: []string{" "}}, http.StatusBadRequest},
+		{"missing dream", http.MethodPost, "/api/dreams/999/tags", AddTagsRequest{Tags: []string{"x"}}, http.StatusNotFound},
+		{"remove unknown tag", http.MethodDelete, fmt.Sprintf("/api/dreams/%d/tags/nope", dream.ID), nil, http.StatusNotFound},
+		{"invalid tag mode", http.MethodGet, "/api/dreams?tags=x&tag_mode=xor", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := ts.do(tt.method, tt.path, tt.body, nil); resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dreams/models"
+	"dreams/services"
+
+	"gorm.io/gorm"
+)
+
+type TrashHandler struct {
+	db    *gorm.DB
+	trash *services.TrashService
+}
+
+func NewTrashHandler(db *gorm.DB, trash *services.TrashService) *TrashHandler {
+	return &TrashHandler{
+		db:    db,
+		trash: trash,
+	}
+}
+
+func (h *TrashHandler) RegisterRoutes() {
+	http.HandleFunc("GET /api/trash", h.HandleListTrash)
+	http.HandleFunc("POST /api/dreams/{id}/restore", h.HandleRestore)
+	http.HandleFunc("DELETE /api/trash/{id}", h.HandlePurge)
+}
+
+// TrashedDream is a deleted dream with when it will be purged
+type TrashedDream struct {
+	Dream     models.Dream `json:"dream"`
+	DeletedAt time.Time    `json:"deleted_at"`
+	// PurgeAt is omitted when deleted dreams are kept until purged by hand
+	PurgeAt *time.Time `json:"purge_at,omitempty"`
+}
+
+// HandleListTrash lists deleted dreams, most recently deleted first
+func (h *TrashHandler) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	var dreams []models.Dream
+	if err := h.db.Unscoped().Preload("Tags").
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC, id DESC").
+		Find(&dreams).Error; err != nil {
+		log.Printf("Error fetching trash: %v", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch trash")
+		return
+	}
+
+	trashed := make([]TrashedDream, 0, len(dreams))
+	for _, dream := range dreams {
+		item := TrashedDream{Dream: dream, DeletedAt: dream.DeletedAt.Time.UTC()}
+		if retention := h.trash.Retention(); retention > 0 {
+			purgeAt := item.DeletedAt.Add(retention)
+			item.PurgeAt = &purgeAt
+		}
+		trashed = append(trashed, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(trashed); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandleRestore moves a dream out of the trash
+func (h *TrashHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	dream, ok := h.findTrashedDream(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Unscoped().Model(&dream).Update("deleted_at", nil).Error; err != nil {
+		log.Printf("Error restoring dream %d: %v", dream.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to restore dream")
+		return
+	}
+
+	if err := h.db.Preload("Tags").First(&dream, dream.ID).Error; err != nil {
+		log.Printf("Error reloading dream %d: %v", dream.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", dreamETag(dream))
+	if err := json.NewEncoder(w).Encode(dream); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// HandlePurge permanently deletes a dream in the trash, including its images
+func (h *TrashHandler) HandlePurge(w http.ResponseWriter, r *http.Request) {
+	dream, ok := h.findTrashedDream(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.trash.Purge(r.Context(), dream); err != nil {
+		log.Printf("Error purging dream %d: %v", dream.ID, err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete dream")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findTrashedDream loads the deleted dream named by the id path value, writing an error if it can't
+func (h *TrashHandler) findTrashedDream(w http.ResponseWriter, r *http.Request) (models.Dream, bool) {
+	var dream models.Dream
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid dream ID")
+		return dream, false
+	}
+
+	if err := h.db.Unscoped().Where("deleted_at IS NOT NULL").First(&dream, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			writeProblem(w, r, http.StatusNotFound, CodeDreamNotFound, "Dream not found in trash")
+		} else {
+			log.Printf("Error finding dream: %v", err)
+			writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "Failed to find dream")
+		}
+		return dream, false
+	}
+	return dream, true
+}
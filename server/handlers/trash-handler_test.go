@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type trashedDreamJSON struct {
+	Dream     dreamJSON `json:"dream"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+func TestTrash(t *testing.T) {
+	ts := newTestServer(t)
+	dream := ts.createDream("A lighthouse in the desert")
+	ts.createDream("Still here")
+	path := fmt.Sprintf("/api/dreams/%d", dream.ID)
+
+	ts.do(http.MethodPost, path+"/tags", AddTagsRequest{Tags: []string{"lighthouse"}}, nil)
+	ts.do(http.MethodPost, path+"/generate-image", nil, nil)
+	ts.waitForImage(dream.ID)
+	if len(ts.storage.Keys()) == 0 {
+		t.Fatal("expected the generated image in storage")
+	}
+
+	resp := ts.do(http.MethodPost, path+"/restore", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 restoring a dream that isn't in the trash, got %d", resp.StatusCode)
+	}
+
+	ts.do(http.MethodDelete, path, nil, nil)
+	var trash []trashedDreamJSON
+	resp = ts.do(http.MethodGet, "/api/trash", nil, &trash)
+	if resp.StatusCode != http.StatusOK || len(trash) != 1 || trash[0].Dream.ID != dream.ID {
+		t.Fatalf("expected the deleted dream in the trash, got %d %+v", resp.StatusCode, trash)
+	}
+	if want := trash[0].DeletedAt.Add(30 * 24 * time.Hour); !trash[0].PurgeAt.Equal(want) {
+		t.Errorf("expected purge_at %v, got %v", want, trash[0].PurgeAt)
+	}
+
+	var restored dreamJSON
+	resp = ts.do(http.MethodPost, path+"/restore", nil, &restored)
+	if resp.StatusCode != http.StatusOK || restored.ID != dream.ID || len(restored.Tags) != 1 {
+		t.Fatalf("expected the restored dream with its tags, got %d %+v", resp.StatusCode, restored)
+	}
+	ts.do(http.MethodGet, "/api/trash", nil, &trash)
+	if len(trash) != 0 {
+		t.Errorf("expected an empty trash after restoring, got %+v", trash)
+	}
+
+	resp = ts.do(http.MethodDelete, fmt.Sprintf("/api/trash/%d", dream.ID), nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 purging a dream that isn't in the trash, got %d", resp.StatusCode)
+	}
+
+	ts.do(http.MethodDelete, path, nil, nil)
+	resp = ts.do(http.MethodDelete, fmt.Sprintf("/api/trash/%d", dream.ID), nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 purging the dream, got %d", resp.StatusCode)
+	}
+	if keys := ts.storage.Keys(); len(keys) != 0 {
+		t.Errorf("expected the images to be deleted, got %v", keys)
+	}
+	var count int64
+	ts.db.Unscoped().Table("dreams").Where("id = ?", dream.ID).Count(&count)
+	if count != 0 {
+		t.Error("expected the dream to be permanently deleted")
+	}
+	ts.db.Table("dream_tags").Where("dream_id = ?", dream.ID).Count(&count)
+	if count != 0 {
+		t.Error("expected the dream's tag links to be deleted")
+	}
+}
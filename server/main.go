@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
+	// Reminder time zones must load even where the system has no zoneinfo
+	_ "time/tzdata"
 
+	"dreams/database"
 	"dreams/handlers"
+	"dreams/migrations"
 	"dreams/models"
+	"dreams/repositories"
 	"dreams/services"
 	"dreams/services/storage"
 
 	"github.com/rs/cors"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -24,6 +31,14 @@ type Config struct {
 	AIEndpoint  string
 	AIModelName string
 
+	// LLMApiHost serves the language model used to analyze dreams, which is disabled when
+	// LLMModelName is empty
+	LLMApiHost   string
+	LLMModelName string
+	// EmbeddingModelName is the Ollama model used to find similar dreams, or empty for the
+	// built-in hashing embedder
+	EmbeddingModelName string
+
 	// Storage configuration
 	StorageType    storage.StorageType
 	LocalDirectory string
@@ -32,14 +47,32 @@ type Config struct {
 	S3AccessKey    string
 	S3SecretKey    string
 	S3Endpoint     string
+
+	// AppURL is where the webapp is served, which reminders link to
+	AppURL string
+	// SMTP configures email reminders, which are disabled when SMTP.Host is empty
+	SMTP services.SMTPConfig
+	// VAPIDPrivateKey signs Web Push reminders, which are disabled when it is empty.
+	// VAPIDSubject is the contact address given to push services.
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+
+	// AutoMigrate applies pending migrations at startup instead of refusing to run
+	AutoMigrate bool
+
+	// TrashRetention is how long deleted dreams are kept, zero keeps them until purged
+	TrashRetention time.Duration
 }
 
 // loadConfig loads configuration from environment variables with defaults
 func loadConfig() Config {
 	// Default to local storage
 	storageType := storage.StorageTypeLocal
-	if os.Getenv("STORAGE_TYPE") == "s3" {
+	switch os.Getenv("STORAGE_TYPE") {
+	case "s3":
 		storageType = storage.StorageTypeS3
+	case "memory":
+		storageType = storage.StorageTypeMemory
 	}
 
 	// Get the current working directory for local storage
@@ -48,19 +81,43 @@ func loadConfig() Config {
 		log.Fatalf("Failed to get current working directory: %v", err)
 	}
 
+	trashRetention := services.DefaultTrashRetention
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		parsed, err := strconv.Atoi(days)
+		if err != nil {
+			log.Fatalf("Invalid TRASH_RETENTION_DAYS %q: %v", days, err)
+		}
+		trashRetention = time.Duration(parsed) * 24 * time.Hour
+	}
+
 	return Config{
-		DatabaseURL: getEnv("DATABASE_URL", "postgres://postgres:localhost:5432/dreams?sslmode=disable"),
-		Port:        getEnv("PORT", "8080"),
-		AIApiHost:   getEnv("AI_API_HOST", "http://localhost:11434"),
-		AIEndpoint:  getEnv("AI_API_ENDPOINT", "/api/generate"),
-		AIModelName: getEnv("AI_MODEL_NAME", "stable-diffusion-1.5"),
-		StorageType:    storageType,
-		LocalDirectory: getEnv("LOCAL_DIRECTORY", filepath.Join(cwd, "images")),
-		S3Bucket:       getEnv("S3_BUCKET", ""),
-		S3Region:       getEnv("S3_REGION", "us-east-1"),
-		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
-		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
-		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		DatabaseURL:        getEnv("DATABASE_URL", "postgres://postgres:localhost:5432/dreams?sslmode=disable"),
+		Port:               getEnv("PORT", "8080"),
+		AIApiHost:          getEnv("AI_API_HOST", "http://localhost:11434"),
+		AIEndpoint:         getEnv("AI_API_ENDPOINT", "/api/generate"),
+		AIModelName:        getEnv("AI_MODEL_NAME", "stable-diffusion-1.5"),
+		LLMApiHost:         getEnv("LLM_API_HOST", "http://localhost:11434"),
+		LLMModelName:       getEnv("LLM_MODEL_NAME", ""),
+		EmbeddingModelName: getEnv("EMBEDDING_MODEL_NAME", ""),
+		StorageType:        storageType,
+		LocalDirectory:     getEnv("LOCAL_DIRECTORY", filepath.Join(cwd, "images")),
+		S3Bucket:           getEnv("S3_BUCKET", ""),
+		S3Region:           getEnv("S3_REGION", "us-east-1"),
+		S3AccessKey:        getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:        getEnv("S3_SECRET_KEY", ""),
+		S3Endpoint:         getEnv("S3_ENDPOINT", ""),
+		AppURL:             getEnv("APP_URL", "http://localhost:3000"),
+		SMTP: services.SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "dreams@localhost"),
+		},
+		VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:    getEnv("VAPID_SUBJECT", "mailto:dreams@localhost"),
+		AutoMigrate:     getEnv("AUTO_MIGRATE", "false") == "true",
+		TrashRetention:  trashRetention,
 	}
 }
 
@@ -77,15 +134,26 @@ func getEnv(key, defaultValue string) string {
 var corsMiddleware = func() *cors.Cors {
 	return cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "https://localhost:3000"},
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Requested-With", "X-CSRF-Token"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Requested-With", "X-CSRF-Token", "Range", "If-None-Match", "If-Match"},
+		ExposedHeaders:   []string{"ETag", "Content-Range", "Accept-Ranges"},
 		AllowCredentials: true,
 		MaxAge:           3600,
 		Debug:            false,
 	})
 }
 
+// openDatabase connects to the configured Postgres or SQLite database
+func openDatabase(config Config) (*gorm.DB, error) {
+	return database.Open(config.DatabaseURL, &gorm.Config{})
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	config := loadConfig()
 
 	// Initialize storage provider
@@ -111,35 +179,118 @@ func main() {
 		}
 	}
 
-	db, err := gorm.Open(postgres.Open(config.DatabaseURL), &gorm.Config{})
+	db, err := openDatabase(config)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.Dream{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if config.AutoMigrate {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatalf("Refusing to start: %v (run \"%s migrate up\")", err, os.Args[0])
 	}
 
 	aiService := services.NewAIService(config.AIApiHost, config.AIEndpoint, config.AIModelName, storageProvider)
 
-	queueService := services.NewQueueService(aiService, db)
+	dreamRepository := repositories.NewDreamRepository(db)
+
+	queueService := services.NewQueueService(aiService, dreamRepository)
 	queueService.Start()
 
-	dreamHandler := handlers.NewDreamHandler(db, aiService, queueService)
+	trashService := services.NewTrashService(db, storageProvider, config.TrashRetention)
+	trashService.Start()
+
+	llmClient := services.NewLLMClient(config.LLMApiHost, config.LLMModelName)
+
+	dreamSignService := services.NewDreamSignService(db, llmClient)
+	dreamSignService.Start()
+
+	similarityService := services.NewSimilarityService(db, dreamRepository, services.NewEmbedder(config.LLMApiHost, config.EmbeddingModelName))
+	similarityService.Start()
+
+	emotionService := services.NewEmotionService(db, dreamRepository, llmClient)
+	emotionService.Start()
+
+	// Webhooks need no configuration, email and Web Push are only offered when configured
+	notifiers := map[string]services.Notifier{models.ReminderWebhook: services.NewWebhookNotifier()}
+	if config.SMTP.Host != "" {
+		notifiers[models.ReminderEmail] = services.NewEmailNotifier(config.SMTP)
+	}
+	if config.VAPIDPrivateKey != "" {
+		webPush, err := services.NewWebPushNotifier(config.VAPIDPrivateKey, config.VAPIDSubject)
+		if err != nil {
+			log.Fatalf("Failed to configure Web Push: %v", err)
+		}
+		notifiers[models.ReminderWebPush] = webPush
+	}
+	reminderService := services.NewReminderService(db, notifiers, config.AppURL)
+	reminderService.Start()
+
+	dreamHandler := handlers.NewDreamHandler(dreamRepository, aiService, queueService, emotionService)
+	tagHandler := handlers.NewTagHandler(db)
+	trashHandler := handlers.NewTrashHandler(db, trashService)
+	exportHandler := handlers.NewExportHandler(services.NewExportService(dreamRepository, storageProvider))
+	importHandler := handlers.NewImportHandler(services.NewImportService(dreamRepository, storageProvider))
+	statsHandler := handlers.NewStatsHandler(services.NewStatsService(db))
+	dreamSignHandler := handlers.NewDreamSignHandler(dreamSignService)
+	similarHandler := handlers.NewSimilarHandler(similarityService)
+	emotionHandler := handlers.NewEmotionHandler(emotionService)
+	reminderHandler := handlers.NewReminderHandler(reminderService)
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /api/dreams", dreamHandler.HandleGetAll)
 	mux.HandleFunc("POST /api/dreams", dreamHandler.HandleCreate)
+	mux.HandleFunc("GET /api/dreams/search", dreamHandler.HandleSearch)
 	mux.HandleFunc("GET /api/dreams/{id}", dreamHandler.HandleGetById)
 	mux.HandleFunc("PUT /api/dreams/{id}", dreamHandler.HandleUpdate)
+	mux.HandleFunc("PATCH /api/dreams/{id}", dreamHandler.HandlePatch)
 	mux.HandleFunc("DELETE /api/dreams/{id}", dreamHandler.HandleDelete)
+	mux.HandleFunc("GET /api/dreams/{id}/revisions", dreamHandler.HandleListRevisions)
+	mux.HandleFunc("GET /api/dreams/{id}/revisions/diff", dreamHandler.HandleDiffRevisions)
+	mux.HandleFunc("GET /api/dreams/{id}/revisions/{version}", dreamHandler.HandleGetRevision)
+	mux.HandleFunc("POST /api/dreams/{id}/revisions/{version}/restore", dreamHandler.HandleRestoreRevision)
 	mux.HandleFunc("POST /api/dreams/{id}/generate-image", dreamHandler.HandleGenerateImage)
 	mux.HandleFunc("GET /api/dreams/{id}/status", dreamHandler.HandleCheckImageStatus)
+	mux.HandleFunc("GET /api/dreams/{id}/similar", similarHandler.HandleSimilar)
+	mux.HandleFunc("GET /api/dreams/{id}/emotions", emotionHandler.HandleDreamEmotions)
+	mux.HandleFunc("POST /api/dreams/{id}/tags", tagHandler.HandleAddTags)
+	mux.HandleFunc("DELETE /api/dreams/{id}/tags/{tag}", tagHandler.HandleRemoveTag)
+	mux.HandleFunc("GET /api/tags", tagHandler.HandleListTags)
+	mux.HandleFunc("GET /api/trash", trashHandler.HandleListTrash)
+	mux.HandleFunc("POST /api/dreams/{id}/restore", trashHandler.HandleRestore)
+	mux.HandleFunc("DELETE /api/trash/{id}", trashHandler.HandlePurge)
+	mux.HandleFunc("POST /api/images/provenance", dreamHandler.HandleImageProvenance)
+	mux.HandleFunc("GET /api/export", exportHandler.HandleExport)
+	mux.HandleFunc("GET /api/export/book", exportHandler.HandleBook)
+	mux.HandleFunc("POST /api/import", importHandler.HandleImport)
+	mux.HandleFunc("GET /api/import/{id}", importHandler.HandleImportStatus)
+	mux.HandleFunc("GET /api/stats", statsHandler.HandleStats)
+	mux.HandleFunc("GET /api/stats/moods", emotionHandler.HandleMoods)
+	mux.HandleFunc("GET /api/dream-signs", dreamSignHandler.HandleListDreamSigns)
+	mux.HandleFunc("GET /api/reminders", reminderHandler.HandleListReminders)
+	mux.HandleFunc("POST /api/reminders", reminderHandler.HandleCreateReminder)
+	mux.HandleFunc("GET /api/reminders/push-key", reminderHandler.HandlePushKey)
+	mux.HandleFunc("GET /api/reminders/{id}", reminderHandler.HandleGetReminder)
+	mux.HandleFunc("PUT /api/reminders/{id}", reminderHandler.HandleUpdateReminder)
+	mux.HandleFunc("DELETE /api/reminders/{id}", reminderHandler.HandleDeleteReminder)
+	mux.HandleFunc("POST /api/reminders/{id}/test", reminderHandler.HandleTestReminder)
 
-	if config.StorageType == storage.StorageTypeLocal {
-		fs := http.FileServer(http.Dir(config.LocalDirectory))
-		mux.Handle("/images/", http.StripPrefix("/images/", fs))
+	// S3 images are served directly from the bucket
+	if config.StorageType != storage.StorageTypeS3 {
+		imageHandler := handlers.NewImageHandler(storageProvider)
+		mux.HandleFunc("GET /images/{key...}", imageHandler.HandleGetImage)
 	}
 
 	// Wrap the mux with CORS middleware
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"dreams/migrations"
+)
+
+const migrateUsage = `Usage: %s migrate <command>
+
+Commands:
+  up              apply all pending migrations
+  down [n]        roll back the last n migrations (default 1)
+  status          list migrations and when they were applied
+  create <name>   add empty up and down files for a new migration in each dialect directory
+`
+
+// runMigrate implements the migrate subcommand
+func runMigrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := flags.String("dir", "migrations", "directory holding the postgres and sqlite migration directories")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), migrateUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	command := flags.Arg(0)
+	if command == "create" {
+		if flags.NArg() != 2 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		for _, dialect := range migrations.Dialects {
+			up, down, err := migrations.Create(filepath.Join(*dir, dialect), flags.Arg(1))
+			if err != nil {
+				log.Fatalf("Failed to create migration: %v", err)
+			}
+			fmt.Printf("Created %s\nCreated %s\n", up, down)
+		}
+		return
+	}
+
+	db, err := openDatabase(loadConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		steps := 1
+		if flags.NArg() > 1 {
+			steps, err = strconv.Atoi(flags.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations %q", flags.Arg(1))
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(out, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Modified {
+				applied += " (modified)"
+			}
+			fmt.Fprintf(out, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		out.Flush()
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,335 @@
+// Package migrations applies the versioned SQL migrations embedded in the binary.
+//
+// Migrations live in a directory per database dialect as NNNN_name.up.sql and
+// NNNN_name.down.sql. Applied migrations are recorded in the schema_migrations table with
+// a checksum of their up SQL, so edits to a migration after it ran are detected.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var embedded embed.FS
+
+// Dialects are the databases with migrations. Every migration is written once per dialect.
+var Dialects = []string{"postgres", "sqlite"}
+
+// ErrSchemaOutOfDate is returned by Check when the database needs migrating
+var ErrSchemaOutOfDate = errors.New("database schema is out of date")
+
+// fileNamePattern matches migration file names like 0002_add_tags.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  uint
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	// Modified is set when the applied checksum differs from the migration's
+	Modified bool
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+const createTableSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a migrator with the embedded migrations for the database's dialect
+func New(db *gorm.DB) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	if _, err := fs.Stat(embedded, dialect); err != nil {
+		return nil, fmt.Errorf("no migrations for database %q", dialect)
+	}
+	fsys, err := fs.Sub(embedded, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromFS(db, fsys)
+}
+
+// NewFromFS creates a migrator with the migrations in the root of fsys
+func NewFromFS(db *gorm.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads the migrations in the root of fsys, ordered by version. Every version needs
+// both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+			sum := sha256.Sum256(data)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Status lists every known migration with when it was applied, followed by any applied
+// migrations this build doesn't know about
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			status.Modified = row.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: row.Version, Name: row.Name, Checksum: row.Checksum},
+			AppliedAt: &appliedAt,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check returns an error wrapping ErrSchemaOutOfDate unless every migration has been
+// applied unmodified and the database has none this build doesn't know about
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[uint]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		name := fmt.Sprintf("%04d_%s", status.Version, status.Name)
+		switch {
+		case !known[status.Version]:
+			return fmt.Errorf("%w: migration %s was applied by a newer build", ErrSchemaOutOfDate, name)
+		case status.Modified:
+			return fmt.Errorf("%w: migration %s was modified after it was applied", ErrSchemaOutOfDate, name)
+		case status.AppliedAt == nil:
+			pending = append(pending, name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s", ErrSchemaOutOfDate, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Up applies every pending migration in order, each in its own transaction, and returns
+// the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, status := range statuses {
+		if status.Modified {
+			return done, fmt.Errorf("migration %04d_%s was modified after it was applied", status.Version, status.Name)
+		}
+		if status.AppliedAt != nil {
+			continue
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(status.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&appliedMigration{
+				Version:   status.Version,
+				Name:      status.Name,
+				Checksum:  status.Checksum,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s failed: %w", status.Version, status.Name, err)
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		status := statuses[i]
+		if status.AppliedAt == nil {
+			continue
+		}
+		if status.Down == "" {
+			return done, fmt.Errorf("migration %04d_%s is unknown to this build and can't be rolled back", status.Version, status.Name)
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(status.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&appliedMigration{}, status.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rolling back migration %04d_%s failed: %w", status.Version, status.Name, err)
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// applied returns the rows of the migrations table by version, creating the table if needed
+func (m *Migrator) applied(ctx context.Context) (map[uint]appliedMigration, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.Exec(createTableSQL).Error; err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var rows []appliedMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read migrations table: %w", err)
+	}
+	applied := make(map[uint]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Create writes empty up and down files for a new migration in dir, numbered after the
+// highest existing version, and returns their paths
+func Create(dir, name string) (string, string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name must contain letters or digits")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var latest uint64
+	for _, entry := range entries {
+		if match := fileNamePattern.FindStringSubmatch(entry.Name()); match != nil {
+			if version, _ := strconv.ParseUint(match[1], 10, 32); version > latest {
+				latest = version
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%04d_%s", latest+1, name)
+	up := filepath.Join(dir, base+".up.sql")
+	down := filepath.Join(dir, base+".down.sql")
+	for _, file := range []struct{ path, comment string }{
+		{up, "-- " + base + ": apply the change\n"},
+		{down, "-- " + base + ": undo " + path.Base(up) + "\n"},
+	} {
+		if err := os.WriteFile(file.path, []byte(file.comment), 0644); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
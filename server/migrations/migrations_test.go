@@ -0,0 +1,211 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_notes.up.sql":   {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)")},
+		"0001_create_notes.down.sql": {Data: []byte("DROP TABLE notes")},
+		"0002_add_title.up.sql":      {Data: []byte("ALTER TABLE notes ADD COLUMN title TEXT")},
+		"0002_add_title.down.sql":    {Data: []byte("ALTER TABLE notes DROP COLUMN title")},
+		"README.md":                  {Data: []byte("not a migration")},
+	}
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrations.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	return db
+}
+
+func TestMigratorUpDownAndCheck(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	fsys := testMigrations()
+	migrator, err := NewFromFS(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Check(ctx); !errors.Is(err, ErrSchemaOutOfDate) {
+		t.Fatalf("expected unmigrated schema to fail the check, got %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("expected 2 migrations applied, got %d (%v)", len(applied), err)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatalf("expected check to pass after up, got %v", err)
+	}
+	if err := db.Exec("INSERT INTO notes (body, title) VALUES ('a', 'b')").Error; err != nil {
+		t.Fatalf("expected migrated table, got %v", err)
+	}
+	if applied, _ := migrator.Up(ctx); len(applied) != 0 {
+		t.Errorf("expected up to be a no-op, applied %d", len(applied))
+	}
+
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("expected migration 2 rolled back, got %+v (%v)", reverted, err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("expected only migration 1 applied, got %+v", statuses)
+	}
+	if err := migrator.Check(ctx); !errors.Is(err, ErrSchemaOutOfDate) {
+		t.Errorf("expected pending migration to fail the check, got %v", err)
+	}
+
+	// Editing an applied migration is detected
+	fsys["0001_create_notes.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY)")}
+	edited, err := NewFromFS(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := edited.Up(ctx); err == nil {
+		t.Error("expected up to refuse a modified migration")
+	}
+	if statuses, _ := edited.Status(ctx); !statuses[0].Modified {
+		t.Errorf("expected migration 1 to be reported as modified, got %+v", statuses[0])
+	}
+
+	// A database migrated by a newer build is rejected
+	older, err := NewFromFS(db, fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := older.Check(ctx); !errors.Is(err, ErrSchemaOutOfDate) {
+		t.Errorf("expected unknown applied migration to fail the check, got %v", err)
+	}
+}
+
+func TestLoadRejectsIncompleteMigrations(t *testing.T) {
+	_, err := Load(fstest.MapFS{
+		"0001_create_notes.up.sql": {Data: []byte("CREATE TABLE notes (id INTEGER)")},
+	})
+	if err == nil {
+		t.Error("expected a migration without a down file to be rejected")
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	fsys, err := fs.Sub(embedded, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := Load(fsys)
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("expected embedded postgres migrations, got %d (%v)", len(migrations), err)
+	}
+}
+
+// baselineDream is the dreams table the old AutoMigrate startup created, before any of the
+// columns added since
+type baselineDream struct {
+	gorm.Model
+	Dream    string `gorm:"type:text;not null"`
+	ImageURL string `gorm:"type:text"`
+}
+
+func (baselineDream) TableName() string {
+	return "dreams"
+}
+
+func TestEmbeddedMigrationsUpgradeBaselineSchema(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&baselineDream{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&baselineDream{Dream: "Swimming with whales"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("expected migrations to upgrade the baseline schema, got %v", err)
+	}
+
+	var dream struct {
+		Dream   string
+		Version uint
+		Lucid   bool
+	}
+	if err := db.Raw("SELECT dream, version, lucid FROM dreams WHERE id = 1").Scan(&dream).Error; err != nil {
+		t.Fatal(err)
+	}
+	if dream.Dream != "Swimming with whales" || dream.Version != 1 || dream.Lucid {
+		t.Errorf("expected the existing dream with default metadata, got %+v", dream)
+	}
+	var matches int64
+	if err := db.Raw("SELECT COUNT(*) FROM dreams_fts WHERE dreams_fts MATCH 'whale'").Scan(&matches).Error; err != nil || matches != 1 {
+		t.Errorf("expected the existing dream to be searchable, got %d (%v)", matches, err)
+	}
+}
+
+// TestPostgresInitialSchemaAddsColumns checks that every dreams column newer than the
+// baseline is also added to an existing table, as there's no Postgres to migrate in tests
+func TestPostgresInitialSchemaAddsColumns(t *testing.T) {
+	data, err := fs.ReadFile(embedded, "postgres/0001_initial_schema.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := string(data)
+	table := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS dreams \((.*?)\n\);`).FindStringSubmatch(up)
+	if table == nil {
+		t.Fatal("expected a dreams table")
+	}
+	baseline := map[string]bool{"id": true, "created_at": true, "updated_at": true, "deleted_at": true, "dream": true, "image_url": true}
+	for _, line := range strings.Split(table[1], "\n") {
+		column := strings.Fields(line)
+		if len(column) == 0 || baseline[column[0]] {
+			continue
+		}
+		definition := strings.TrimSuffix(strings.Join(column[1:], " "), ",")
+		if want := "ALTER TABLE dreams ADD COLUMN IF NOT EXISTS " + column[0] + " " + definition + ";"; !strings.Contains(up, want) {
+			t.Errorf("expected %q", want)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "0007_existing.up.sql"), nil, 0644)
+
+	up, down, err := Create(dir, "Add Dream Signs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0008_add_dream_signs.up.sql" || filepath.Base(down) != "0008_add_dream_signs.down.sql" {
+		t.Errorf("unexpected migration files %s, %s", up, down)
+	}
+	if _, _, err := Create(dir, "!!!"); err == nil {
+		t.Error("expected a name without letters or digits to be rejected")
+	}
+}
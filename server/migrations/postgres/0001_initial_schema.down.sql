@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS dream_revisions;
+DROP TABLE IF EXISTS dream_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS dreams;
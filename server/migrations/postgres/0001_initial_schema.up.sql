@@ -0,0 +1,61 @@
+-- Baseline schema. Databases created by the old AutoMigrate startup already have a dreams
+-- table with only the original columns, so every statement is idempotent and the columns
+-- added since are added to an existing table.
+
+CREATE TABLE IF NOT EXISTS dreams (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ,
+	deleted_at TIMESTAMPTZ,
+	dream TEXT NOT NULL,
+	image_url TEXT,
+	image_variants TEXT,
+	version BIGINT NOT NULL DEFAULT 1,
+	dreamt_on DATE,
+	lucid BOOLEAN NOT NULL DEFAULT false,
+	nightmare BOOLEAN NOT NULL DEFAULT false,
+	recurring BOOLEAN NOT NULL DEFAULT false,
+	mood SMALLINT,
+	vividness SMALLINT,
+	sleep_quality SMALLINT
+);
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS image_variants TEXT;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS dreamt_on DATE;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS lucid BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS nightmare BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS recurring BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS mood SMALLINT;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS vividness SMALLINT;
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS sleep_quality SMALLINT;
+CREATE INDEX IF NOT EXISTS idx_dreams_deleted_at ON dreams (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_dreams_dreamt_on ON dreams (dreamt_on);
+
+-- Full-text search over the dream text, see models.SearchConfig
+ALTER TABLE dreams ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', coalesce(dream, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_dreams_search_vector ON dreams USING GIN (search_vector);
+
+CREATE TABLE IF NOT EXISTS tags (
+	id BIGSERIAL PRIMARY KEY,
+	name VARCHAR(50) NOT NULL,
+	created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags (name);
+
+CREATE TABLE IF NOT EXISTS dream_tags (
+	dream_id BIGINT NOT NULL,
+	tag_id BIGINT NOT NULL,
+	PRIMARY KEY (dream_id, tag_id),
+	CONSTRAINT fk_dream_tags_dream FOREIGN KEY (dream_id) REFERENCES dreams (id),
+	CONSTRAINT fk_dream_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id)
+);
+
+CREATE TABLE IF NOT EXISTS dream_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	dream_id BIGINT NOT NULL,
+	version BIGINT NOT NULL,
+	dream TEXT NOT NULL,
+	created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dream_revisions_version ON dream_revisions (dream_id, version);
@@ -0,0 +1,18 @@
+-- Keyphrases extracted from each dream by the dream-sign analyzer
+
+CREATE TABLE dream_keyphrases (
+	dream_id BIGINT NOT NULL,
+	phrase VARCHAR(100) NOT NULL,
+	score DOUBLE PRECISION NOT NULL,
+	source VARCHAR(10) NOT NULL,
+	PRIMARY KEY (dream_id, phrase),
+	CONSTRAINT fk_dream_keyphrases_dream FOREIGN KEY (dream_id) REFERENCES dreams (id)
+);
+CREATE INDEX idx_dream_keyphrases_phrase ON dream_keyphrases (phrase);
+
+CREATE TABLE dream_sign_analyses (
+	dream_id BIGINT PRIMARY KEY,
+	version BIGINT NOT NULL,
+	analyzed_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT fk_dream_sign_analyses_dream FOREIGN KEY (dream_id) REFERENCES dreams (id)
+);
@@ -0,0 +1,13 @@
+-- Text embeddings for finding similar dreams, compared by the server as their dimension
+-- depends on the configured embedding model
+
+CREATE TABLE dream_embeddings (
+	dream_id BIGINT PRIMARY KEY,
+	model VARCHAR(100) NOT NULL,
+	dream_version BIGINT NOT NULL,
+	vector BYTEA NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT fk_dream_embeddings_dream FOREIGN KEY (dream_id) REFERENCES dreams (id)
+);
+CREATE INDEX idx_dream_embeddings_model ON dream_embeddings (model);
+
@@ -0,0 +1,14 @@
+-- Emotion scores of each dream, from 0 to 1, for charting mood over time
+
+CREATE TABLE dream_emotions (
+	dream_id BIGINT PRIMARY KEY,
+	dream_version BIGINT NOT NULL,
+	source VARCHAR(10) NOT NULL,
+	fear DOUBLE PRECISION NOT NULL DEFAULT 0,
+	joy DOUBLE PRECISION NOT NULL DEFAULT 0,
+	sadness DOUBLE PRECISION NOT NULL DEFAULT 0,
+	anger DOUBLE PRECISION NOT NULL DEFAULT 0,
+	surprise DOUBLE PRECISION NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL,
+	CONSTRAINT fk_dream_emotions_dream FOREIGN KEY (dream_id) REFERENCES dreams (id)
+);
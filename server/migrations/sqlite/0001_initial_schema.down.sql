@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS dream_revisions;
+DROP TABLE IF EXISTS dream_tags;
+DROP TABLE IF EXISTS tags;
+DROP TRIGGER IF EXISTS dreams_fts_update;
+DROP TRIGGER IF EXISTS dreams_fts_delete;
+DROP TRIGGER IF EXISTS dreams_fts_insert;
+DROP TABLE IF EXISTS dreams_fts;
+DROP TABLE IF EXISTS dreams;
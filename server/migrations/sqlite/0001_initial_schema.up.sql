@@ -0,0 +1,81 @@
+-- Baseline schema, matching migrations/postgres/0001_initial_schema.up.sql. A dreams table
+-- created by the old AutoMigrate startup only has the original columns, and SQLite can't
+-- add a column only if it is missing, so the table is rebuilt with every column and its
+-- rows copied across.
+
+CREATE TABLE IF NOT EXISTS dreams (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME,
+	updated_at DATETIME,
+	deleted_at DATETIME,
+	dream TEXT NOT NULL,
+	image_url TEXT
+);
+CREATE TABLE dreams_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME,
+	updated_at DATETIME,
+	deleted_at DATETIME,
+	dream TEXT NOT NULL,
+	image_url TEXT,
+	image_variants TEXT,
+	version INTEGER NOT NULL DEFAULT 1,
+	dreamt_on DATE,
+	lucid NUMERIC NOT NULL DEFAULT false,
+	nightmare NUMERIC NOT NULL DEFAULT false,
+	recurring NUMERIC NOT NULL DEFAULT false,
+	mood SMALLINT,
+	vividness SMALLINT,
+	sleep_quality SMALLINT
+);
+INSERT INTO dreams_new (id, created_at, updated_at, deleted_at, dream, image_url)
+	SELECT id, created_at, updated_at, deleted_at, dream, image_url FROM dreams;
+DROP TABLE dreams;
+ALTER TABLE dreams_new RENAME TO dreams;
+CREATE INDEX idx_dreams_deleted_at ON dreams (deleted_at);
+CREATE INDEX idx_dreams_dreamt_on ON dreams (dreamt_on);
+
+-- Full-text search over the dream text. The FTS5 table indexes the dreams table's content
+-- and the triggers keep it in sync.
+CREATE VIRTUAL TABLE dreams_fts USING fts5(
+	dream,
+	content = 'dreams',
+	content_rowid = 'id',
+	tokenize = 'porter unicode61'
+);
+CREATE TRIGGER dreams_fts_insert AFTER INSERT ON dreams BEGIN
+	INSERT INTO dreams_fts (rowid, dream) VALUES (new.id, new.dream);
+END;
+CREATE TRIGGER dreams_fts_delete AFTER DELETE ON dreams BEGIN
+	INSERT INTO dreams_fts (dreams_fts, rowid, dream) VALUES ('delete', old.id, old.dream);
+END;
+CREATE TRIGGER dreams_fts_update AFTER UPDATE OF dream ON dreams BEGIN
+	INSERT INTO dreams_fts (dreams_fts, rowid, dream) VALUES ('delete', old.id, old.dream);
+	INSERT INTO dreams_fts (rowid, dream) VALUES (new.id, new.dream);
+END;
+-- Index the dreams copied from an existing table
+INSERT INTO dreams_fts (dreams_fts) VALUES ('rebuild');
+
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(50) NOT NULL,
+	created_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags (name);
+
+CREATE TABLE IF NOT EXISTS dream_tags (
+	dream_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (dream_id, tag_id),
+	CONSTRAINT fk_dream_tags_dream FOREIGN KEY (dream_id) REFERENCES dreams (id),
+	CONSTRAINT fk_dream_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id)
+);
+
+CREATE TABLE IF NOT EXISTS dream_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	dream_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	dream TEXT NOT NULL,
+	created_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dream_revisions_version ON dream_revisions (dream_id, version);
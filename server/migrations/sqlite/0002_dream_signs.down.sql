@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS dream_sign_analyses;
+DROP TABLE IF EXISTS dream_keyphrases;
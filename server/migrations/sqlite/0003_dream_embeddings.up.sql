@@ -0,0 +1,12 @@
+-- Text embeddings for finding similar dreams, compared by the server as SQLite has no
+-- vector search
+
+CREATE TABLE dream_embeddings (
+	dream_id INTEGER PRIMARY KEY,
+	model VARCHAR(100) NOT NULL,
+	dream_version INTEGER NOT NULL,
+	vector BLOB NOT NULL,
+	updated_at DATETIME NOT NULL,
+	CONSTRAINT fk_dream_embeddings_dream FOREIGN KEY (dream_id) REFERENCES dreams (id)
+);
+CREATE INDEX idx_dream_embeddings_model ON dream_embeddings (model);
@@ -0,0 +1,14 @@
+-- Emotion scores of each dream, from 0 to 1, for charting mood over time
+
+CREATE TABLE dream_emotions (
+	dream_id INTEGER PRIMARY KEY,
+	dream_version INTEGER NOT NULL,
+	source VARCHAR(10) NOT NULL,
+	fear REAL NOT NULL DEFAULT 0,
+	joy REAL NOT NULL DEFAULT 0,
+	sadness REAL NOT NULL DEFAULT 0,
+	anger REAL NOT NULL DEFAULT 0,
+	surprise REAL NOT NULL DEFAULT 0,
+	updated_at DATETIME NOT NULL,
+	CONSTRAINT fk_dream_emotions_dream FOREIGN KEY (dream_id) REFERENCES dreams (id)
+);
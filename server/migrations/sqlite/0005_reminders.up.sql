@@ -0,0 +1,15 @@
+-- Morning reminders to write down dreams, sent by the reminder scheduler
+
+CREATE TABLE reminders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time_of_day VARCHAR(5) NOT NULL,
+	time_zone VARCHAR(64) NOT NULL,
+	weekdays VARCHAR(27) NOT NULL,
+	channel VARCHAR(10) NOT NULL,
+	target TEXT NOT NULL DEFAULT '',
+	subscription TEXT,
+	enabled NUMERIC NOT NULL DEFAULT true,
+	last_sent_on DATE,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
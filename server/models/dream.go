@@ -1,8 +1,12 @@
 package models
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 )
@@ -11,6 +15,98 @@ type Dream struct {
 	gorm.Model
 	Dream    string `gorm:"type:text;not null" json:"dream"`
 	ImageURL string `gorm:"type:text" json:"image_url"`
+	// ImageVariants maps variant names (thumbnail, medium, jpeg) to URLs for srcset
+	ImageVariants ImageVariants `gorm:"type:text" json:"image_variants,omitempty"`
+	Tags          []Tag         `gorm:"many2many:dream_tags;" json:"tags,omitempty"`
+	// Version counts user edits and backs the ETag used for optimistic concurrency
+	Version uint `gorm:"not null;default:1" json:"version"`
+
+	// DreamtOn is the night the dream happened, which can differ from when it was written down
+	DreamtOn  *Date `gorm:"type:date;index" json:"dreamt_on,omitempty"`
+	Lucid     bool  `gorm:"not null;default:false" json:"lucid"`
+	Nightmare bool  `gorm:"not null;default:false" json:"nightmare"`
+	Recurring bool  `gorm:"not null;default:false" json:"recurring"`
+	// Ratings range from MinRating to MaxRating and are optional
+	Mood         *int `gorm:"type:smallint" json:"mood,omitempty"`          // Very negative to very positive
+	Vividness    *int `gorm:"type:smallint" json:"vividness,omitempty"`     // Vague to vivid
+	SleepQuality *int `gorm:"type:smallint" json:"sleep_quality,omitempty"` // Poor to great
+}
+
+// Bounds for the dream ratings
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+// MaxDreamLength is the maximum length of the dream text in characters
+const MaxDreamLength = 20000
+
+// Validate checks the dream text and structured metadata and returns ValidationErrors
+func (d *Dream) Validate() error {
+	var errs ValidationErrors
+
+	if strings.TrimSpace(d.Dream) == "" {
+		errs.Add("dream", "is required")
+	} else if utf8.RuneCountInString(d.Dream) > MaxDreamLength {
+		errs.Add("dream", fmt.Sprintf("must be at most %d characters", MaxDreamLength))
+	}
+
+	ratings := []struct {
+		name  string
+		value *int
+	}{
+		{"mood", d.Mood},
+		{"vividness", d.Vividness},
+		{"sleep_quality", d.SleepQuality},
+	}
+	for _, rating := range ratings {
+		if rating.value != nil && (*rating.value < MinRating || *rating.value > MaxRating) {
+			errs.Add(rating.name, fmt.Sprintf("must be between %d and %d", MinRating, MaxRating))
+		}
+	}
+
+	// Allow a day of slack for clients ahead of the server's time zone
+	if d.DreamtOn != nil && d.DreamtOn.After(time.Now().AddDate(0, 0, 1)) {
+		errs.Add("dreamt_on", "cannot be in the future")
+	}
+
+	return errs.Err()
+}
+
+// ImageVariants is stored as a JSON object in a text column
+type ImageVariants map[string]string
+
+// Value implements driver.Valuer
+func (v ImageVariants) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (v *ImageVariants) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		data = []byte(val)
+	case []byte:
+		data = val
+	default:
+		return fmt.Errorf("unsupported type for ImageVariants: %T", value)
+	}
+	if len(data) == 0 {
+		*v = nil
+		return nil
+	}
+	return json.Unmarshal(data, v)
 }
 
 // MarshalJSON implements custom JSON marshaling
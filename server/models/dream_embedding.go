@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// DreamEmbedding is a vector describing a dream's text, for finding similar dreams.
+// Vectors from different models can't be compared, so each records the model and the
+// dream version it was computed from.
+type DreamEmbedding struct {
+	DreamID      uint   `gorm:"primaryKey"`
+	Model        string `gorm:"type:varchar(100);not null"`
+	DreamVersion uint   `gorm:"not null"`
+	// Vector holds the unit-length vector as little-endian float32s
+	Vector    []byte    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
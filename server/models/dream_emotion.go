@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Emotion score sources
+const (
+	EmotionLexicon = "lexicon"
+	EmotionLLM     = "llm"
+)
+
+// Emotions are how strongly a dream expresses each emotion, from 0 to 1
+type Emotions struct {
+	Fear     float64 `gorm:"not null" json:"fear"`
+	Joy      float64 `gorm:"not null" json:"joy"`
+	Sadness  float64 `gorm:"not null" json:"sadness"`
+	Anger    float64 `gorm:"not null" json:"anger"`
+	Surprise float64 `gorm:"not null" json:"surprise"`
+}
+
+// DreamEmotion is the emotion scores of a dream, recording the dream version they were
+// computed from so edited dreams are scored again
+type DreamEmotion struct {
+	DreamID      uint `gorm:"primaryKey" json:"dream_id"`
+	DreamVersion uint `gorm:"not null" json:"dream_version"`
+	Emotions     `gorm:"embedded"`
+	Source       string    `gorm:"type:varchar(10);not null" json:"source"`
+	UpdatedAt    time.Time `gorm:"not null" json:"updated_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Keyphrase sources
+const (
+	KeyphraseTFIDF = "tfidf"
+	KeyphraseLLM   = "llm"
+)
+
+// DreamKeyphrase is a phrase the dream-sign analyzer extracted from a dream. Score ranks
+// the phrases of one dream against each other.
+type DreamKeyphrase struct {
+	DreamID uint    `gorm:"primaryKey" json:"dream_id"`
+	Phrase  string  `gorm:"primaryKey;type:varchar(100)" json:"phrase"`
+	Score   float64 `gorm:"not null" json:"score"`
+	Source  string  `gorm:"type:varchar(10);not null" json:"source"`
+}
+
+// DreamSignAnalysis records the version of a dream the language model last read, so
+// only new and edited dreams are sent to it
+type DreamSignAnalysis struct {
+	DreamID    uint      `gorm:"primaryKey"`
+	Version    uint      `gorm:"not null"`
+	AnalyzedAt time.Time `gorm:"not null"`
+}
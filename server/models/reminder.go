@@ -0,0 +1,207 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Reminder channels
+const (
+	ReminderEmail   = "email"
+	ReminderWebhook = "webhook"
+	ReminderWebPush = "webpush"
+)
+
+// Reminder is a schedule for nudging the dreamer to write down their dream after waking.
+// It fires once on each of its weekdays at the time of day in its time zone, unless a
+// dream has already been written that morning.
+type Reminder struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	// TimeOfDay is the local time to send the reminder, as HH:MM
+	TimeOfDay string `gorm:"type:varchar(5);not null" json:"time_of_day"`
+	// TimeZone is an IANA time zone name such as Europe/London
+	TimeZone string   `gorm:"type:varchar(64);not null" json:"time_zone"`
+	Weekdays Weekdays `gorm:"type:varchar(27);not null" json:"weekdays"`
+	Channel  string   `gorm:"type:varchar(10);not null" json:"channel"`
+	// Target is the address of email reminders and the URL of webhook reminders
+	Target string `gorm:"type:text;not null" json:"target,omitempty"`
+	// Subscription is the browser subscription of Web Push reminders
+	Subscription *PushSubscription `gorm:"type:text" json:"subscription,omitempty"`
+	Enabled      bool              `gorm:"not null" json:"enabled"`
+	// LastSentOn is the local date the reminder last fired or was skipped
+	LastSentOn *Date     `gorm:"type:date" json:"last_sent_on,omitempty"`
+	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// Location returns the reminder's time zone, or UTC if it isn't valid
+func (r *Reminder) Location() *time.Location {
+	location, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Validate checks the schedule and the channel's target and returns ValidationErrors
+func (r *Reminder) Validate() error {
+	var errs ValidationErrors
+
+	if _, err := time.Parse("15:04", r.TimeOfDay); err != nil || len(r.TimeOfDay) != 5 {
+		errs.Add("time_of_day", "must be a time of day as HH:MM")
+	}
+	if r.TimeZone == "" {
+		errs.Add("time_zone", "is required")
+	} else if _, err := time.LoadLocation(r.TimeZone); err != nil {
+		errs.Add("time_zone", "must be an IANA time zone such as Europe/London")
+	}
+	if len(r.Weekdays) == 0 {
+		errs.Add("weekdays", "must include at least one day")
+	}
+	for _, day := range r.Weekdays {
+		if weekday(day) < 0 {
+			errs.Add("weekdays", fmt.Sprintf("%q is not a day, expected one of %s", day, strings.Join(weekdayNames[:], ", ")))
+			break
+		}
+	}
+
+	switch r.Channel {
+	case ReminderEmail:
+		if _, err := mail.ParseAddress(r.Target); err != nil {
+			errs.Add("target", "must be an email address")
+		}
+	case ReminderWebhook:
+		if u, err := url.Parse(r.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add("target", "must be an http or https URL")
+		}
+	case ReminderWebPush:
+		if r.Subscription == nil {
+			errs.Add("subscription", "is required for Web Push reminders")
+		} else if err := r.Subscription.validate(); err != "" {
+			errs.Add("subscription", err)
+		}
+	default:
+		errs.Add("channel", "must be email, webhook or webpush")
+	}
+
+	return errs.Err()
+}
+
+// weekdayNames are the days accepted in Weekdays, indexed by time.Weekday
+var weekdayNames = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// weekday returns the day named by a Weekdays entry, or -1 if it isn't one
+func weekday(name string) time.Weekday {
+	for day, dayName := range weekdayNames {
+		if dayName == name {
+			return time.Weekday(day)
+		}
+	}
+	return -1
+}
+
+// Weekdays are the days a reminder fires on, as three-letter lowercase names. They are
+// stored as a comma-separated list.
+type Weekdays []string
+
+// Includes reports whether the reminder fires on the day
+func (w Weekdays) Includes(day time.Weekday) bool {
+	for _, name := range w {
+		if weekday(name) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements driver.Valuer
+func (w Weekdays) Value() (driver.Value, error) {
+	return strings.Join(w, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (w *Weekdays) Scan(value interface{}) error {
+	var s string
+	switch val := value.(type) {
+	case nil:
+	case string:
+		s = val
+	case []byte:
+		s = string(val)
+	default:
+		return fmt.Errorf("unsupported type for Weekdays: %T", value)
+	}
+	*w = nil
+	if s != "" {
+		*w = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// PushSubscription is a browser's Web Push subscription, in the shape returned by
+// PushSubscription.toJSON(). It is stored as a JSON object in a text column.
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		// P256DH is the browser's P-256 public key and Auth its authentication secret,
+		// both base64url encoded
+		P256DH string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// validate returns why the subscription can't be used, or an empty string
+func (s *PushSubscription) validate() string {
+	if u, err := url.Parse(s.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		return "endpoint must be an https URL"
+	}
+	if key, err := DecodePushKey(s.Keys.P256DH); err != nil || len(key) != 65 || key[0] != 4 {
+		return "keys.p256dh must be an uncompressed P-256 public key"
+	}
+	if secret, err := DecodePushKey(s.Keys.Auth); err != nil || len(secret) != 16 {
+		return "keys.auth must be a 16 byte secret"
+	}
+	return ""
+}
+
+// DecodePushKey decodes a base64url key, padded or not
+func DecodePushKey(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Value implements driver.Valuer
+func (s *PushSubscription) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (s *PushSubscription) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case nil:
+		return nil
+	case string:
+		data = []byte(val)
+	case []byte:
+		data = val
+	default:
+		return fmt.Errorf("unsupported type for PushSubscription: %T", value)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, s)
+}
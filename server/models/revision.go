@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// DreamRevision is a snapshot of the dream text at one edit version. A revision is stored
+// whenever the text changes, so dreams refined over the morning keep their earlier wording.
+type DreamRevision struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	DreamID   uint      `gorm:"not null;uniqueIndex:idx_dream_revisions_version" json:"dream_id"`
+	Version   uint      `gorm:"not null;uniqueIndex:idx_dream_revisions_version" json:"version"`
+	Dream     string    `gorm:"type:text;not null" json:"dream"`
+	CreatedAt time.Time `json:"created_at"`
+}
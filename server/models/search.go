@@ -0,0 +1,5 @@
+package models
+
+// SearchConfig is the Postgres text search configuration used for dreams. The generated
+// search_vector column in the migrations uses the same configuration.
+const SearchConfig = "english"
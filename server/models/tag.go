@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxTagLength is the maximum length of a tag name in characters
+const MaxTagLength = 50
+
+type Tag struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Name      string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// TagCount is a tag with the number of dreams using it
+type TagCount struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// NormalizeTagName trims and lowercases a tag name so "Flying " and "flying" are the same tag
+func NormalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if name == "" {
+		return "", fmt.Errorf("tag name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > MaxTagLength {
+		return "", fmt.Errorf("tag name must be at most %d characters", MaxTagLength)
+	}
+	if strings.Contains(name, ",") {
+		return "", fmt.Errorf("tag name cannot contain commas")
+	}
+	return name, nil
+}
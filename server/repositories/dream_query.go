@@ -0,0 +1,225 @@
+package repositories
+
+import (
+	"sort"
+	"time"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+// SortOrder is the order dreams are listed in, by creation time
+type SortOrder string
+
+const (
+	SortNewest SortOrder = "desc"
+	SortOldest SortOrder = "asc"
+)
+
+// TagMode controls how multiple tag filters combine
+type TagMode string
+
+const (
+	// TagModeAnd matches dreams that have every requested tag
+	TagModeAnd TagMode = "and"
+	// TagModeOr matches dreams that have at least one requested tag
+	TagModeOr TagMode = "or"
+)
+
+var (
+	// FlagColumns are the boolean columns dreams can be filtered by
+	FlagColumns = []string{"lucid", "nightmare", "recurring"}
+	// RatingColumns are the rating columns dreams can be filtered by range
+	RatingColumns = []string{"mood", "vividness", "sleep_quality"}
+)
+
+// DreamCursor marks the position after the last dream of a page
+type DreamCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+// RatingRange filters a rating column to an inclusive range
+type RatingRange struct {
+	Column string
+	Min    int
+	Max    int
+}
+
+// DreamListQuery holds the pagination, sorting and filter options for listing dreams
+type DreamListQuery struct {
+	Limit    int
+	Cursor   *DreamCursor
+	Order    SortOrder
+	From     *time.Time
+	To       *time.Time
+	HasImage *bool
+	Tags     []string
+	TagMode  TagMode
+
+	// Structured metadata filters
+	Flags      map[string]bool // lucid, nightmare and recurring
+	DreamtFrom *models.Date
+	DreamtTo   *models.Date
+	Ratings    []RatingRange
+
+	// NightFrom and NightTo filter by the night of the dream, which is its dreamt on date or,
+	// when it has none, the UTC day it was written
+	NightFrom *models.Date
+	NightTo   *models.Date
+}
+
+// apply adds the filters, keyset condition, ordering and limit to the query.
+// One extra row is requested to detect whether another page exists.
+func (q DreamListQuery) apply(db *gorm.DB) *gorm.DB {
+	if q.From != nil {
+		db = db.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("created_at <= ?", *q.To)
+	}
+	if q.HasImage != nil {
+		if *q.HasImage {
+			db = db.Where("image_url IS NOT NULL AND image_url <> ''")
+		} else {
+			db = db.Where("(image_url IS NULL OR image_url = '')")
+		}
+	}
+
+	for _, column := range FlagColumns {
+		if flag, ok := q.Flags[column]; ok {
+			db = db.Where(column+" = ?", flag)
+		}
+	}
+	if q.DreamtFrom != nil {
+		db = db.Where("dreamt_on >= ?", *q.DreamtFrom)
+	}
+	if q.DreamtTo != nil {
+		db = db.Where("dreamt_on <= ?", *q.DreamtTo)
+	}
+	for _, rating := range q.Ratings {
+		db = db.Where(rating.Column+" BETWEEN ? AND ?", rating.Min, rating.Max)
+	}
+	if q.NightFrom != nil {
+		db = db.Where("(dreamt_on >= ? OR (dreamt_on IS NULL AND created_at >= ?))", *q.NightFrom, q.NightFrom.Time)
+	}
+	if q.NightTo != nil {
+		db = db.Where("(dreamt_on <= ? OR (dreamt_on IS NULL AND created_at < ?))", *q.NightTo, q.NightTo.AddDate(0, 0, 1))
+	}
+
+	if len(q.Tags) > 0 {
+		tagged := db.Session(&gorm.Session{NewDB: true}).
+			Table("dream_tags").
+			Select("dream_tags.dream_id").
+			Joins("JOIN tags ON tags.id = dream_tags.tag_id").
+			Where("tags.name IN ?", q.Tags)
+		if q.TagMode == TagModeAnd {
+			tagged = tagged.Group("dream_tags.dream_id").Having("COUNT(DISTINCT tags.id) = ?", len(q.Tags))
+		}
+		db = db.Where("id IN (?)", tagged)
+	}
+
+	if q.Order == SortOldest {
+		if q.Cursor != nil {
+			db = db.Where("(created_at > ? OR (created_at = ? AND id > ?))", q.Cursor.CreatedAt, q.Cursor.CreatedAt, q.Cursor.ID)
+		}
+		db = db.Order("created_at ASC").Order("id ASC")
+	} else {
+		if q.Cursor != nil {
+			db = db.Where("(created_at < ? OR (created_at = ? AND id < ?))", q.Cursor.CreatedAt, q.Cursor.CreatedAt, q.Cursor.ID)
+		}
+		db = db.Order("created_at DESC").Order("id DESC")
+	}
+
+	return db.Limit(q.Limit + 1)
+}
+
+// matches reports whether the dream passes the filters and lies after the cursor.
+// It mirrors apply for the in-memory repository.
+func (q DreamListQuery) matches(d models.Dream) bool {
+	if q.From != nil && d.CreatedAt.Before(*q.From) {
+		return false
+	}
+	if q.To != nil && d.CreatedAt.After(*q.To) {
+		return false
+	}
+	if q.HasImage != nil && *q.HasImage != (d.ImageURL != "") {
+		return false
+	}
+
+	flags := map[string]bool{"lucid": d.Lucid, "nightmare": d.Nightmare, "recurring": d.Recurring}
+	for column, flag := range q.Flags {
+		if flags[column] != flag {
+			return false
+		}
+	}
+	if q.DreamtFrom != nil && (d.DreamtOn == nil || d.DreamtOn.Before(q.DreamtFrom.Time)) {
+		return false
+	}
+	if q.DreamtTo != nil && (d.DreamtOn == nil || d.DreamtOn.After(q.DreamtTo.Time)) {
+		return false
+	}
+	night := models.NewDate(d.CreatedAt.UTC())
+	if d.DreamtOn != nil {
+		night = *d.DreamtOn
+	}
+	if q.NightFrom != nil && night.Before(q.NightFrom.Time) {
+		return false
+	}
+	if q.NightTo != nil && night.After(q.NightTo.Time) {
+		return false
+	}
+	ratings := map[string]*int{"mood": d.Mood, "vividness": d.Vividness, "sleep_quality": d.SleepQuality}
+	for _, rating := range q.Ratings {
+		value := ratings[rating.Column]
+		if value == nil || *value < rating.Min || *value > rating.Max {
+			return false
+		}
+	}
+
+	if len(q.Tags) > 0 {
+		names := make(map[string]bool, len(d.Tags))
+		for _, tag := range d.Tags {
+			names[tag.Name] = true
+		}
+		found := 0
+		for _, name := range q.Tags {
+			if names[name] {
+				found++
+			}
+		}
+		if found == 0 || (q.TagMode == TagModeAnd && found < len(q.Tags)) {
+			return false
+		}
+	}
+
+	if q.Cursor != nil {
+		position := DreamCursor{d.CreatedAt, d.ID}
+		if q.Order == SortOldest {
+			return dreamBefore(*q.Cursor, position)
+		}
+		return dreamBefore(position, *q.Cursor)
+	}
+	return true
+}
+
+// sort orders dreams the way apply does
+func (q DreamListQuery) sort(dreams []models.Dream) {
+	sort.Slice(dreams, func(i, j int) bool {
+		a := DreamCursor{dreams[i].CreatedAt, dreams[i].ID}
+		b := DreamCursor{dreams[j].CreatedAt, dreams[j].ID}
+		if q.Order == SortOldest {
+			return dreamBefore(a, b)
+		}
+		return dreamBefore(b, a)
+	})
+}
+
+// dreamBefore reports whether a comes before b in ascending (created_at, id) order
+func dreamBefore(a, b DreamCursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
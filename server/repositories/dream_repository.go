@@ -1,28 +1,57 @@
 package repositories
 
 import (
-	"dreams/models"
+	"context"
+	"errors"
 
-	"gorm.io/gorm"
+	"dreams/models"
 )
 
-type DreamRepository struct {
-	db *gorm.DB
-}
+var (
+	// ErrNotFound is returned when no dream or revision matches
+	ErrNotFound = errors.New("not found")
+	// ErrVersionConflict is returned when a dream changed since the expected version was read
+	ErrVersionConflict = errors.New("dream was modified by another request")
+	// ErrSearchUnsupported is returned by Search when the database has no full-text search
+	ErrSearchUnsupported = errors.New("full-text search is not supported by this database")
+)
 
-func NewDreamRepository(db *gorm.DB) *DreamRepository {
-	return &DreamRepository{db: db}
+// DreamRepository stores dreams and their revisions
+type DreamRepository interface {
+	// Get returns the dream with its tags, or ErrNotFound
+	Get(ctx context.Context, id uint) (models.Dream, error)
+	// List returns the dreams matching the query in order. Up to Limit+1 dreams are returned
+	// so callers can tell whether another page exists.
+	List(ctx context.Context, query DreamListQuery) ([]models.Dream, error)
+	// Search ranks dreams against a websearch-style query like "flooded school" -teacher.
+	// Like List, up to limit+1 results are returned.
+	Search(ctx context.Context, text string, limit, offset int) ([]DreamSearchResult, error)
+	// Create saves a new dream at version 1 and records its first revision. Tags are matched
+	// by name, and timestamps that are already set are kept.
+	Create(ctx context.Context, dream *models.Dream) error
+	// Update saves the editable fields of the dream and bumps its version, provided the stored
+	// version is still version. A revision is recorded when the text changes. On success the
+	// dream is reloaded with its tags.
+	Update(ctx context.Context, dream *models.Dream, version uint) error
+	// Delete soft-deletes the dream, provided the stored version is still version
+	Delete(ctx context.Context, id, version uint) error
+	// SetImage sets the generated image. It doesn't bump the edit version, so pending edits
+	// still apply.
+	SetImage(ctx context.Context, id uint, url string, variants models.ImageVariants) error
+	// Revisions returns the stored revisions of a dream, newest first
+	Revisions(ctx context.Context, dreamID uint) ([]models.DreamRevision, error)
+	// Revision returns one revision of a dream, or the latest when version is 0
+	Revision(ctx context.Context, dreamID, version uint) (models.DreamRevision, error)
 }
 
-func (r *DreamRepository) Create(content string) error {
-	dream := models.Dream{
-		Dream: content,
-	}
-	return r.db.Create(&dream).Error
+// DreamSearchResult is a single ranked search hit
+type DreamSearchResult struct {
+	Dream models.Dream `json:"dream"`
+	Rank  float64      `json:"rank"`
+	// Snippet is HTML-escaped dream text with matches wrapped in <mark> tags
+	Snippet string `json:"snippet"`
 }
 
-func (r *DreamRepository) FindAll() ([]models.Dream, error) {
-	var dreams []models.Dream
-	err := r.db.Find(&dreams).Error
-	return dreams, err
-}
+// EditableColumns are the columns Update writes. They are also the JSON fields clients can
+// change, so a field is editable through the API exactly when it is saved.
+var EditableColumns = []string{"dream", "dreamt_on", "lucid", "nightmare", "recurring", "mood", "vividness", "sleep_quality"}
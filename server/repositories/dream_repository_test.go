@@ -0,0 +1,253 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dreams/database"
+	"dreams/migrations"
+	"dreams/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// forEachRepository runs the test against the GORM repository on SQLite and the in-memory
+// repository, so the two stay interchangeable
+func forEachRepository(t *testing.T, test func(t *testing.T, repo DreamRepository)) {
+	t.Run("gorm", func(t *testing.T) {
+		db, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "dreams.db"), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		migrator, err := migrations.New(db)
+		if err != nil {
+			t.Fatalf("failed to load migrations: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("failed to migrate database: %v", err)
+		}
+		test(t, NewDreamRepository(db))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryDreamRepository())
+	})
+}
+
+func TestDreamRepositoryUpdateAndRevisions(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo DreamRepository) {
+		ctx := context.Background()
+		dream := models.Dream{Dream: "A house with too many stairs"}
+		if err := repo.Create(ctx, &dream); err != nil || dream.ID == 0 || dream.Version != 1 {
+			t.Fatalf("failed to create dream: %v %+v", err, dream)
+		}
+
+		edit := dream
+		edit.Dream = "A house with endless stairs"
+		edit.Lucid = true
+		if err := repo.Update(ctx, &edit, 1); err != nil {
+			t.Fatalf("failed to update dream: %v", err)
+		}
+		if edit.Version != 2 || !edit.Lucid {
+			t.Errorf("expected the reloaded dream at version 2, got %+v", edit)
+		}
+
+		stale := dream
+		stale.Dream = "Overwritten"
+		if err := repo.Update(ctx, &stale, 1); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("expected ErrVersionConflict for a stale update, got %v", err)
+		}
+
+		// Image generation doesn't bump the version
+		if err := repo.SetImage(ctx, dream.ID, "/images/a.png", models.ImageVariants{"thumbnail": "/images/a_thumbnail.png"}); err != nil {
+			t.Fatalf("failed to set image: %v", err)
+		}
+		got, err := repo.Get(ctx, dream.ID)
+		if err != nil || got.ImageURL != "/images/a.png" || got.ImageVariants["thumbnail"] == "" || got.Version != 2 || got.Dream != edit.Dream {
+			t.Errorf("unexpected dream after setting the image: %v %+v", err, got)
+		}
+
+		revisions, err := repo.Revisions(ctx, dream.ID)
+		if err != nil || len(revisions) != 2 || revisions[0].Version != 2 || revisions[1].Dream != "A house with too many stairs" {
+			t.Errorf("expected revisions 2 and 1, got %v %+v", err, revisions)
+		}
+		if latest, err := repo.Revision(ctx, dream.ID, 0); err != nil || latest.Version != 2 {
+			t.Errorf("expected latest revision 2, got %v %+v", err, latest)
+		}
+		if _, err := repo.Revision(ctx, dream.ID, 5); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a missing revision, got %v", err)
+		}
+
+		if err := repo.Delete(ctx, dream.ID, 1); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("expected ErrVersionConflict for a stale delete, got %v", err)
+		}
+		if err := repo.Delete(ctx, dream.ID, 2); err != nil {
+			t.Fatalf("failed to delete dream: %v", err)
+		}
+		if _, err := repo.Get(ctx, dream.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound after delete, got %v", err)
+		}
+		if err := repo.Delete(ctx, dream.ID, 2); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+		}
+		if err := repo.SetImage(ctx, 999, "/images/b.png", nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound setting the image of a missing dream, got %v", err)
+		}
+	})
+}
+
+func TestDreamRepositoryList(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo DreamRepository) {
+		ctx := context.Background()
+		mood := 4
+		dreams := []models.Dream{
+			{Dream: "Flying over the sea", Lucid: true, Tags: []models.Tag{{Name: "flying"}, {Name: "sea"}}},
+			{Dream: "Chased through a mall", Nightmare: true, Mood: &mood},
+			{Dream: "Flying to school", ImageURL: "/images/c.png"},
+			{Dream: "Missing an exam"},
+		}
+		for i := range dreams {
+			if i == 2 {
+				// Reuse the stored tag rather than creating a duplicate
+				dreams[i].Tags = []models.Tag{dreams[0].Tags[0]}
+			}
+			if err := repo.Create(ctx, &dreams[i]); err != nil {
+				t.Fatalf("failed to create dream: %v", err)
+			}
+			// Distinct timestamps keep the order independent of the clock resolution
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		ids := func(query DreamListQuery) []uint {
+			t.Helper()
+			found, err := repo.List(ctx, query)
+			if err != nil {
+				t.Fatalf("failed to list dreams: %v", err)
+			}
+			var ids []uint
+			for _, dream := range found {
+				ids = append(ids, dream.ID)
+			}
+			return ids
+		}
+		yes := true
+
+		tests := []struct {
+			name  string
+			query DreamListQuery
+			want  []uint
+		}{
+			{"newest first with an extra row", DreamListQuery{Limit: 2}, []uint{dreams[3].ID, dreams[2].ID, dreams[1].ID}},
+			{"oldest first", DreamListQuery{Limit: 10, Order: SortOldest}, []uint{dreams[0].ID, dreams[1].ID, dreams[2].ID, dreams[3].ID}},
+			{"after cursor", DreamListQuery{Limit: 10, Cursor: &DreamCursor{CreatedAt: dreams[2].CreatedAt, ID: dreams[2].ID}}, []uint{dreams[1].ID, dreams[0].ID}},
+			{"all tags", DreamListQuery{Limit: 10, Tags: []string{"flying", "sea"}, TagMode: TagModeAnd}, []uint{dreams[0].ID}},
+			{"any tag", DreamListQuery{Limit: 10, Tags: []string{"flying", "sea"}, TagMode: TagModeOr}, []uint{dreams[2].ID, dreams[0].ID}},
+			{"flag", DreamListQuery{Limit: 10, Flags: map[string]bool{"nightmare": true}}, []uint{dreams[1].ID}},
+			{"rating", DreamListQuery{Limit: 10, Ratings: []RatingRange{{Column: "mood", Min: 3, Max: 5}}}, []uint{dreams[1].ID}},
+			{"has image", DreamListQuery{Limit: 10, HasImage: &yes}, []uint{dreams[2].ID}},
+		}
+		for _, tt := range tests {
+			if got := ids(tt.query); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+}
+
+func TestDreamRepositorySearch(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo DreamRepository) {
+		ctx := context.Background()
+		var dreams []models.Dream
+		for _, text := range []string{"The school was flooded", "A flooded <cellar>", "The school bus", "A flooded garden"} {
+			dream := models.Dream{Dream: text}
+			repo.Create(ctx, &dream)
+			dreams = append(dreams, dream)
+		}
+		if err := repo.Delete(ctx, dreams[3].ID, dreams[3].Version); err != nil {
+			t.Fatalf("failed to delete dream: %v", err)
+		}
+
+		results, err := repo.Search(ctx, "flooded -school", 10, 0)
+		if err != nil || len(results) != 1 {
+			t.Fatalf("expected one result, got %v %+v", err, results)
+		}
+		if want := "A <mark>flooded</mark> &lt;cellar&gt;"; results[0].Snippet != want {
+			t.Errorf("expected snippet %q, got %q", want, results[0].Snippet)
+		}
+
+		results, err = repo.Search(ctx, "school", 1, 0)
+		if err != nil || len(results) != 2 {
+			t.Errorf("expected a second result to signal another page, got %v %+v", err, results)
+		}
+	})
+}
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"flooded school", `(("flooded" "school"))`},
+		{`"flooded school" -teacher or swimming`, `(("flooded school") OR ("swimming")) NOT "teacher"`},
+		{`say "hi`, `(("say" "hi"))`},
+		{`NEAR(a b) AND *`, `(("NEAR(a" "b)" "AND"))`},
+		{`quote"s`, `(("quote""s"))`},
+		{"-school", ""},
+		{"or", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ftsQuery(tt.text); got != tt.want {
+			t.Errorf("ftsQuery(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDreamRepositoryListByNight(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, repo DreamRepository) {
+		ctx := context.Background()
+		may, june := models.NewDate(time.Date(2020, 5, 14, 0, 0, 0, 0, time.UTC)), models.NewDate(time.Date(2020, 6, 2, 0, 0, 0, 0, time.UTC))
+		dreams := []models.Dream{
+			{Dream: "A May dream written down late", DreamtOn: &may},
+			{Dream: "A June dream", DreamtOn: &june},
+			{Dream: "Written this morning"},
+		}
+		for i := range dreams {
+			if err := repo.Create(ctx, &dreams[i]); err != nil {
+				t.Fatalf("failed to create dream: %v", err)
+			}
+		}
+
+		mayStart, mayEnd := models.NewDate(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)), models.NewDate(time.Date(2020, 5, 31, 0, 0, 0, 0, time.UTC))
+		today := models.NewDate(time.Now().UTC())
+		tests := []struct {
+			name  string
+			query DreamListQuery
+			want  []uint
+		}{
+			{"dreamt in May", DreamListQuery{NightFrom: &mayStart, NightTo: &mayEnd}, []uint{dreams[0].ID}},
+			{"since June", DreamListQuery{NightFrom: &june}, []uint{dreams[1].ID, dreams[2].ID}},
+			{"written today", DreamListQuery{NightFrom: &today, NightTo: &today}, []uint{dreams[2].ID}},
+		}
+		for _, tt := range tests {
+			tt.query.Limit = 10
+			tt.query.Order = SortOldest
+			found, err := repo.List(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("failed to list dreams: %v", err)
+			}
+			var got []uint
+			for _, dream := range found {
+				got = append(got, dream.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+}
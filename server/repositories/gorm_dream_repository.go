@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+// gormDreamRepository implements DreamRepository with GORM
+type gormDreamRepository struct {
+	db *gorm.DB
+}
+
+// NewDreamRepository creates a DreamRepository backed by the database
+func NewDreamRepository(db *gorm.DB) DreamRepository {
+	return &gormDreamRepository{db: db}
+}
+
+func (r *gormDreamRepository) Get(ctx context.Context, id uint) (models.Dream, error) {
+	var dream models.Dream
+	err := r.db.WithContext(ctx).Preload("Tags").First(&dream, id).Error
+	return dream, notFound(err)
+}
+
+func (r *gormDreamRepository) List(ctx context.Context, query DreamListQuery) ([]models.Dream, error) {
+	var dreams []models.Dream
+	err := query.apply(r.db.WithContext(ctx).Preload("Tags")).Find(&dreams).Error
+	return dreams, err
+}
+
+// searchSQL ranks dreams against a websearch-style query ("flooded school" -teacher or swimming).
+// The dream text is HTML-escaped before ts_headline so the snippet is safe to render.
+const searchSQL = `
+SELECT dreams.*,
+	ts_rank(dreams.search_vector, query) AS rank,
+	ts_headline('` + models.SearchConfig + `',
+		replace(replace(replace(dreams.dream, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+		query,
+		'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=25, MinWords=8') AS snippet
+FROM dreams, websearch_to_tsquery('` + models.SearchConfig + `', ?) AS query
+WHERE dreams.deleted_at IS NULL AND dreams.search_vector @@ query
+ORDER BY rank DESC, dreams.created_at DESC, dreams.id DESC
+LIMIT ? OFFSET ?`
+
+// dreamSearchRow is what the search query scans into
+type dreamSearchRow struct {
+	models.Dream
+	Rank    float64
+	Snippet string
+}
+
+func (r *gormDreamRepository) Search(ctx context.Context, text string, limit, offset int) ([]DreamSearchResult, error) {
+	var rows []dreamSearchRow
+	switch r.db.Dialector.Name() {
+	case "postgres":
+		if err := r.db.WithContext(ctx).Raw(searchSQL, text, limit+1, offset).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+	case "sqlite":
+		var err error
+		if rows, err = r.searchSQLite(ctx, text, limit, offset); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrSearchUnsupported
+	}
+
+	results := make([]DreamSearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, DreamSearchResult{Dream: row.Dream, Rank: row.Rank, Snippet: row.Snippet})
+	}
+	return results, nil
+}
+
+func (r *gormDreamRepository) Create(ctx context.Context, dream *models.Dream) error {
+	dream.Version = 1
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Tags are matched by name so existing tags are linked rather than duplicated
+		for i := range dream.Tags {
+			if dream.Tags[i].ID == 0 {
+				if err := tx.Where(models.Tag{Name: dream.Tags[i].Name}).FirstOrCreate(&dream.Tags[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Create(dream).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, *dream)
+	})
+}
+
+func (r *gormDreamRepository) Update(ctx context.Context, dream *models.Dream, version uint) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var previous models.Dream
+		if err := tx.First(&previous, dream.ID).Error; err != nil {
+			return notFound(err)
+		}
+
+		changes := *dream
+		changes.Version = version + 1
+		// The version condition makes the check and the write atomic
+		result := tx.Model(&models.Dream{}).
+			Where("id = ? AND version = ?", dream.ID, version).
+			Select(append(EditableColumns, "version")).
+			Updates(&changes)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		if changes.Dream == previous.Dream {
+			return nil
+		}
+		// Dreams created before revisions were tracked get their original text saved first
+		var count int64
+		if err := tx.Model(&models.DreamRevision{}).Where("dream_id = ?", previous.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := recordRevision(tx, previous); err != nil {
+				return err
+			}
+		}
+		return recordRevision(tx, changes)
+	})
+	if err != nil {
+		return err
+	}
+
+	reloaded, err := r.Get(ctx, dream.ID)
+	if err != nil {
+		return err
+	}
+	*dream = reloaded
+	return nil
+}
+
+func (r *gormDreamRepository) Delete(ctx context.Context, id, version uint) error {
+	result := r.db.WithContext(ctx).Where("version = ?", version).Delete(&models.Dream{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Tell a missing dream apart from one that was changed
+		if _, err := r.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *gormDreamRepository) SetImage(ctx context.Context, id uint, url string, variants models.ImageVariants) error {
+	result := r.db.WithContext(ctx).Model(&models.Dream{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"image_url":      url,
+			"image_variants": variants,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormDreamRepository) Revisions(ctx context.Context, dreamID uint) ([]models.DreamRevision, error) {
+	revisions := []models.DreamRevision{}
+	err := r.db.WithContext(ctx).Where("dream_id = ?", dreamID).Order("version DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+func (r *gormDreamRepository) Revision(ctx context.Context, dreamID, version uint) (models.DreamRevision, error) {
+	var revision models.DreamRevision
+	query := r.db.WithContext(ctx).Where("dream_id = ?", dreamID)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	err := query.Order("version DESC").First(&revision).Error
+	return revision, notFound(err)
+}
+
+// recordRevision stores the text of the dream at its current version, if not already stored
+func recordRevision(tx *gorm.DB, dream models.Dream) error {
+	revision := models.DreamRevision{DreamID: dream.ID, Version: dream.Version, Dream: dream.Dream}
+	return tx.Where(models.DreamRevision{DreamID: dream.ID, Version: dream.Version}).
+		FirstOrCreate(&revision).Error
+}
+
+// notFound translates GORM's not found error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,272 @@
+package repositories
+
+import (
+	"context"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryDreamRepository implements DreamRepository in memory. It is intended for tests.
+type MemoryDreamRepository struct {
+	mu        sync.Mutex
+	dreams    map[uint]models.Dream
+	revisions map[uint][]models.DreamRevision
+	nextID    uint
+}
+
+// NewMemoryDreamRepository creates an empty in-memory repository
+func NewMemoryDreamRepository() *MemoryDreamRepository {
+	return &MemoryDreamRepository{
+		dreams:    make(map[uint]models.Dream),
+		revisions: make(map[uint][]models.DreamRevision),
+		nextID:    1,
+	}
+}
+
+func (r *MemoryDreamRepository) Get(ctx context.Context, id uint) (models.Dream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.get(id)
+}
+
+func (r *MemoryDreamRepository) get(id uint) (models.Dream, error) {
+	dream, ok := r.dreams[id]
+	if !ok || dream.DeletedAt.Valid {
+		return models.Dream{}, ErrNotFound
+	}
+	return copyDream(dream), nil
+}
+
+func (r *MemoryDreamRepository) List(ctx context.Context, query DreamListQuery) ([]models.Dream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var dreams []models.Dream
+	for _, dream := range r.dreams {
+		if !dream.DeletedAt.Valid && query.matches(dream) {
+			dreams = append(dreams, copyDream(dream))
+		}
+	}
+	query.sort(dreams)
+	if len(dreams) > query.Limit+1 {
+		dreams = dreams[:query.Limit+1]
+	}
+	return dreams, nil
+}
+
+// Search matches every term of the query as a case-insensitive substring and excludes
+// terms prefixed with "-". It only approximates the Postgres search, which stems words.
+func (r *MemoryDreamRepository) Search(ctx context.Context, text string, limit, offset int) ([]DreamSearchResult, error) {
+	var include, exclude []string
+	for _, term := range strings.Fields(strings.ToLower(strings.ReplaceAll(text, `"`, ""))) {
+		if strings.HasPrefix(term, "-") {
+			if term = strings.TrimPrefix(term, "-"); term != "" {
+				exclude = append(exclude, term)
+			}
+		} else if term != "or" {
+			include = append(include, term)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var results []DreamSearchResult
+	for _, dream := range r.dreams {
+		if dream.DeletedAt.Valid {
+			continue
+		}
+		lower := strings.ToLower(dream.Dream)
+		hits := 0
+		for _, term := range include {
+			if n := strings.Count(lower, term); n > 0 {
+				hits += n
+			} else {
+				hits = -1
+				break
+			}
+		}
+		for _, term := range exclude {
+			if strings.Contains(lower, term) {
+				hits = -1
+			}
+		}
+		if hits <= 0 {
+			continue
+		}
+		results = append(results, DreamSearchResult{
+			Dream:   copyDream(dream),
+			Rank:    float64(hits) / float64(len(strings.Fields(lower))),
+			Snippet: highlight(dream.Dream, include),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return dreamBefore(DreamCursor{results[j].Dream.CreatedAt, results[j].Dream.ID}, DreamCursor{results[i].Dream.CreatedAt, results[i].Dream.ID})
+	})
+	if offset >= len(results) {
+		return []DreamSearchResult{}, nil
+	}
+	results = results[offset:]
+	if len(results) > limit+1 {
+		results = results[:limit+1]
+	}
+	return results, nil
+}
+
+// highlight HTML-escapes the text and wraps the terms in <mark> tags
+func highlight(text string, terms []string) string {
+	escaped := html.EscapeString(text)
+	if len(terms) == 0 {
+		return escaped
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(html.EscapeString(term))
+	}
+	pattern := regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)`)
+	return pattern.ReplaceAllString(escaped, "<mark>$1</mark>")
+}
+
+func (r *MemoryDreamRepository) Create(ctx context.Context, dream *models.Dream) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Like GORM, timestamps that are already set are kept, which imports rely on
+	now := time.Now()
+	dream.ID = r.nextID
+	if dream.CreatedAt.IsZero() {
+		dream.CreatedAt = now
+	}
+	if dream.UpdatedAt.IsZero() {
+		dream.UpdatedAt = now
+	}
+	dream.Version = 1
+	r.nextID++
+
+	r.dreams[dream.ID] = copyDream(*dream)
+	r.recordRevision(*dream)
+	return nil
+}
+
+func (r *MemoryDreamRepository) Update(ctx context.Context, dream *models.Dream, version uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, err := r.get(dream.ID)
+	if err != nil {
+		return err
+	}
+	if previous.Version != version {
+		return ErrVersionConflict
+	}
+
+	updated := previous
+	updated.Dream = dream.Dream
+	updated.DreamtOn = dream.DreamtOn
+	updated.Lucid = dream.Lucid
+	updated.Nightmare = dream.Nightmare
+	updated.Recurring = dream.Recurring
+	updated.Mood = dream.Mood
+	updated.Vividness = dream.Vividness
+	updated.SleepQuality = dream.SleepQuality
+	updated.Version = version + 1
+	updated.UpdatedAt = time.Now()
+	r.dreams[dream.ID] = updated
+
+	if updated.Dream != previous.Dream {
+		r.recordRevision(updated)
+	}
+	*dream = copyDream(updated)
+	return nil
+}
+
+func (r *MemoryDreamRepository) Delete(ctx context.Context, id, version uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dream, err := r.get(id)
+	if err != nil {
+		return err
+	}
+	if dream.Version != version {
+		return ErrVersionConflict
+	}
+	dream.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.dreams[id] = dream
+	return nil
+}
+
+func (r *MemoryDreamRepository) SetImage(ctx context.Context, id uint, url string, variants models.ImageVariants) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dream, err := r.get(id)
+	if err != nil {
+		return err
+	}
+	dream.ImageURL = url
+	dream.ImageVariants = variants
+	r.dreams[id] = dream
+	return nil
+}
+
+func (r *MemoryDreamRepository) Revisions(ctx context.Context, dreamID uint) ([]models.DreamRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.revisions[dreamID]
+	revisions := make([]models.DreamRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+	return revisions, nil
+}
+
+func (r *MemoryDreamRepository) Revision(ctx context.Context, dreamID, version uint) (models.DreamRevision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.revisions[dreamID]
+	for i := len(stored) - 1; i >= 0; i-- {
+		if version == 0 || stored[i].Version == version {
+			return stored[i], nil
+		}
+	}
+	return models.DreamRevision{}, ErrNotFound
+}
+
+// recordRevision appends a revision, keeping them in version order. Callers hold the lock.
+func (r *MemoryDreamRepository) recordRevision(dream models.Dream) {
+	r.revisions[dream.ID] = append(r.revisions[dream.ID], models.DreamRevision{
+		ID:        uint(len(r.revisions[dream.ID]) + 1),
+		DreamID:   dream.ID,
+		Version:   dream.Version,
+		Dream:     dream.Dream,
+		CreatedAt: time.Now(),
+	})
+}
+
+// copyDream copies the slices and maps of a dream so callers can't modify stored dreams
+func copyDream(d models.Dream) models.Dream {
+	d.Tags = append([]models.Tag(nil), d.Tags...)
+	if d.ImageVariants != nil {
+		variants := make(models.ImageVariants, len(d.ImageVariants))
+		for name, url := range d.ImageVariants {
+			variants[name] = url
+		}
+		d.ImageVariants = variants
+	}
+	return d
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// sqliteSearchSQL is the SQLite equivalent of searchSQL using the dreams_fts FTS5 table.
+// bm25 scores are negative with the best match lowest, so they're negated into a rank.
+// The snippet is marked with control characters and HTML-escaped afterwards.
+const sqliteSearchSQL = `
+SELECT dreams.*,
+	-bm25(dreams_fts) AS rank,
+	snippet(dreams_fts, 0, char(2), char(3), ' ... ', 25) AS snippet
+FROM dreams_fts
+JOIN dreams ON dreams.id = dreams_fts.rowid
+WHERE dreams_fts MATCH ? AND dreams.deleted_at IS NULL
+ORDER BY rank DESC, dreams.created_at DESC, dreams.id DESC
+LIMIT ? OFFSET ?`
+
+// searchTokenPattern splits a websearch-style query into optionally negated words and
+// quoted phrases
+var searchTokenPattern = regexp.MustCompile(`-?"[^"]*"?|\S+`)
+
+func (r *gormDreamRepository) searchSQLite(ctx context.Context, text string, limit, offset int) ([]dreamSearchRow, error) {
+	query := ftsQuery(text)
+	if query == "" {
+		return nil, nil
+	}
+
+	var rows []dreamSearchRow
+	if err := r.db.WithContext(ctx).Raw(sqliteSearchSQL, query, limit+1, offset).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Snippet = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(rows[i].Snippet))
+	}
+	return rows, nil
+}
+
+// ftsQuery translates the websearch syntax accepted by Postgres ("flooded school" -teacher
+// or swimming) into an FTS5 query. Every term is quoted so user input can't inject FTS5
+// operators. It returns an empty string when nothing can match.
+func ftsQuery(text string) string {
+	var groups [][]string
+	var current, exclude []string
+	for _, token := range searchTokenPattern.FindAllString(text, -1) {
+		negated := strings.HasPrefix(token, "-")
+		token = strings.TrimPrefix(token, "-")
+		if !negated && strings.EqualFold(token, "or") {
+			if len(current) > 0 {
+				groups = append(groups, current)
+				current = nil
+			}
+			continue
+		}
+
+		token = strings.Trim(token, `"`)
+		if !strings.ContainsFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			continue
+		}
+		quoted := `"` + strings.ReplaceAll(token, `"`, `""`) + `"`
+		if negated {
+			exclude = append(exclude, quoted)
+		} else {
+			current = append(current, quoted)
+		}
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	if len(groups) == 0 {
+		return ""
+	}
+
+	alternatives := make([]string, len(groups))
+	for i, group := range groups {
+		alternatives[i] = "(" + strings.Join(group, " ") + ")"
+	}
+	query := "(" + strings.Join(alternatives, " OR ") + ")"
+	for _, term := range exclude {
+		query += " NOT " + term
+	}
+	return query
+}
@@ -7,10 +7,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"net/http"
 	"time"
 
+	"dreams/models"
 	"dreams/services/storage"
 )
 
@@ -44,7 +46,16 @@ func NewAIService(host string, endpoint string, model string, storageProvider st
 	}
 }
 
-func (s *AIService) GenerateImage(dreamContent string) (string, error) {
+// GeneratedImage is the result of a successful image generation
+type GeneratedImage struct {
+	URL      string
+	Variants map[string]string // Variant name to URL, see ImageVariant
+}
+
+// defaultNegativePrompt steers the model away from common generation artifacts
+const defaultNegativePrompt = "text, watermark, signature, blurry, low quality, deformed"
+
+func (s *AIService) GenerateImage(dream models.Dream) (*GeneratedImage, error) {
 	// Create a prompt for InvokeAI
 	prompt := fmt.Sprintf(`
 A surreal dream-like scene featuring:
@@ -54,17 +65,20 @@ A surreal dream-like scene featuring:
 - Use vibrant colors and imaginative elements
 - Composition: balanced and visually interesting
 
-Generate this as a high-quality PNG image.`, dreamContent)
+Generate this as a high-quality PNG image.`, dream.Dream)
 
 	req := ImageGenerationRequest{
-		Model:  s.model,
-		Prompt: prompt,
+		Model:          s.model,
+		Prompt:         prompt,
+		NegativePrompt: defaultNegativePrompt,
+		// Pick the seed ourselves so it can be recorded with the image
+		Seed: rand.Int63n(1 << 32),
 	}
 
 	// Convert request to JSON
 	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Build the full URL using host and endpoint
@@ -73,7 +87,7 @@ Generate this as a high-quality PNG image.`, dreamContent)
 	// Create HTTP request
 	resp, err := s.client.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	delay := 1 * time.Second
 	maxRetries := 3
@@ -90,14 +104,14 @@ Generate this as a high-quality PNG image.`, dreamContent)
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("failed after %d attempts: %w", maxRetries, err)
+		return nil, fmt.Errorf("failed after %d attempts: %w", maxRetries, err)
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("AI service returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("AI service returned status %d: %s", resp.StatusCode, string(body))
 	}
 
 	// Read response
@@ -109,29 +123,39 @@ Generate this as a high-quality PNG image.`, dreamContent)
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("error decoding response: %w", err)
+		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
 	if response.Error != "" {
-		return "", fmt.Errorf("AI service error: %s", response.Error)
+		return nil, fmt.Errorf("AI service error: %s", response.Error)
 	}
 
 	if len(response.Images) == 0 {
-		return "", fmt.Errorf("no images returned from AI service")
+		return nil, fmt.Errorf("no images returned from AI service")
 	}
 
 	// Save image
-	filename, err := s.saveImage(response.Images[0].Base64)
+	image, err := s.saveImage(response.Images[0].Base64, ImageProvenance{
+		Prompt:         req.Prompt,
+		NegativePrompt: req.NegativePrompt,
+		Model:          req.Model,
+		Seed:           req.Seed,
+		DreamID:        dream.ID,
+		CreatedAt:      time.Now(),
+		Generator:      provenanceGenerator,
+	})
 	if err != nil {
-		return "", fmt.Errorf("error saving image: %w", err)
+		return nil, fmt.Errorf("error saving image: %w", err)
 	}
 
-	return filename, nil
+	return image, nil
 }
 
 type ImageGenerationRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Seed           int64  `json:"seed"`
 }
 
 type ImageGenerationResponse struct {
@@ -140,23 +164,84 @@ type ImageGenerationResponse struct {
 	Status    string `json:"status,omitempty"`
 }
 
-// saveImage saves the image data to the configured storage provider
-func (s *AIService) saveImage(imageData string) (string, error) {
-	// Generate unique filename
-	filename := fmt.Sprintf("image_%d_%d.png", time.Now().Unix(), rand.Int63())
-
+// saveImage validates the image data, embeds its provenance and saves it and its resized
+// variants to the configured storage provider under content-addressed keys
+func (s *AIService) saveImage(imageData string, provenance ImageProvenance) (*GeneratedImage, error) {
 	// Decode base64 image data
 	decoded, err := base64.StdEncoding.DecodeString(imageData)
 	if err != nil {
-		return "", fmt.Errorf("error decoding base64 image: %w", err)
+		return nil, fmt.Errorf("error decoding base64 image: %w", err)
+	}
+
+	// Make sure the AI service really returned an image before storing anything
+	contentType, ext, err := storage.SniffImageType(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image data: %w", err)
+	}
+
+	// Record how the image was made so downloaded copies can be traced back to their dream
+	stored := decoded
+	if contentType == "image/png" {
+		stored, err = embedProvenance(decoded, provenance)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding image provenance: %w", err)
+		}
+	}
+
+	// The provenance differs on every call, with its seed and time, so the key hashes the
+	// rendered image alone. Identical renders then share one stored copy, which keeps the
+	// provenance of the dream that saved it first.
+	return storeImage(context.Background(), s.storageProvider, stored, storage.ContentKey(decoded, ext))
+}
+
+// StoreImage saves validated image data and its resized variants to the storage provider
+// under content-addressed keys
+func StoreImage(ctx context.Context, storageProvider storage.StorageProvider, data []byte) (*GeneratedImage, error) {
+	_, ext, err := storage.SniffImageType(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image data: %w", err)
+	}
+	// Identical bytes map to the same key, so duplicates are stored only once
+	return storeImage(ctx, storageProvider, data, storage.ContentKey(data, ext))
+}
+
+// storeImage saves image data and its variants under filename, a content key
+func storeImage(ctx context.Context, storageProvider storage.StorageProvider, data []byte, filename string) (*GeneratedImage, error) {
+	contentType, _, err := storage.SniffImageType(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image data: %w", err)
 	}
 
 	// Save image using the storage provider
-	_, err = s.storageProvider.SaveImage(context.Background(), decoded, filename)
+	key, err := storageProvider.SaveImage(ctx, data, filename)
+	if err != nil {
+		return nil, fmt.Errorf("error saving image: %w", err)
+	}
+
+	result := &GeneratedImage{
+		URL:      storageProvider.GetImageURL(key),
+		Variants: make(map[string]string),
+	}
+
+	// The standard library has no WebP decoder, so those images are served without variants
+	if contentType == "image/webp" {
+		return result, nil
+	}
+
+	// Variants are a nice-to-have, so failures are logged and the original is still returned
+	variants, err := renderVariants(data, key)
 	if err != nil {
-		return "", fmt.Errorf("error saving image: %w", err)
+		log.Printf("Error rendering variants for %s: %v", filename, err)
+		return result, nil
+	}
+	for _, variant := range variants {
+		variantKey, err := storageProvider.SaveImage(ctx, variant.data, variant.filename)
+		if err != nil {
+			log.Printf("Error saving %s variant for %s: %v", variant.name, filename, err)
+			continue
+		}
+		result.Variants[string(variant.name)] = storageProvider.GetImageURL(variantKey)
 	}
 
-	// Return the URL to the saved image
-	return s.storageProvider.GetImageURL(filename), nil
+	return result, nil
 }
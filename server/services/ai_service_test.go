@@ -0,0 +1,33 @@
+package services
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"dreams/services/storage"
+)
+
+func TestSaveImageSharesIdenticalRenders(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	s := &AIService{storageProvider: store}
+	render := base64.StdEncoding.EncodeToString(testPNG(t))
+
+	first, err := s.saveImage(render, ImageProvenance{Seed: 1, DreamID: 1, CreatedAt: time.Now(), Generator: provenanceGenerator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.saveImage(render, ImageProvenance{Seed: 2, DreamID: 2, CreatedAt: time.Now().Add(time.Minute), Generator: provenanceGenerator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.URL != second.URL {
+		t.Errorf("expected identical renders to share a key, got %s and %s", first.URL, second.URL)
+	}
+
+	key, _ := storage.ImageKey(store, first.URL)
+	data, _ := store.Object(key)
+	if provenance, err := ReadProvenance(data); err != nil || provenance == nil || provenance.DreamID != 1 {
+		t.Errorf("expected the first dream's provenance to be kept, got %+v (%v)", provenance, err)
+	}
+}
@@ -0,0 +1,68 @@
+// Package book renders dreams as a printable book, as EPUB or PDF, using only Go code
+// and the fonts bundled with golang.org/x/image.
+package book
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Book is a journal laid out as chapters of dated entries
+type Book struct {
+	Title    string
+	Subtitle string
+	Chapters []Chapter
+	// Image loads the image stored under an entry's ImageKey. Entries whose image fails
+	// to load are rendered without it.
+	Image func(ctx context.Context, key string) ([]byte, error)
+}
+
+// Chapter groups the entries of one month
+type Chapter struct {
+	Title   string
+	Entries []Entry
+}
+
+// Entry is one dream
+type Entry struct {
+	Date time.Time
+	Text string
+	// Notes are short labels shown under the date, such as tags and ratings
+	Notes    []string
+	ImageKey string
+}
+
+// Heading is the entry's date written out in full
+func (e Entry) Heading() string {
+	return e.Date.Format("Monday, 2 January 2006")
+}
+
+// paragraphBreak separates paragraphs in dream text
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// Paragraphs splits the text at blank lines and joins the lines within each paragraph
+func (e Entry) Paragraphs() []string {
+	var paragraphs []string
+	for _, paragraph := range paragraphBreak.Split(strings.ReplaceAll(e.Text, "\r\n", "\n"), -1) {
+		if paragraph = strings.Join(strings.Fields(paragraph), " "); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// loadImage fetches an entry's image, returning nil when it has none or it can't be read
+func (b Book) loadImage(ctx context.Context, entry Entry) []byte {
+	if entry.ImageKey == "" || b.Image == nil {
+		return nil
+	}
+	data, err := b.Image(ctx, entry.ImageKey)
+	if err != nil {
+		log.Printf("Leaving image %s out of the book: %v", entry.ImageKey, err)
+		return nil
+	}
+	return data
+}
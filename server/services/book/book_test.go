@@ -0,0 +1,175 @@
+package book
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func testBook(t *testing.T) Book {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		img.Set(x, 10, color.RGBA{200, 40, 40, 255})
+	}
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, img); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("The corridor kept folding back on itself & <nothing> changed. ", 80)
+	return Book{
+		Title:    "Night Notes",
+		Subtitle: "2024",
+		Chapters: []Chapter{
+			{Title: "January 2024", Entries: []Entry{
+				{Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), Text: "Flying over Zürich\n\nThen falling", Notes: []string{"Lucid"}, ImageKey: "sky.png"},
+				{Date: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC), Text: long, ImageKey: "missing.png"},
+			}},
+			{Title: "February 2024", Entries: []Entry{
+				{Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Text: "A quiet dream"},
+			}},
+		},
+		Image: func(ctx context.Context, key string) ([]byte, error) {
+			if key == "sky.png" {
+				return picture.Bytes(), nil
+			}
+			return nil, errors.New("not found")
+		},
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	entry := Entry{Text: "first\nline \r\n\r\n  second  \n\n\n"}
+	if got := entry.Paragraphs(); len(got) != 2 || got[0] != "first line" || got[1] != "second" {
+		t.Errorf("unexpected paragraphs %q", got)
+	}
+}
+
+func TestWriteEPUB(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEPUB(t.Context(), &buf, testBook(t)); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a valid ZIP: %v", err)
+	}
+	if first := archive.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("expected an uncompressed mimetype first, got %s", first.Name)
+	}
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		r, _ := file.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[file.Name] = string(data)
+		// Every document must be well-formed XML for readers to open it
+		if strings.HasSuffix(file.Name, "html") || strings.HasSuffix(file.Name, ".opf") || strings.HasSuffix(file.Name, ".ncx") {
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				if _, err := decoder.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed: %v", file.Name, err)
+				}
+			}
+		}
+	}
+
+	for name, want := range map[string]string{
+		"OEBPS/chapter-001.xhtml": "Wednesday, 3 January 2024",
+		"OEBPS/chapter-002.xhtml": "A quiet dream",
+		"OEBPS/nav.xhtml":         "February 2024",
+		"OEBPS/toc.ncx":           "January 2024",
+		"OEBPS/content.opf":       `properties="cover-image"`,
+	} {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("expected %s to contain %q:\n%s", name, want, files[name])
+		}
+	}
+	images := 0
+	for name := range files {
+		if strings.HasPrefix(name, "OEBPS/images/") {
+			images++
+		}
+	}
+	if images != 1 {
+		t.Errorf("expected only the image that loaded, got %d", images)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePDF(t.Context(), &buf, testBook(t)); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.7\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("expected a complete PDF")
+	}
+
+	// Every xref entry must point at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if startxref == nil {
+		t.Fatal("missing startxref")
+	}
+	offset, _ := strconv.Atoi(string(startxref[1]))
+	lines := strings.Split(string(pdf[offset:]), "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("startxref doesn't point at the xref table: %q", lines[0])
+	}
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for id := 1; id < count; id++ {
+		objectOffset, _ := strconv.Atoi(strings.Fields(lines[2+id])[0])
+		if want := strconv.Itoa(id) + " 0 obj"; !bytes.HasPrefix(pdf[objectOffset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", id, pdf[objectOffset:objectOffset+10])
+		}
+	}
+
+	pages := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(pdf)
+	if pages == nil {
+		t.Fatal("missing page tree")
+	}
+	// A title page, contents, and the long entry flowing onto several pages
+	if n, _ := strconv.Atoi(string(pages[1])); n < 5 {
+		t.Errorf("expected the text to flow across pages, got %d pages", n)
+	}
+	for _, want := range []string{"/Subtype /Image", "/FontFile2", "/Outlines", "/DCTDecode"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("expected PDF to contain %s", want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	f, err := newPDFFont("F1", "GoRegular", false, goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &pdfLayout{fonts: [3]*pdfFont{f, f, f}}
+	lines := l.wrap(regular, bodySize, "short words "+strings.Repeat("x", 200), textWidth)
+	if len(lines) < 3 || lines[0] != "short words" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	for _, line := range lines {
+		if w := f.width(line, bodySize); w > textWidth {
+			t.Errorf("line %q is %.1fpt wide", line, w)
+		}
+	}
+}
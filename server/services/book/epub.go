@@ -0,0 +1,219 @@
+package book
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// epubImageExtensions are the image types EPUB readers are required to support
+var epubImageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+const epubStyle = `body { font-family: serif; line-height: 1.5; margin: 0 5%; }
+h1 { text-align: center; margin: 3em 0 2em; }
+h2 { margin: 2em 0 0.25em; font-size: 1.2em; }
+.title { text-align: center; margin-top: 30%; }
+.subtitle { text-align: center; font-style: italic; }
+.notes { font-style: italic; font-size: 0.85em; color: #555; margin: 0 0 1em; }
+.image { text-align: center; margin: 1em 0; }
+.image img { max-width: 100%; max-height: 60vh; }
+p { margin: 0 0 0.75em; text-indent: 0; }
+nav ol { list-style: none; padding-left: 1em; }
+`
+
+// epubItem is a file listed in the package manifest
+type epubItem struct {
+	id, href, mediaType, properties string
+}
+
+// WriteEPUB writes the book as an EPUB 3 file, with an EPUB 2 table of contents for
+// older readers. Chapters are written one at a time so only one month of images is held
+// in memory.
+func WriteEPUB(ctx context.Context, w io.Writer, book Book) error {
+	archive := zip.NewWriter(w)
+
+	// The mimetype file must come first and be stored uncompressed
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+	if err := writeZipString(archive, "META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`); err != nil {
+		return err
+	}
+
+	manifest := []epubItem{
+		{"style", "style.css", "text/css", ""},
+		{"title", "title.xhtml", "application/xhtml+xml", ""},
+		{"nav", "nav.xhtml", "application/xhtml+xml", "nav"},
+		{"ncx", "toc.ncx", "application/x-dtbncx+xml", ""},
+	}
+	spine := []string{"title", "nav"}
+	if err := writeZipString(archive, "OEBPS/style.css", epubStyle); err != nil {
+		return err
+	}
+	if err := writeZipString(archive, "OEBPS/title.xhtml", xhtmlPage(book.Title, fmt.Sprintf(
+		"<h1 class=\"title\">%s</h1>\n<p class=\"subtitle\">%s</p>\n", html.EscapeString(book.Title), html.EscapeString(book.Subtitle)))); err != nil {
+		return err
+	}
+
+	var nav, ncx strings.Builder
+	entryNumber, imageNumber := 0, 0
+	for i, chapter := range book.Chapters {
+		href := fmt.Sprintf("chapter-%03d.xhtml", i+1)
+		id := fmt.Sprintf("chapter-%03d", i+1)
+		manifest = append(manifest, epubItem{id, href, "application/xhtml+xml", ""})
+		spine = append(spine, id)
+		fmt.Fprintf(&nav, "<li><a href=\"%s\">%s</a>\n<ol>\n", href, html.EscapeString(chapter.Title))
+		fmt.Fprintf(&ncx, "<navPoint id=\"nav-%s\"><navLabel><text>%s</text></navLabel><content src=\"%s\"/></navPoint>\n", id, html.EscapeString(chapter.Title), href)
+
+		type chapterImage struct {
+			href string
+			data []byte
+		}
+		var images []chapterImage
+		var body strings.Builder
+		fmt.Fprintf(&body, "<h1>%s</h1>\n", html.EscapeString(chapter.Title))
+		for _, entry := range chapter.Entries {
+			entryNumber++
+			anchor := fmt.Sprintf("entry-%d", entryNumber)
+			fmt.Fprintf(&nav, "<li><a href=\"%s#%s\">%s</a></li>\n", href, anchor, html.EscapeString(entry.Heading()))
+			fmt.Fprintf(&body, "<section id=\"%s\">\n<h2>%s</h2>\n", anchor, html.EscapeString(entry.Heading()))
+			if len(entry.Notes) > 0 {
+				fmt.Fprintf(&body, "<p class=\"notes\">%s</p>\n", html.EscapeString(strings.Join(entry.Notes, " · ")))
+			}
+			if data := book.loadImage(ctx, entry); data != nil {
+				mediaType := http.DetectContentType(data)
+				if ext, ok := epubImageExtensions[mediaType]; ok {
+					imageNumber++
+					item := epubItem{fmt.Sprintf("image-%d", imageNumber), fmt.Sprintf("images/image-%d.%s", imageNumber, ext), mediaType, ""}
+					// The first image doubles as the cover
+					if imageNumber == 1 {
+						item.properties = "cover-image"
+					}
+					manifest = append(manifest, item)
+					images = append(images, chapterImage{item.href, data})
+					fmt.Fprintf(&body, "<div class=\"image\"><img src=\"%s\" alt=\"\"/></div>\n", item.href)
+				}
+			}
+			for _, paragraph := range entry.Paragraphs() {
+				fmt.Fprintf(&body, "<p>%s</p>\n", html.EscapeString(paragraph))
+			}
+			body.WriteString("</section>\n")
+		}
+		nav.WriteString("</ol>\n</li>\n")
+
+		if err := writeZipString(archive, "OEBPS/"+href, xhtmlPage(chapter.Title, body.String())); err != nil {
+			return err
+		}
+		for _, image := range images {
+			// Images are already compressed
+			file, err := archive.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + image.href, Method: zip.Store})
+			if err != nil {
+				return err
+			}
+			if _, err := file.Write(image.data); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeZipString(archive, "OEBPS/nav.xhtml", xhtmlPage("Contents", fmt.Sprintf(
+		"<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n%s</ol>\n</nav>\n", nav.String()))); err != nil {
+		return err
+	}
+
+	identifier := newUUID()
+	if err := writeZipString(archive, "OEBPS/toc.ncx", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head><meta name="dtb:uid" content="urn:uuid:%s"/></head>
+<docTitle><text>%s</text></docTitle>
+<navMap>
+%s</navMap>
+</ncx>
+`, identifier, html.EscapeString(book.Title), ncx.String())); err != nil {
+		return err
+	}
+
+	var opf strings.Builder
+	fmt.Fprintf(&opf, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="book-id">urn:uuid:%s</dc:identifier>
+<dc:title>%s</dc:title>
+<dc:language>en</dc:language>
+<meta property="dcterms:modified">%s</meta>
+</metadata>
+<manifest>
+`, identifier, html.EscapeString(book.Title), time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	for _, item := range manifest {
+		properties := ""
+		if item.properties != "" {
+			properties = fmt.Sprintf(" properties=\"%s\"", item.properties)
+		}
+		fmt.Fprintf(&opf, "<item id=\"%s\" href=\"%s\" media-type=\"%s\"%s/>\n", item.id, item.href, item.mediaType, properties)
+	}
+	opf.WriteString("</manifest>\n<spine toc=\"ncx\">\n")
+	for _, id := range spine {
+		fmt.Fprintf(&opf, "<itemref idref=\"%s\"/>\n", id)
+	}
+	opf.WriteString("</spine>\n</package>\n")
+	if err := writeZipString(archive, "OEBPS/content.opf", opf.String()); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// xhtmlPage wraps a body in an XHTML document using the book's stylesheet
+func xhtmlPage(title, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en">
+<head>
+<meta charset="UTF-8"/>
+<title>%s</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+%s</body>
+</html>
+`, html.EscapeString(title), body)
+}
+
+func writeZipString(archive *zip.Writer, name, content string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(file, content)
+	return err
+}
+
+// newUUID returns a random version 4 UUID for the book identifier
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,388 @@
+package book
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Page geometry in points, for an A5 page
+const (
+	pageWidth      = 420.0
+	pageHeight     = 595.0
+	marginX        = 54.0
+	marginTop      = 60.0
+	marginBottom   = 64.0
+	textWidth      = pageWidth - 2*marginX
+	maxImageHeight = 260.0
+	// maxImagePixels is the width images are scaled down to, which is plenty for print
+	// at the size they are shown
+	maxImagePixels = 1200
+	pdfJPEGQuality = 85
+)
+
+// Type sizes in points
+const (
+	titleSize   = 24.0
+	chapterSize = 20.0
+	headingSize = 13.0
+	bodySize    = 11.0
+	bodyLeading = 15.5
+	notesSize   = 9.0
+)
+
+type fontStyle int
+
+const (
+	regular fontStyle = iota
+	bold
+	italic
+)
+
+// pdfWriter writes numbered objects and remembers their offsets for the xref table
+type pdfWriter struct {
+	w       io.Writer
+	written int64
+	offsets []int64
+	err     error
+}
+
+func (p *pdfWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	n, err := io.WriteString(p.w, s)
+	p.written += int64(n)
+	p.err = err
+}
+
+// alloc reserves an object ID
+func (p *pdfWriter) alloc() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+func (p *pdfWriter) object(id int, body string) {
+	p.offsets[id-1] = p.written
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", id, body))
+}
+
+// stream writes a Flate-compressed stream with extra dictionary entries
+func (p *pdfWriter) stream(id int, dict string, data []byte) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+	p.rawStream(id, fmt.Sprintf("%s /Filter /FlateDecode", dict), compressed.Bytes())
+}
+
+func (p *pdfWriter) rawStream(id int, dict string, data []byte) {
+	p.offsets[id-1] = p.written
+	p.write(fmt.Sprintf("%d 0 obj\n<< %s /Length %d >>\nstream\n", id, strings.TrimSpace(dict), len(data)))
+	p.write(string(data))
+	p.write("\nendstream\nendobj\n")
+}
+
+// pdfPage is a page being laid out
+type pdfPage struct {
+	id       int
+	content  strings.Builder
+	images   map[string]int
+	numbered bool
+}
+
+// pdfLayout flows the book onto pages. Images are written as soon as they are placed,
+// so only the text of the pages is kept until the end.
+type pdfLayout struct {
+	writer *pdfWriter
+	fonts  [3]*pdfFont
+	pages  []*pdfPage
+	y      float64
+}
+
+func (l *pdfLayout) newPage(numbered bool) *pdfPage {
+	page := &pdfPage{id: l.writer.alloc(), images: make(map[string]int), numbered: numbered}
+	l.pages = append(l.pages, page)
+	l.y = pageHeight - marginTop
+	return page
+}
+
+func (l *pdfLayout) page() *pdfPage {
+	return l.pages[len(l.pages)-1]
+}
+
+// need starts a new page unless height points fit above the bottom margin
+func (l *pdfLayout) need(height float64) {
+	if l.y-height < marginBottom {
+		l.newPage(true)
+	}
+}
+
+// text draws one line with its baseline at y
+func (l *pdfLayout) text(page *pdfPage, style fontStyle, size, x, y float64, s string, gray bool) {
+	if gray {
+		page.content.WriteString("0.4 g\n")
+	}
+	f := l.fonts[style]
+	fmt.Fprintf(&page.content, "BT /%s %.1f Tf 1 0 0 1 %.2f %.2f Tm %s Tj ET\n", f.resource, size, x, y, f.encode(s))
+	if gray {
+		page.content.WriteString("0 g\n")
+	}
+}
+
+// wrap breaks s into lines no wider than width, splitting words that don't fit alone
+func (l *pdfLayout) wrap(style fontStyle, size float64, s string, width float64) []string {
+	f := l.fonts[style]
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if f.width(candidate, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = ""
+		for _, r := range word {
+			if line != "" && f.width(line+string(r), size) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// paragraph flows wrapped text down the page, breaking pages as needed
+func (l *pdfLayout) paragraph(style fontStyle, size, leading float64, s string, gray, centered bool) {
+	for _, line := range l.wrap(style, size, s, textWidth) {
+		l.need(leading)
+		l.y -= leading
+		x := marginX
+		if centered {
+			x = (pageWidth - l.fonts[style].width(line, size)) / 2
+		}
+		l.text(l.page(), style, size, x, l.y, line, gray)
+	}
+}
+
+// image places an entry's image, scaled to the text width. Images that can't be decoded
+// are left out.
+func (l *pdfLayout) image(data []byte) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	bounds := src.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return
+	}
+
+	// Flatten onto white, scaling down large images
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxImagePixels {
+		width, height = maxImagePixels, max(1, height*maxImagePixels/width)
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(rgba, rgba.Bounds(), src, bounds, draw.Over, nil)
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, rgba, &jpeg.Options{Quality: pdfJPEGQuality}); err != nil {
+		return
+	}
+
+	displayWidth := textWidth
+	displayHeight := displayWidth * float64(height) / float64(width)
+	if displayHeight > maxImageHeight {
+		displayWidth, displayHeight = maxImageHeight*float64(width)/float64(height), maxImageHeight
+	}
+
+	id := l.writer.alloc()
+	l.writer.rawStream(id, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", width, height), encoded.Bytes())
+
+	l.need(displayHeight + 8)
+	l.y -= displayHeight + 8
+	page := l.page()
+	name := fmt.Sprintf("Im%d", id)
+	page.images[name] = id
+	fmt.Fprintf(&page.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", displayWidth, displayHeight, (pageWidth-displayWidth)/2, l.y, name)
+	l.y -= 8
+}
+
+// WritePDF writes the book as an A5 PDF with a title page, a contents page listing the
+// chapters and bookmarks for them
+func WritePDF(ctx context.Context, w io.Writer, book Book) error {
+	writer := &pdfWriter{w: w}
+	writer.write("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	catalog, pagesRoot := writer.alloc(), writer.alloc()
+
+	l := &pdfLayout{writer: writer}
+	for i, spec := range []struct {
+		name   string
+		italic bool
+		data   []byte
+	}{{"GoRegular", false, goregular.TTF}, {"GoBold", false, gobold.TTF}, {"GoItalic", true, goitalic.TTF}} {
+		f, err := newPDFFont(fmt.Sprintf("F%d", i+1), spec.name, spec.italic, spec.data)
+		if err != nil {
+			return err
+		}
+		l.fonts[i] = f
+	}
+
+	// Title page
+	l.newPage(false)
+	l.y = pageHeight * 0.65
+	l.paragraph(bold, titleSize, titleSize*1.3, book.Title, false, true)
+	l.y -= 12
+	l.paragraph(italic, bodySize+1, bodyLeading, book.Subtitle, true, true)
+
+	// Contents pages are filled in once the chapters' pages are known
+	const contentsLeading = 20.0
+	perPage := int(math.Floor((pageHeight - marginTop - marginBottom - 50) / contentsLeading))
+	contents := make([]*pdfPage, max(1, int(math.Ceil(float64(len(book.Chapters))/float64(perPage)))))
+	for i := range contents {
+		contents[i] = l.newPage(true)
+	}
+
+	chapterPages := make([]int, len(book.Chapters))
+	for i, chapter := range book.Chapters {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.newPage(true)
+		chapterPages[i] = len(l.pages) - 1
+		l.y -= 20
+		l.paragraph(bold, chapterSize, chapterSize*1.3, chapter.Title, false, true)
+		l.y -= 16
+
+		for j, entry := range chapter.Entries {
+			if j > 0 {
+				l.y -= 18
+			}
+			// Keep the date with at least the start of the dream
+			l.need(headingSize*1.4 + notesSize*1.5 + 2*bodyLeading)
+			l.paragraph(bold, headingSize, headingSize*1.4, entry.Heading(), false, false)
+			if len(entry.Notes) > 0 {
+				l.paragraph(italic, notesSize, notesSize*1.5, strings.Join(entry.Notes, " · "), true, false)
+			}
+			l.y -= 4
+			if data := book.loadImage(ctx, entry); data != nil {
+				l.image(data)
+			}
+			for _, paragraph := range entry.Paragraphs() {
+				l.paragraph(regular, bodySize, bodyLeading, paragraph, false, false)
+				l.y -= 6
+			}
+		}
+	}
+
+	for i, page := range contents {
+		l.y = pageHeight - marginTop
+		if i == 0 {
+			l.y -= chapterSize
+			l.text(page, bold, chapterSize, marginX, l.y, "Contents", false)
+			l.y -= 20
+		}
+		for c := i * perPage; c < min(len(book.Chapters), (i+1)*perPage); c++ {
+			l.y -= contentsLeading
+			number := fmt.Sprint(chapterPages[c] + 1)
+			l.text(page, regular, bodySize, marginX, l.y, book.Chapters[c].Title, false)
+			l.text(page, regular, bodySize, pageWidth-marginX-l.fonts[regular].width(number, bodySize), l.y, number, false)
+		}
+	}
+
+	// Fonts go in after layout, once the glyphs used are known
+	var fontResources strings.Builder
+	for _, f := range l.fonts {
+		fmt.Fprintf(&fontResources, "/%s %d 0 R ", f.resource, f.write(writer))
+	}
+
+	kids := make([]string, len(l.pages))
+	for i, page := range l.pages {
+		if page.numbered {
+			number := fmt.Sprint(i + 1)
+			l.text(page, regular, notesSize, (pageWidth-l.fonts[regular].width(number, notesSize))/2, 32, number, true)
+		}
+		content := writer.alloc()
+		writer.stream(content, "", []byte(page.content.String()))
+
+		var images strings.Builder
+		for name, id := range page.images {
+			fmt.Fprintf(&images, "/%s %d 0 R ", name, id)
+		}
+		writer.object(page.id, fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R /Resources << /Font << %s>> /XObject << %s>> >> >>",
+			pagesRoot, pageWidth, pageHeight, content, fontResources.String(), images.String()))
+		kids[i] = fmt.Sprintf("%d 0 R", page.id)
+	}
+	writer.object(pagesRoot, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+
+	// Bookmarks for each chapter
+	outlines := ""
+	if len(book.Chapters) > 0 {
+		root := writer.alloc()
+		items := make([]int, len(book.Chapters))
+		for i := range items {
+			items[i] = writer.alloc()
+		}
+		for i, chapter := range book.Chapters {
+			links := ""
+			if i > 0 {
+				links += fmt.Sprintf(" /Prev %d 0 R", items[i-1])
+			}
+			if i < len(items)-1 {
+				links += fmt.Sprintf(" /Next %d 0 R", items[i+1])
+			}
+			writer.object(items[i], fmt.Sprintf("<< /Title %s /Parent %d 0 R%s /Dest [%d 0 R /Fit] >>",
+				pdfText(chapter.Title), root, links, l.pages[chapterPages[i]].id))
+		}
+		writer.object(root, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>", items[0], items[len(items)-1], len(items)))
+		outlines = fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", root)
+	}
+	writer.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R%s >>", pagesRoot, outlines))
+	info := writer.alloc()
+	writer.object(info, fmt.Sprintf("<< /Title %s /Producer (Dreams) >>", pdfText(book.Title)))
+
+	xref := writer.written
+	writer.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(writer.offsets)+1))
+	for _, offset := range writer.offsets {
+		writer.write(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	writer.write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(writer.offsets)+1, catalog, info, xref))
+	return writer.err
+}
+
+// pdfText encodes a string for the document outline and info as UTF-16 with a byte order mark
+func pdfText(s string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package book
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// pdfGlyph is a glyph and its advance width in thousandths of an em
+type pdfGlyph struct {
+	index sfnt.GlyphIndex
+	width float64
+}
+
+// pdfFont is a TrueType font embedded in the PDF as a CID font, so any character the
+// font has a glyph for can be shown
+type pdfFont struct {
+	resource string
+	baseName string
+	italic   bool
+	data     []byte
+	font     *sfnt.Font
+	buf      sfnt.Buffer
+	glyphs   map[rune]pdfGlyph
+	// used records the glyphs shown, for the widths and ToUnicode tables
+	used map[sfnt.GlyphIndex]rune
+}
+
+func newPDFFont(resource, baseName string, italic bool, data []byte) (*pdfFont, error) {
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", baseName, err)
+	}
+	return &pdfFont{
+		resource: resource,
+		baseName: baseName,
+		italic:   italic,
+		data:     data,
+		font:     parsed,
+		glyphs:   make(map[rune]pdfGlyph),
+		used:     make(map[sfnt.GlyphIndex]rune),
+	}, nil
+}
+
+// scale converts font units to thousandths of an em
+func (f *pdfFont) scale(v fixed.Int26_6) float64 {
+	return float64(v) / 64 * 1000 / float64(f.font.UnitsPerEm())
+}
+
+func (f *pdfFont) ppem() fixed.Int26_6 {
+	return fixed.I(int(f.font.UnitsPerEm()))
+}
+
+func (f *pdfFont) glyph(r rune) pdfGlyph {
+	if g, ok := f.glyphs[r]; ok {
+		return g
+	}
+	var g pdfGlyph
+	// Missing characters fall back to glyph 0, which fonts draw as a box
+	if index, err := f.font.GlyphIndex(&f.buf, r); err == nil {
+		g.index = index
+	}
+	if advance, err := f.font.GlyphAdvance(&f.buf, g.index, f.ppem(), font.HintingNone); err == nil {
+		g.width = f.scale(advance)
+	}
+	f.glyphs[r] = g
+	return g
+}
+
+// width is the width of s in points at the given size
+func (f *pdfFont) width(s string, size float64) float64 {
+	var total float64
+	for _, r := range s {
+		total += f.glyph(r).width
+	}
+	return total * size / 1000
+}
+
+// encode returns s as a hex string of glyph indices for the Tj operator
+func (f *pdfFont) encode(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		g := f.glyph(r)
+		if _, ok := f.used[g.index]; !ok {
+			f.used[g.index] = r
+		}
+		fmt.Fprintf(&b, "%04X", uint16(g.index))
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// write embeds the font and returns the object ID of its Type0 font dictionary
+func (f *pdfFont) write(p *pdfWriter) int {
+	fontFile, descriptor, cidFont, toUnicode, type0 := p.alloc(), p.alloc(), p.alloc(), p.alloc(), p.alloc()
+
+	p.stream(fontFile, fmt.Sprintf("/Length1 %d", len(f.data)), f.data)
+
+	metrics, _ := f.font.Metrics(&f.buf, f.ppem(), font.HintingNone)
+	bounds, _ := f.font.Bounds(&f.buf, f.ppem(), font.HintingNone)
+	flags, italicAngle := 32, 0
+	if f.italic {
+		flags, italicAngle = flags|64, -10
+	}
+	p.object(descriptor, fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%.0f %.0f %.0f %.0f] /ItalicAngle %d /Ascent %.0f /Descent %.0f /CapHeight %.0f /StemV 80 /FontFile2 %d 0 R >>",
+		f.baseName, flags, f.scale(bounds.Min.X), -f.scale(bounds.Max.Y), f.scale(bounds.Max.X), -f.scale(bounds.Min.Y),
+		italicAngle, f.scale(metrics.Ascent), -f.scale(metrics.Descent), f.scale(metrics.CapHeight), fontFile))
+
+	indices := make([]int, 0, len(f.used))
+	for index := range f.used {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+
+	var widths strings.Builder
+	for _, index := range indices {
+		fmt.Fprintf(&widths, "%d [%.0f] ", index, f.glyph(f.used[sfnt.GlyphIndex(index)]).width)
+	}
+	p.object(cidFont, fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		f.baseName, descriptor, widths.String()))
+
+	p.stream(toUnicode, "", []byte(f.toUnicode(indices)))
+	p.object(type0, fmt.Sprintf(
+		"<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		f.baseName, cidFont, toUnicode))
+	return type0
+}
+
+// toUnicode builds the CMap that lets readers copy and search the text
+func (f *pdfFont) toUnicode(indices []int) string {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// bfchar blocks hold at most 100 entries
+	for start := 0; start < len(indices); start += 100 {
+		end := min(start+100, len(indices))
+		fmt.Fprintf(&b, "%d beginbfchar\n", end-start)
+		for _, index := range indices[start:end] {
+			fmt.Fprintf(&b, "<%04X> <", index)
+			for _, unit := range utf16.Encode([]rune{f.used[sfnt.GlyphIndex(index)]}) {
+				fmt.Fprintf(&b, "%04X", unit)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services/book"
+	"dreams/services/storage"
+)
+
+// BookFormat is a format a range of dreams can be rendered as a book in
+type BookFormat string
+
+const (
+	BookEPUB BookFormat = "epub"
+	BookPDF  BookFormat = "pdf"
+)
+
+const (
+	// maxBookDreams caps the dreams in one book, which is laid out in memory
+	maxBookDreams = 2000
+	// maxBookImageBytes caps the images read into one book
+	maxBookImageBytes = 64 << 20
+)
+
+// ErrBookTooLarge is returned when a range holds more dreams than fit in one book
+var ErrBookTooLarge = fmt.Errorf("a book can hold at most %d dreams", maxBookDreams)
+
+// BookRequest selects the dreams for a book. From and To are inclusive and either can
+// be nil for an open range.
+type BookRequest struct {
+	Title string
+	From  *models.Date
+	To    *models.Date
+}
+
+// Book collects the dreams in the requested range into chapters by month, ordered by the
+// night they happened. Dreams without a dreamt on date are placed by when they were written.
+func (s *ExportService) Book(ctx context.Context, req BookRequest) (book.Book, error) {
+	var dreams []ExportedDream
+	query := repositories.DreamListQuery{NightFrom: req.From, NightTo: req.To}
+	err := eachDream(ctx, s.dreams, query, func(dream models.Dream) error {
+		if len(dreams) == maxBookDreams {
+			return ErrBookTooLarge
+		}
+		dreams = append(dreams, NewExportedDream(dream))
+		return nil
+	})
+	if err != nil {
+		return book.Book{}, err
+	}
+	sort.SliceStable(dreams, func(i, j int) bool { return dreams[i].Date() < dreams[j].Date() })
+
+	result := book.Book{
+		Title:    req.Title,
+		Subtitle: bookSubtitle(dreams),
+		Image:    s.bookImages(maxBookImageBytes),
+	}
+	if result.Title == "" {
+		result.Title = "Dream Journal"
+	}
+	for _, dream := range dreams {
+		date, err := time.Parse(time.DateOnly, dream.Date())
+		if err != nil {
+			return book.Book{}, err
+		}
+		month := date.Format("January 2006")
+		if len(result.Chapters) == 0 || result.Chapters[len(result.Chapters)-1].Title != month {
+			result.Chapters = append(result.Chapters, book.Chapter{Title: month})
+		}
+
+		entry := book.Entry{Date: date, Text: dream.Dream}
+		if summary := markdownSummary(dream); summary != "" {
+			entry.Notes = strings.Split(summary, " · ")
+		}
+		if key, ok := storage.ImageKey(s.storageProvider, dream.Image); ok {
+			entry.ImageKey = key
+		}
+		chapter := &result.Chapters[len(result.Chapters)-1]
+		chapter.Entries = append(chapter.Entries, entry)
+	}
+	return result, nil
+}
+
+// bookImages loads images for a book until limit bytes have been read. Books are rendered
+// in memory, so the images after that are left out rather than growing the book without
+// bound.
+func (s *ExportService) bookImages(limit int) func(ctx context.Context, key string) ([]byte, error) {
+	loaded := 0
+	return func(ctx context.Context, key string) ([]byte, error) {
+		if loaded >= limit {
+			return nil, fmt.Errorf("the book already holds %d bytes of images", loaded)
+		}
+		data, err := s.storageProvider.GetImage(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if loaded+len(data) > limit {
+			loaded = limit
+			return nil, fmt.Errorf("the book has no room for %d more bytes of images", len(data))
+		}
+		loaded += len(data)
+		return data, nil
+	}
+}
+
+// WriteBook renders a book in the given format
+func WriteBook(ctx context.Context, w io.Writer, format BookFormat, b book.Book) error {
+	switch format {
+	case BookEPUB:
+		return book.WriteEPUB(ctx, w, b)
+	case BookPDF:
+		return book.WritePDF(ctx, w, b)
+	default:
+		return fmt.Errorf("unknown book format %q", format)
+	}
+}
+
+// bookSubtitle describes the dates a book covers
+func bookSubtitle(dreams []ExportedDream) string {
+	if len(dreams) == 0 {
+		return "No dreams"
+	}
+	first, last := dreams[0].Date(), dreams[len(dreams)-1].Date()
+	format := func(date string) string {
+		t, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return date
+		}
+		return t.Format("2 January 2006")
+	}
+	count := fmt.Sprintf("%d dreams", len(dreams))
+	if len(dreams) == 1 {
+		count = "1 dream"
+	}
+	if first == last {
+		return fmt.Sprintf("%s · %s", format(first), count)
+	}
+	return fmt.Sprintf("%s to %s · %s", format(first), format(last), count)
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// dreamSignCheckInterval is how often the analyzer looks for new and edited dreams
+	dreamSignCheckInterval = time.Minute
+	// keyphrasesPerDream caps the TF-IDF keyphrases kept for each dream
+	keyphrasesPerDream = 8
+	// llmDreamsPerRun caps the dreams sent to the language model in one run, so a large
+	// import is worked through over several runs
+	llmDreamsPerRun = 20
+	// maxSignPhraseWords is the longest phrase taken from the language model
+	maxSignPhraseWords = 3
+	// signSimilarity is the Jaccard similarity of the dreams two recurring phrases appear
+	// in above which they are treated as one dream sign
+	signSimilarity = 0.6
+)
+
+// DreamSign is a recurring theme, the phrases that make it up and the dreams it appears in
+type DreamSign struct {
+	Label   string      `json:"label"`
+	Phrases []string    `json:"phrases"`
+	Count   int         `json:"count"`
+	Score   float64     `json:"score"`
+	Dreams  []SignDream `json:"dreams"`
+}
+
+// SignDream is a dream linked to a dream sign
+type SignDream struct {
+	ID       uint         `json:"id"`
+	DreamtOn *models.Date `json:"dreamt_on,omitempty"`
+	Excerpt  string       `json:"excerpt"`
+}
+
+// DreamSigns is the result of the dream-sign endpoint
+type DreamSigns struct {
+	Signs []DreamSign `json:"signs"`
+	// AnalyzedAt is when the analyzer last ran, omitted before its first run
+	AnalyzedAt *time.Time `json:"analyzed_at,omitempty"`
+}
+
+// DreamSignService extracts keyphrases from every dream in the background and clusters
+// the ones that recur into dream signs. Keyphrases are scored by TF-IDF over the whole
+// journal, and a language model can add phrases of its own.
+type DreamSignService struct {
+	db      *gorm.DB
+	llm     *LLMClient
+	mu      sync.Mutex
+	checked string
+	// pending is set while dreams are waiting for the language model
+	pending  bool
+	analyzed *time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDreamSignService creates a dream-sign service. llm may be nil to use TF-IDF alone.
+func NewDreamSignService(db *gorm.DB, llm *LLMClient) *DreamSignService {
+	return &DreamSignService{
+		db:   db,
+		llm:  llm,
+		stop: make(chan struct{}),
+	}
+}
+
+// Start runs the analyzer in the background until Stop is called. It reruns whenever
+// dreams are added, edited or deleted.
+func (s *DreamSignService) Start() {
+	go func() {
+		ticker := time.NewTicker(dreamSignCheckInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.AnalyzeIfChanged(context.Background()); err != nil {
+				log.Printf("Error analyzing dream signs: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the analyzer
+func (s *DreamSignService) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// AnalyzeIfChanged runs Analyze unless no dream has changed since the last run and none
+// are waiting for the language model
+func (s *DreamSignService) AnalyzeIfChanged(ctx context.Context) error {
+	var state struct {
+		Count   int
+		Updated string
+	}
+	err := s.db.WithContext(ctx).Model(&models.Dream{}).
+		Select("COUNT(*) AS count, COALESCE(CAST(MAX(updated_at) AS VARCHAR(40)), '') AS updated").
+		Scan(&state).Error
+	if err != nil {
+		return err
+	}
+	checked := fmt.Sprintf("%d %s", state.Count, state.Updated)
+
+	s.mu.Lock()
+	unchanged := checked == s.checked && !s.pending
+	s.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	if err := s.Analyze(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.checked = checked
+	s.mu.Unlock()
+	return nil
+}
+
+// Analyze extracts and stores the keyphrases of every dream
+func (s *DreamSignService) Analyze(ctx context.Context) error {
+	var dreams []models.Dream
+	if err := s.db.WithContext(ctx).Select("id", "version", "dream").Order("id").Find(&dreams).Error; err != nil {
+		return fmt.Errorf("failed to load dreams: %w", err)
+	}
+
+	keyphrases := tfidfKeyphrases(dreams)
+
+	var analyses []models.DreamSignAnalysis
+	var llmPhrases []models.DreamKeyphrase
+	pending := false
+	if s.llm != nil {
+		var existing []models.DreamSignAnalysis
+		if err := s.db.WithContext(ctx).Find(&existing).Error; err != nil {
+			return fmt.Errorf("failed to load analyses: %w", err)
+		}
+		versions := make(map[uint]uint)
+		for _, analysis := range existing {
+			versions[analysis.DreamID] = analysis.Version
+		}
+		for _, dream := range dreams {
+			if versions[dream.ID] == dream.Version {
+				continue
+			}
+			if len(analyses) == llmDreamsPerRun {
+				pending = true
+				break
+			}
+			phrases, err := s.llmSigns(ctx, dream.Dream)
+			if err != nil {
+				// The rest are left for the next run, as the model is likely unavailable
+				log.Printf("Error extracting dream signs from dream %d: %v", dream.ID, err)
+				pending = true
+				break
+			}
+			analyses = append(analyses, models.DreamSignAnalysis{DreamID: dream.ID, Version: dream.Version, AnalyzedAt: time.Now().UTC()})
+			for _, phrase := range phrases {
+				llmPhrases = append(llmPhrases, models.DreamKeyphrase{DreamID: dream.ID, Phrase: phrase, Score: 1, Source: models.KeyphraseLLM})
+			}
+		}
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// TF-IDF scores shift with every dream, so they are all replaced
+		if err := tx.Where("source = ?", models.KeyphraseTFIDF).Delete(&models.DreamKeyphrase{}).Error; err != nil {
+			return err
+		}
+		for _, analysis := range analyses {
+			if err := tx.Where("dream_id = ? AND source = ?", analysis.DreamID, models.KeyphraseLLM).Delete(&models.DreamKeyphrase{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(llmPhrases) > 0 {
+			if err := tx.CreateInBatches(llmPhrases, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(keyphrases) > 0 {
+			// Phrases the language model also found keep the language model's entry
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(keyphrases, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(analyses) > 0 {
+			return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&analyses).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save keyphrases: %w", err)
+	}
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.analyzed = &now
+	s.pending = pending
+	s.mu.Unlock()
+	return nil
+}
+
+// llmSigns asks the language model for the dream signs in a dream
+func (s *DreamSignService) llmSigns(ctx context.Context, text string) ([]string, error) {
+	prompt := fmt.Sprintf(`Lucid dreamers look for dream signs: recurring people, places, objects,
+actions and situations such as teeth falling out, being late, flying or an old school.
+List the dream signs in the dream below as short lowercase phrases of one to three words.
+Answer with JSON like {"signs": ["teeth falling out", "exam"]}.
+
+Dream:
+%s`, text)
+
+	var answer struct {
+		Signs []string `json:"signs"`
+	}
+	if err := s.llm.GenerateJSON(ctx, prompt, &answer); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var phrases []string
+	for _, sign := range answer.Signs {
+		if phrase := normalizeSignPhrase(sign); phrase != "" && !seen[phrase] {
+			seen[phrase] = true
+			phrases = append(phrases, phrase)
+		}
+	}
+	return phrases, nil
+}
+
+// normalizeSignPhrase lowercases a phrase from the language model and strips punctuation,
+// returning "" for phrases that are empty or too long to be a dream sign
+func normalizeSignPhrase(phrase string) string {
+	words := wordFields(phrase)
+	if len(words) == 0 || len(words) > maxSignPhraseWords {
+		return ""
+	}
+	phrase = strings.Join(words, " ")
+	if len(phrase) > 100 {
+		return ""
+	}
+	return phrase
+}
+
+// phraseBreak reports punctuation that ends a phrase, so bigrams don't span sentences
+func phraseBreak(r rune) bool {
+	return unicode.IsPunct(r) && r != '\'' && r != '’' && r != '-'
+}
+
+// candidatePhrases counts the content words of a dream and the pairs of content words
+// that follow each other within a sentence, skipping stopwords between them
+func candidatePhrases(text string) (map[string]int, int) {
+	counts := make(map[string]int)
+	total := 0
+	for _, segment := range strings.FieldsFunc(text, phraseBreak) {
+		previous := ""
+		for _, field := range wordFields(segment) {
+			word, ok := contentWord(field)
+			if !ok {
+				continue
+			}
+			total++
+			counts[word]++
+			if previous != "" {
+				counts[previous+" "+word]++
+			}
+			previous = word
+		}
+	}
+	return counts, total
+}
+
+// tfidfKeyphrases picks the phrases that best set each dream apart from the rest of the
+// journal: frequent in the dream, rare elsewhere
+func tfidfKeyphrases(dreams []models.Dream) []models.DreamKeyphrase {
+	phrases := make([]map[string]int, len(dreams))
+	totals := make([]int, len(dreams))
+	documents := make(map[string]int)
+	for i, dream := range dreams {
+		phrases[i], totals[i] = candidatePhrases(dream.Dream)
+		for phrase := range phrases[i] {
+			documents[phrase]++
+		}
+	}
+
+	var keyphrases []models.DreamKeyphrase
+	for i, dream := range dreams {
+		scored := make([]models.DreamKeyphrase, 0, len(phrases[i]))
+		for phrase, count := range phrases[i] {
+			// Pairs that occur once in the whole journal are chance neighbours
+			if strings.Contains(phrase, " ") && count == 1 && documents[phrase] == 1 {
+				continue
+			}
+			tf := float64(count) / float64(totals[i])
+			idf := math.Log(1 + float64(len(dreams))/float64(documents[phrase]))
+			scored = append(scored, models.DreamKeyphrase{DreamID: dream.ID, Phrase: phrase, Score: tf * idf, Source: models.KeyphraseTFIDF})
+		}
+		sort.Slice(scored, func(a, b int) bool {
+			if scored[a].Score != scored[b].Score {
+				return scored[a].Score > scored[b].Score
+			}
+			return scored[a].Phrase < scored[b].Phrase
+		})
+		keyphrases = append(keyphrases, scored[:min(keyphrasesPerDream, len(scored))]...)
+	}
+	return keyphrases
+}
+
+// phraseKey identifies a phrase by the stems of its content words, so "teeth falling out"
+// and "teeth fell" are grouped while "flying" and "flies" match
+func phraseKey(phrase string) string {
+	var stems []string
+	for _, field := range wordFields(phrase) {
+		if word, ok := contentWord(field); ok {
+			stems = append(stems, stemWord(word))
+		}
+	}
+	if len(stems) == 0 {
+		return phrase
+	}
+	return strings.Join(stems, " ")
+}
+
+// signCluster is a group of phrases and the dreams they appear in
+type signCluster struct {
+	phrases map[string]float64
+	dreams  map[uint]bool
+	score   float64
+}
+
+func (c *signCluster) merge(other *signCluster) {
+	for phrase, score := range other.phrases {
+		c.phrases[phrase] += score
+	}
+	for id := range other.dreams {
+		c.dreams[id] = true
+	}
+	c.score += other.score
+}
+
+// similarity is the Jaccard similarity of the dreams two clusters appear in
+func (c *signCluster) similarity(other *signCluster) float64 {
+	shared := 0
+	for id := range c.dreams {
+		if other.dreams[id] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(c.dreams)+len(other.dreams)-shared)
+}
+
+// clusterKeyphrases groups keyphrases with the same stems, keeps the groups found in at
+// least minCount dreams, then merges groups that appear in mostly the same dreams, such
+// as "teeth" and "falling out"
+func clusterKeyphrases(keyphrases []models.DreamKeyphrase, minCount int) []*signCluster {
+	groups := make(map[string]*signCluster)
+	for _, keyphrase := range keyphrases {
+		key := phraseKey(keyphrase.Phrase)
+		group, ok := groups[key]
+		if !ok {
+			group = &signCluster{phrases: make(map[string]float64), dreams: make(map[uint]bool)}
+			groups[key] = group
+		}
+		group.phrases[keyphrase.Phrase] += keyphrase.Score
+		group.dreams[keyphrase.DreamID] = true
+		group.score += keyphrase.Score
+	}
+
+	recurring := make([]*signCluster, 0, len(groups))
+	for _, group := range groups {
+		if len(group.dreams) >= minCount {
+			recurring = append(recurring, group)
+		}
+	}
+	sortClusters(recurring)
+
+	var clusters []*signCluster
+	for _, group := range recurring {
+		merged := false
+		for _, cluster := range clusters {
+			if cluster.similarity(group) >= signSimilarity {
+				cluster.merge(group)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			clusters = append(clusters, group)
+		}
+	}
+	sortClusters(clusters)
+	return clusters
+}
+
+// sortClusters orders clusters by the dreams they appear in, then by score
+func sortClusters(clusters []*signCluster) {
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].dreams) != len(clusters[j].dreams) {
+			return len(clusters[i].dreams) > len(clusters[j].dreams)
+		}
+		if clusters[i].score != clusters[j].score {
+			return clusters[i].score > clusters[j].score
+		}
+		return clusters[i].label() < clusters[j].label()
+	})
+}
+
+// rankedPhrases lists the cluster's phrases, highest scoring first
+func (c *signCluster) rankedPhrases() []string {
+	phrases := make([]string, 0, len(c.phrases))
+	for phrase := range c.phrases {
+		phrases = append(phrases, phrase)
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if c.phrases[phrases[i]] != c.phrases[phrases[j]] {
+			return c.phrases[phrases[i]] > c.phrases[phrases[j]]
+		}
+		return phrases[i] < phrases[j]
+	})
+	return phrases
+}
+
+func (c *signCluster) label() string {
+	return c.rankedPhrases()[0]
+}
+
+// Signs returns up to limit dream signs that appear in at least minCount dreams, most
+// frequent first, with the dreams they appear in oldest first
+func (s *DreamSignService) Signs(ctx context.Context, minCount, limit int) (DreamSigns, error) {
+	var keyphrases []models.DreamKeyphrase
+	err := s.db.WithContext(ctx).
+		Joins("JOIN dreams ON dreams.id = dream_keyphrases.dream_id AND dreams.deleted_at IS NULL").
+		Find(&keyphrases).Error
+	if err != nil {
+		return DreamSigns{}, fmt.Errorf("failed to load keyphrases: %w", err)
+	}
+
+	clusters := clusterKeyphrases(keyphrases, minCount)
+	clusters = clusters[:min(limit, len(clusters))]
+
+	ids := make(map[uint]bool)
+	for _, cluster := range clusters {
+		for id := range cluster.dreams {
+			ids[id] = true
+		}
+	}
+	dreamIDs := make([]uint, 0, len(ids))
+	for id := range ids {
+		dreamIDs = append(dreamIDs, id)
+	}
+	var dreams []models.Dream
+	if len(dreamIDs) > 0 {
+		if err := s.db.WithContext(ctx).Select("id", "dream", "dreamt_on", "created_at").Where("id IN ?", dreamIDs).Find(&dreams).Error; err != nil {
+			return DreamSigns{}, fmt.Errorf("failed to load dreams: %w", err)
+		}
+	}
+	sort.Slice(dreams, func(i, j int) bool {
+		return NewExportedDream(dreams[i]).Date() < NewExportedDream(dreams[j]).Date()
+	})
+
+	result := DreamSigns{Signs: make([]DreamSign, 0, len(clusters))}
+	for _, cluster := range clusters {
+		phrases := cluster.rankedPhrases()
+		sign := DreamSign{
+			Label:   phrases[0],
+			Phrases: phrases,
+			Count:   len(cluster.dreams),
+			Score:   cluster.score,
+			Dreams:  make([]SignDream, 0, len(cluster.dreams)),
+		}
+		for _, dream := range dreams {
+			if cluster.dreams[dream.ID] {
+				sign.Dreams = append(sign.Dreams, SignDream{ID: dream.ID, DreamtOn: dream.DreamtOn, Excerpt: markdownExcerpt(dream.Dream)})
+			}
+		}
+		result.Signs = append(result.Signs, sign)
+	}
+
+	s.mu.Lock()
+	result.AnalyzedAt = s.analyzed
+	s.mu.Unlock()
+	return result, nil
+}
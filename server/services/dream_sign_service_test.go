@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dreams/models"
+)
+
+func TestCandidatePhrases(t *testing.T) {
+	counts, total := candidatePhrases("My teeth were falling out. Teeth everywhere, falling!")
+	if total != 5 || counts["teeth"] != 2 || counts["teeth falling"] != 1 || counts["teeth everywhere"] != 1 || counts["falling teeth"] != 0 {
+		t.Errorf("unexpected phrases %v (%d words)", counts, total)
+	}
+}
+
+func TestPhraseKey(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"flying", "flies"},
+		{"teeth falling out", "teeth falls"},
+		{"running late", "run late"},
+	} {
+		if phraseKey(pair[0]) != phraseKey(pair[1]) {
+			t.Errorf("expected %q and %q to share a key, got %q and %q", pair[0], pair[1], phraseKey(pair[0]), phraseKey(pair[1]))
+		}
+	}
+	if phraseKey("glass") == phraseKey("gla") {
+		t.Error("expected double s to be kept")
+	}
+}
+
+func TestClusterKeyphrases(t *testing.T) {
+	keyphrases := []models.DreamKeyphrase{
+		{DreamID: 1, Phrase: "teeth", Score: 0.5},
+		{DreamID: 1, Phrase: "dentist", Score: 0.2},
+		{DreamID: 2, Phrase: "teeth", Score: 0.4},
+		{DreamID: 2, Phrase: "dentist", Score: 0.3},
+		{DreamID: 3, Phrase: "teeth", Score: 0.1},
+		{DreamID: 2, Phrase: "flying", Score: 0.3},
+		{DreamID: 4, Phrase: "flies", Score: 0.3},
+		{DreamID: 5, Phrase: "volcano", Score: 0.9},
+	}
+	clusters := clusterKeyphrases(keyphrases, 2)
+	if len(clusters) != 2 {
+		t.Fatalf("expected teeth and flying clusters, got %d", len(clusters))
+	}
+	if got := fmt.Sprint(clusters[0].rankedPhrases(), len(clusters[0].dreams)); got != "[teeth dentist] 3" {
+		t.Errorf("unexpected first cluster %s", got)
+	}
+	if got := fmt.Sprint(clusters[1].rankedPhrases()); got != "[flies flying]" {
+		t.Errorf("unexpected second cluster %s", got)
+	}
+}
+
+func TestDreamSigns(t *testing.T) {
+	db := openTestDB(t)
+	texts := []string{
+		"My teeth were falling out in the middle of an exam.",
+		"I was late for the train and my teeth were falling out again.",
+		"Late for an exam at my old school, the clock kept changing.",
+		"A calm walk through an orchard.",
+	}
+	for _, text := range texts {
+		if err := db.Create(&models.Dream{Dream: text}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	llmCalls := 0
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llmCalls++
+		var req struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		answer := `{"signs": []}`
+		if strings.Contains(strings.ToLower(req.Prompt), "late for") {
+			answer = `{"signs": ["Being late!", "a sign that is far too long to be one"]}`
+		}
+		json.NewEncoder(w).Encode(map[string]string{"response": answer})
+	}))
+	defer llm.Close()
+
+	service := NewDreamSignService(db, NewLLMClient(llm.URL, "test-model"))
+	if err := service.AnalyzeIfChanged(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AnalyzeIfChanged(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if llmCalls != len(texts) {
+		t.Errorf("expected each dream to be sent to the model once, got %d calls", llmCalls)
+	}
+
+	signs, err := service.Signs(t.Context(), 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]DreamSign{}
+	for _, sign := range signs.Signs {
+		for _, phrase := range sign.Phrases {
+			labels[phrase] = sign
+		}
+	}
+	if sign := labels["teeth"]; sign.Count != 2 || !strings.Contains(fmt.Sprint(sign.Phrases), "teeth falling") {
+		t.Errorf("expected teeth falling out to recur, got %+v", signs.Signs)
+	}
+	if sign := labels["being late"]; sign.Count != 2 || len(sign.Dreams) != 2 || sign.Dreams[0].Excerpt == "" {
+		t.Errorf("expected the model's being late sign to recur, got %+v", signs.Signs)
+	}
+	if _, ok := labels["orchard"]; ok {
+		t.Error("expected phrases from one dream to be left out")
+	}
+	if signs.AnalyzedAt == nil {
+		t.Error("expected the analysis time")
+	}
+
+	// Deleted dreams drop out of the signs
+	db.Delete(&models.Dream{}, 2)
+	signs, _ = service.Signs(t.Context(), 2, 10)
+	for _, sign := range signs.Signs {
+		if sign.Label == "teeth" || sign.Label == "teeth falling" {
+			t.Errorf("expected teeth to no longer recur, got %+v", sign)
+		}
+	}
+}
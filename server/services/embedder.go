@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Embedder turns dream text into a vector, where similar dreams have nearby vectors
+type Embedder interface {
+	// Name identifies the model, as vectors from different models can't be compared
+	Name() string
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// NewEmbedder returns an embedder using the Ollama model on host, or the built-in hashing
+// embedder when no model is configured
+func NewEmbedder(host, model string) Embedder {
+	if model == "" {
+		return NewHashingEmbedder(defaultHashingDimensions)
+	}
+	return &OllamaEmbedder{
+		client: &http.Client{Timeout: time.Minute},
+		host:   host,
+		model:  model,
+	}
+}
+
+// OllamaEmbedder embeds text with an embedding model served by Ollama
+type OllamaEmbedder struct {
+	client *http.Client
+	host   string
+	model  string
+}
+
+func (e *OllamaEmbedder) Name() string {
+	return "ollama:" + e.model
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(map[string]string{"model": e.model, "input": text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.host+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach embedding model: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embedding model returned status %d: %s", resp.StatusCode, message)
+	}
+
+	var response struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(response.Embeddings) == 0 || len(response.Embeddings[0]) == 0 {
+		return nil, fmt.Errorf("no embedding returned from embedding model")
+	}
+	return normalizeVector(response.Embeddings[0]), nil
+}
+
+// defaultHashingDimensions is the vector size of the built-in embedder
+const defaultHashingDimensions = 512
+
+// HashingEmbedder is a model-free embedder that hashes the stemmed content words and word
+// pairs of a dream into a fixed number of dimensions. Dreams sharing unusual words end up
+// close together, but unlike a language model it knows nothing of synonyms.
+type HashingEmbedder struct {
+	dimensions int
+}
+
+// NewHashingEmbedder creates a hashing embedder with vectors of the given size
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	return &HashingEmbedder{dimensions: dimensions}
+}
+
+func (e *HashingEmbedder) Name() string {
+	return fmt.Sprintf("hashing-%d", e.dimensions)
+}
+
+func (e *HashingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	counts, _ := candidatePhrases(text)
+	vector := make([]float32, e.dimensions)
+	for phrase, count := range counts {
+		var stems []string
+		for _, word := range strings.Fields(phrase) {
+			stems = append(stems, stemWord(word))
+		}
+		// Dampen repeated words, and count pairs for less than single words
+		weight := 1 + math.Log(float64(count))
+		if len(stems) > 1 {
+			weight /= 2
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(stems, " ")))
+		sum := hash.Sum64()
+		// The sign bit spreads out collisions instead of piling them up
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(e.dimensions)] += float32(weight)
+	}
+	return normalizeVector(vector), nil
+}
+
+// normalizeVector scales v to unit length, so cosine similarity is a dot product
+func normalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// encodeVector packs a vector as little-endian float32s for storage
+func encodeVector(v []float32) []byte {
+	data := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(x))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	v := make([]float32, len(data)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return v
+}
+
+// dot is the dot product of two vectors, or of their common prefix if the sizes differ
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range min(len(a), len(b)) {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
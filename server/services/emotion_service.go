@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// emotionInterval is how often the background scorer looks for unscored dreams
+	emotionInterval = time.Minute
+	// emotionBatchSize is how many dreams the background scorer loads per query
+	emotionBatchSize = 50
+)
+
+// Mood trend periods
+const (
+	MoodByDay   = "day"
+	MoodByWeek  = "week"
+	MoodByMonth = "month"
+)
+
+// MoodPeriod is the average emotion scores of the dreams in a day (2024-02-05), week
+// (2024-W05) or month (2024-02)
+type MoodPeriod struct {
+	Period string `json:"period"`
+	// Dreams is how many scored dreams the averages cover, zero for periods without any
+	Dreams int `json:"dreams"`
+	models.Emotions
+}
+
+// MoodTrends is the average emotions of the journal over time
+type MoodTrends struct {
+	From    *models.Date `json:"from,omitempty"`
+	To      *models.Date `json:"to,omitempty"`
+	Period  string       `json:"period"`
+	Periods []MoodPeriod `json:"periods"`
+	// Average is over every scored dream in the range
+	Average models.Emotions `json:"average"`
+	Dreams  int             `json:"dreams"`
+}
+
+// EmotionService tags dreams with emotion scores. Dreams are scored with the lexicon as
+// soon as they are saved, and when a language model is configured it rescores them in the
+// background. Dreams are not owned by users yet, so the mood trends cover every dream.
+type EmotionService struct {
+	db      *gorm.DB
+	dreams  repositories.DreamRepository
+	lexicon EmotionScorer
+	// llm is nil when no language model is configured
+	llm      EmotionScorer
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEmotionService creates an emotion service. llm may be nil to use the lexicon alone.
+func NewEmotionService(db *gorm.DB, dreams repositories.DreamRepository, llm *LLMClient) *EmotionService {
+	s := &EmotionService{
+		db:      db,
+		dreams:  dreams,
+		lexicon: LexiconScorer{},
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	if llm != nil {
+		s.llm = NewLLMEmotionScorer(llm)
+	}
+	return s
+}
+
+// Start scores dreams in the background until Stop is called, catching imported dreams and
+// rescoring with the language model
+func (s *EmotionService) Start() {
+	go func() {
+		ticker := time.NewTicker(emotionInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.ScoreStale(context.Background()); err != nil {
+				log.Printf("Error scoring dream emotions: %v", err)
+			} else if n > 0 {
+				log.Printf("Scored the emotions of %d dreams", n)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background scorer
+func (s *EmotionService) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// ScoreDream scores a newly saved dream with the lexicon and, if a language model is
+// configured, asks the background scorer to refine it
+func (s *EmotionService) ScoreDream(ctx context.Context, dream models.Dream) (models.DreamEmotion, error) {
+	emotion, err := s.score(ctx, s.lexicon, dream)
+	if err != nil {
+		return emotion, err
+	}
+	if s.llm != nil {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return emotion, nil
+}
+
+// score computes and stores the emotions of a dream
+func (s *EmotionService) score(ctx context.Context, scorer EmotionScorer, dream models.Dream) (models.DreamEmotion, error) {
+	emotions, err := scorer.Score(ctx, dream.Dream)
+	if err != nil {
+		return models.DreamEmotion{}, fmt.Errorf("failed to score dream %d with the %s: %w", dream.ID, scorer.Source(), err)
+	}
+	emotion := models.DreamEmotion{
+		DreamID:      dream.ID,
+		DreamVersion: dream.Version,
+		Emotions:     emotions,
+		Source:       scorer.Source(),
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&emotion).Error; err != nil {
+		return emotion, fmt.Errorf("failed to save emotions of dream %d: %w", dream.ID, err)
+	}
+	return emotion, nil
+}
+
+// staleDreams returns dreams without scores for their current version, or only lexicon
+// scores when the language model could do better
+func (s *EmotionService) staleDreams(ctx context.Context, limit int) ([]models.Dream, error) {
+	query := s.db.WithContext(ctx).Select("dreams.id", "dreams.version", "dreams.dream").
+		Joins("LEFT JOIN dream_emotions ON dream_emotions.dream_id = dreams.id")
+	if s.llm != nil {
+		query = query.Where("dream_emotions.dream_id IS NULL OR dream_emotions.dream_version <> dreams.version OR dream_emotions.source <> ?", models.EmotionLLM)
+	} else {
+		query = query.Where("dream_emotions.dream_id IS NULL OR dream_emotions.dream_version <> dreams.version")
+	}
+	var dreams []models.Dream
+	err := query.Order("dreams.id").Limit(limit).Find(&dreams).Error
+	return dreams, err
+}
+
+// ScoreStale scores every dream whose scores are missing or out of date and returns how
+// many were scored. If the language model fails, dreams without any current scores get
+// lexicon scores and the rest wait for the next run.
+func (s *EmotionService) ScoreStale(ctx context.Context) (int, error) {
+	scorer := s.lexicon
+	if s.llm != nil {
+		scorer = s.llm
+	}
+	scored := 0
+	for {
+		dreams, err := s.staleDreams(ctx, emotionBatchSize)
+		if err != nil {
+			return scored, err
+		}
+		for _, dream := range dreams {
+			if _, err := s.score(ctx, scorer, dream); err != nil {
+				if s.llm == nil {
+					return scored, err
+				}
+				// Charts would have gaps while the language model is down, so fall back
+				if _, lexiconErr := s.scoreIfMissing(ctx, dream); lexiconErr != nil {
+					return scored, lexiconErr
+				}
+				return scored, err
+			}
+			scored++
+		}
+		if len(dreams) < emotionBatchSize {
+			return scored, nil
+		}
+	}
+}
+
+// scoreIfMissing scores the dream with the lexicon unless it already has scores for its
+// current version
+func (s *EmotionService) scoreIfMissing(ctx context.Context, dream models.Dream) (models.DreamEmotion, error) {
+	var emotion models.DreamEmotion
+	err := s.db.WithContext(ctx).Where("dream_id = ? AND dream_version = ?", dream.ID, dream.Version).
+		Limit(1).Find(&emotion).Error
+	if err != nil {
+		return emotion, err
+	}
+	if emotion.DreamID != 0 {
+		return emotion, nil
+	}
+	return s.score(ctx, s.lexicon, dream)
+}
+
+// Emotions returns the emotion scores of a dream, scoring it with the lexicon first if it
+// hasn't been yet. Returns repositories.ErrNotFound if the dream doesn't exist.
+func (s *EmotionService) Emotions(ctx context.Context, id uint) (models.DreamEmotion, error) {
+	dream, err := s.dreams.Get(ctx, id)
+	if err != nil {
+		return models.DreamEmotion{}, err
+	}
+	return s.scoreIfMissing(ctx, dream)
+}
+
+// Moods averages the emotion scores of the dreams in the range by day, week or month.
+// Periods without scored dreams are included so the trends can be charted directly.
+func (s *EmotionService) Moods(ctx context.Context, r StatsRange, period string) (MoodTrends, error) {
+	trends := MoodTrends{From: r.From, To: r.To, Period: period, Periods: []MoodPeriod{}}
+
+	var rows []struct {
+		Day models.Date
+		models.Emotions
+	}
+	err := dreamsInRange(s.db.WithContext(ctx), r).
+		Select(dreamDay + " AS day, dream_emotions.fear, dream_emotions.joy, dream_emotions.sadness, dream_emotions.anger, dream_emotions.surprise").
+		Joins("JOIN dream_emotions ON dream_emotions.dream_id = dreams.id").
+		Order("day").Scan(&rows).Error
+	if err != nil {
+		return trends, fmt.Errorf("failed to load emotions: %w", err)
+	}
+	if len(rows) == 0 {
+		return trends, nil
+	}
+
+	totals := make(map[string]*MoodPeriod)
+	var average MoodPeriod
+	for _, row := range rows {
+		label := moodPeriod(row.Day.Time, period)
+		total, ok := totals[label]
+		if !ok {
+			total = &MoodPeriod{Period: label}
+			totals[label] = total
+		}
+		total.add(row.Emotions)
+		average.add(row.Emotions)
+	}
+	first, last := rows[0].Day.Time, rows[len(rows)-1].Day.Time
+	for day := moodPeriodStart(first, period); !day.After(last); day = nextMoodPeriod(day, period) {
+		label := moodPeriod(day, period)
+		if total, ok := totals[label]; ok {
+			trends.Periods = append(trends.Periods, total.mean())
+		} else {
+			trends.Periods = append(trends.Periods, MoodPeriod{Period: label})
+		}
+	}
+	trends.Average = average.mean().Emotions
+	trends.Dreams = average.Dreams
+	return trends, nil
+}
+
+// add sums the scores of another dream into the period
+func (p *MoodPeriod) add(e models.Emotions) {
+	p.Dreams++
+	p.Fear += e.Fear
+	p.Joy += e.Joy
+	p.Sadness += e.Sadness
+	p.Anger += e.Anger
+	p.Surprise += e.Surprise
+}
+
+// mean turns the summed scores of the period into averages
+func (p MoodPeriod) mean() MoodPeriod {
+	if p.Dreams > 0 {
+		n := float64(p.Dreams)
+		p.Fear, p.Joy, p.Sadness, p.Anger, p.Surprise = p.Fear/n, p.Joy/n, p.Sadness/n, p.Anger/n, p.Surprise/n
+	}
+	return p
+}
+
+// moodPeriod labels the period containing t
+func moodPeriod(t time.Time, period string) string {
+	switch period {
+	case MoodByDay:
+		return t.Format("2006-01-02")
+	case MoodByMonth:
+		return t.Format("2006-01")
+	default:
+		return isoWeek(t)
+	}
+}
+
+// moodPeriodStart is the first day of the period containing t
+func moodPeriodStart(t time.Time, period string) time.Time {
+	switch period {
+	case MoodByDay:
+		return t
+	case MoodByMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	}
+}
+
+// nextMoodPeriod is the first day of the period after the one starting at t
+func nextMoodPeriod(t time.Time, period string) time.Time {
+	switch period {
+	case MoodByDay:
+		return t.AddDate(0, 0, 1)
+	case MoodByMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 7)
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dreams/models"
+	"dreams/repositories"
+)
+
+func TestLexiconScorer(t *testing.T) {
+	score := func(text string) models.Emotions {
+		emotions, err := LexiconScorer{}.Score(t.Context(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return emotions
+	}
+
+	chased := score("I was terrified, something was chasing me through dark corridors and I screamed")
+	if chased.Fear < 0.9 || chased.Joy != 0 {
+		t.Errorf("expected a frightening dream, got %+v", chased)
+	}
+	party := score("A party on the beach, everyone laughing. I hugged my sister and we danced for hours, the music loud and the air warm and salty, and somewhere a lighthouse blinked over the harbour while boats drifted past the rocks.")
+	if party.Joy <= 0.5 || party.Joy >= 1 || party.Fear != 0 {
+		t.Errorf("expected a joyful dream, got %+v", party)
+	}
+	if got := score("I wasn't afraid, and never scared"); got.Fear != 0 {
+		t.Errorf("expected negated fear to be ignored, got %+v", got)
+	}
+	if got := score(""); got != (models.Emotions{}) {
+		t.Errorf("expected no emotions in an empty dream, got %+v", got)
+	}
+}
+
+func TestEmotionsWithLanguageModel(t *testing.T) {
+	db := openTestDB(t)
+	dreams := repositories.NewDreamRepository(db)
+	dream := models.Dream{Dream: "Crying at a funeral for someone I didn't know"}
+	if err := dreams.Create(t.Context(), &dream); err != nil {
+		t.Fatal(err)
+	}
+
+	available := true
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		var req struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !strings.Contains(req.Prompt, "funeral") {
+			http.Error(w, "unexpected prompt", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"response": `{"sadness": 1.4, "surprise": 0.2, "fear": -1}`})
+	}))
+	defer llm.Close()
+	service := NewEmotionService(db, dreams, NewLLMClient(llm.URL, "test-model"))
+
+	// Saving scores with the lexicon straight away
+	emotion, err := service.ScoreDream(t.Context(), dream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emotion.Source != models.EmotionLexicon || emotion.Sadness == 0 {
+		t.Errorf("expected lexicon scores, got %+v", emotion)
+	}
+
+	// The background scorer replaces them with the model's, clamped to the range
+	if n, err := service.ScoreStale(t.Context()); err != nil || n != 1 {
+		t.Fatalf("expected one dream rescored, got %d %v", n, err)
+	}
+	emotion, err = service.Emotions(t.Context(), dream.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Emotions{Sadness: 1, Surprise: 0.2}
+	if emotion.Source != models.EmotionLLM || emotion.Emotions != want {
+		t.Errorf("expected the model's scores %+v, got %+v", want, emotion)
+	}
+	if n, _ := service.ScoreStale(t.Context()); n != 0 {
+		t.Errorf("expected nothing left to score, got %d", n)
+	}
+
+	// While the model is down, new dreams still get lexicon scores
+	available = false
+	imported := models.Dream{Dream: "Laughing with old friends"}
+	if err := dreams.Create(t.Context(), &imported); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ScoreStale(t.Context()); err == nil {
+		t.Error("expected the model's failure to be reported")
+	}
+	emotion, err = service.Emotions(t.Context(), imported.ID)
+	if err != nil || emotion.Source != models.EmotionLexicon || emotion.Joy == 0 {
+		t.Errorf("expected lexicon scores, got %+v %v", emotion, err)
+	}
+
+	if _, err := service.Emotions(t.Context(), 999); err != repositories.ErrNotFound {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestMoods(t *testing.T) {
+	db := openTestDB(t)
+	date := func(s string) *models.Date {
+		d, err := models.ParseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+	for _, dream := range []models.Dream{
+		{Dream: "Terrified of the monster under the stairs", DreamtOn: date("2024-01-29")},
+		{Dream: "So happy to see the sea again", DreamtOn: date("2024-01-31")},
+		{Dream: "A furious argument with my boss", DreamtOn: date("2024-02-14")},
+		{Dream: "Grief, then tears", DreamtOn: date("2024-05-01")},
+	} {
+		if err := db.Create(&dream).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := NewEmotionService(db, repositories.NewDreamRepository(db), nil)
+	if n, err := service.ScoreStale(t.Context()); err != nil || n != 4 {
+		t.Fatalf("expected four dreams scored, got %d %v", n, err)
+	}
+
+	moods, err := service.Moods(t.Context(), StatsRange{To: date("2024-03-31")}, MoodByWeek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var periods []string
+	for _, period := range moods.Periods {
+		periods = append(periods, fmt.Sprintf("%s:%d", period.Period, period.Dreams))
+	}
+	if got := strings.Join(periods, " "); got != "2024-W05:2 2024-W06:0 2024-W07:1" {
+		t.Errorf("unexpected weeks %s", got)
+	}
+	if first := moods.Periods[0]; first.Fear < 0.45 || first.Fear > 0.5 || first.Joy < 0.45 || first.Joy > 0.5 || first.Anger != 0 {
+		t.Errorf("expected the first week to average its dreams, got %+v", first)
+	}
+	if moods.Dreams != 3 || moods.Average.Anger == 0 || moods.Average.Sadness != 0 {
+		t.Errorf("unexpected average %+v", moods)
+	}
+
+	moods, _ = service.Moods(t.Context(), StatsRange{}, MoodByMonth)
+	if len(moods.Periods) != 5 || moods.Periods[4].Period != "2024-05" || moods.Periods[4].Sadness < 0.9 {
+		t.Errorf("unexpected months %+v", moods.Periods)
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"dreams/models"
+)
+
+// EmotionScorer rates how strongly a dream expresses fear, joy, sadness, anger and surprise
+type EmotionScorer interface {
+	// Source is stored with the scores, either models.EmotionLexicon or models.EmotionLLM
+	Source() string
+	Score(ctx context.Context, text string) (models.Emotions, error)
+}
+
+const (
+	emotionFear = iota
+	emotionJoy
+	emotionSadness
+	emotionAnger
+	emotionSurprise
+	emotionCount
+)
+
+// emotionLexicon maps emotional words to the emotion they express. Words are matched
+// exactly rather than stemmed, as crude stems confuse "hated" with "hat".
+var emotionLexicon = makeEmotionLexicon(map[int]string{
+	emotionFear: `afraid fear feared fearful scared scary scare terrified terrifying terror horror
+horrified horrifying panic panicked panicking dread dreaded frightened frightening fright nervous
+anxious anxiety worried worry chase chased chasing trapped monster threat threatening danger
+dangerous creepy nightmare scream screamed screaming hide hid hiding hunted flee fled fleeing ghost
+demon dying attacked attacking helpless paralyzed haunted menacing sinister`,
+	emotionJoy: `happy happiness joy joyful glad delighted excited excitement laugh laughed
+laughing laughter smile smiled smiling love loved loving fun beautiful wonderful amazing peaceful
+calm freedom celebrate celebrated celebrating celebration party hug hugged hugging warm bliss
+blissful euphoric elated cheerful playful relieved relief proud safe comforting`,
+	emotionSadness: `sad sadness cry cried crying tears grief grieving mourning funeral lonely alone
+loneliness lost loss miss missed missing heartbroken depressed sorrow regret hopeless empty
+abandoned goodbye gloomy unhappy disappointed weeping wept`,
+	emotionAnger: `angry anger mad furious rage raging yell yelled yelling shout shouted shouting
+argue argued arguing argument fight fighting fought hate hated hatred annoyed irritated
+frustrated frustration betrayed betrayal revenge punch punched punching slammed hostile
+resentment jealous`,
+	emotionSurprise: `surprise surprised surprising suddenly sudden shocked shock shocking amazed
+astonished unexpected unexpectedly strange weird bizarre realized startled stunned unbelievable
+mysterious odd transformed`,
+})
+
+func makeEmotionLexicon(words map[int]string) map[string]int {
+	lexicon := make(map[string]int)
+	for emotion, list := range words {
+		for _, word := range strings.Fields(list) {
+			lexicon[word] = emotion
+		}
+	}
+	return lexicon
+}
+
+// lookupEmotion finds the emotion of a word or, failing that, of its singular
+func lookupEmotion(word string) (int, bool) {
+	if emotion, ok := emotionLexicon[word]; ok {
+		return emotion, true
+	}
+	if singular, ok := strings.CutSuffix(word, "s"); ok {
+		emotion, ok := emotionLexicon[singular]
+		return emotion, ok
+	}
+	return 0, false
+}
+
+// negations cancel the emotion of the next couple of words, as in "not afraid"
+var negations = makeWordSet(`not no never without nothing hardly`)
+
+// lexiconScale sets how quickly lexicon scores approach 1. A dream where this share of the
+// content words express an emotion scores about 0.63 for it, and twice the share 0.86.
+const lexiconScale = 0.1
+
+// LexiconScorer scores emotions by counting words from a built-in word list. It needs no
+// model and is fast enough to run on every save, but misses anything said indirectly.
+type LexiconScorer struct{}
+
+func (LexiconScorer) Source() string {
+	return models.EmotionLexicon
+}
+
+func (LexiconScorer) Score(ctx context.Context, text string) (models.Emotions, error) {
+	var hits [emotionCount]float64
+	words := 0
+	negated := 0
+	for _, field := range wordFields(text) {
+		field = strings.ReplaceAll(field, "’", "'")
+		if negations[field] || strings.HasSuffix(field, "n't") {
+			negated = 2
+			continue
+		}
+		word, ok := contentWord(field)
+		if negated > 0 {
+			negated--
+		}
+		if !ok {
+			continue
+		}
+		words++
+		if emotion, ok := lookupEmotion(word); ok && negated == 0 {
+			hits[emotion]++
+		}
+	}
+
+	var scores [emotionCount]float64
+	if words > 0 {
+		for emotion, count := range hits {
+			scores[emotion] = 1 - math.Exp(-count/(float64(words)*lexiconScale))
+		}
+	}
+	return models.Emotions{
+		Fear:     scores[emotionFear],
+		Joy:      scores[emotionJoy],
+		Sadness:  scores[emotionSadness],
+		Anger:    scores[emotionAnger],
+		Surprise: scores[emotionSurprise],
+	}, nil
+}
+
+// LLMEmotionScorer asks a language model to rate the emotions of a dream
+type LLMEmotionScorer struct {
+	llm *LLMClient
+}
+
+// NewLLMEmotionScorer creates a scorer using the language model
+func NewLLMEmotionScorer(llm *LLMClient) *LLMEmotionScorer {
+	return &LLMEmotionScorer{llm: llm}
+}
+
+func (s *LLMEmotionScorer) Source() string {
+	return models.EmotionLLM
+}
+
+func (s *LLMEmotionScorer) Score(ctx context.Context, text string) (models.Emotions, error) {
+	prompt := fmt.Sprintf(`Rate how strongly the dream below expresses each of the emotions fear, joy,
+sadness, anger and surprise, from 0 for not at all to 1 for overwhelmingly.
+Answer with JSON like {"fear": 0.8, "joy": 0, "sadness": 0.1, "anger": 0, "surprise": 0.4}.
+
+Dream:
+%s`, text)
+
+	var answer models.Emotions
+	if err := s.llm.GenerateJSON(ctx, prompt, &answer); err != nil {
+		return answer, err
+	}
+	// Models don't always stay within the range they were asked for
+	for _, score := range []*float64{&answer.Fear, &answer.Joy, &answer.Sadness, &answer.Anger, &answer.Surprise} {
+		*score = min(1, max(0, *score))
+	}
+	return answer, nil
+}
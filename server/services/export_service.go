@@ -0,0 +1,349 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportFormat is a format the journal can be exported in
+type ExportFormat string
+
+const (
+	// ExportJSON is a single JSON document with every dream
+	ExportJSON ExportFormat = "json"
+	// ExportMarkdown is a single Markdown document with every dream
+	ExportMarkdown ExportFormat = "markdown"
+	// ExportZip is a ZIP archive with one Markdown file per dream, an index and the images
+	ExportZip ExportFormat = "zip"
+)
+
+// ExportVersion is the version of the export format, bumped on incompatible changes
+const ExportVersion = 1
+
+// exportBatchSize is how many dreams are loaded at a time while exporting
+const exportBatchSize = 100
+
+// ExportedDream is a dream as written to exports, in JSON and as Markdown front matter.
+// Database IDs and versions are left out so exports can be imported into another journal.
+type ExportedDream struct {
+	Dream        string    `json:"dream" yaml:"-"`
+	CreatedAt    time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" yaml:"updated_at"`
+	DreamtOn     string    `json:"dreamt_on,omitempty" yaml:"dreamt_on,omitempty"`
+	Lucid        bool      `json:"lucid" yaml:"lucid"`
+	Nightmare    bool      `json:"nightmare" yaml:"nightmare"`
+	Recurring    bool      `json:"recurring" yaml:"recurring"`
+	Mood         *int      `json:"mood,omitempty" yaml:"mood,omitempty"`
+	Vividness    *int      `json:"vividness,omitempty" yaml:"vividness,omitempty"`
+	SleepQuality *int      `json:"sleep_quality,omitempty" yaml:"sleep_quality,omitempty"`
+	Tags         []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Image is the image URL in JSON exports and the image's path inside ZIP exports
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+}
+
+// NewExportedDream converts a stored dream for export
+func NewExportedDream(dream models.Dream) ExportedDream {
+	exported := ExportedDream{
+		Dream:        dream.Dream,
+		CreatedAt:    dream.CreatedAt.UTC(),
+		UpdatedAt:    dream.UpdatedAt.UTC(),
+		Lucid:        dream.Lucid,
+		Nightmare:    dream.Nightmare,
+		Recurring:    dream.Recurring,
+		Mood:         dream.Mood,
+		Vividness:    dream.Vividness,
+		SleepQuality: dream.SleepQuality,
+		Image:        dream.ImageURL,
+	}
+	if dream.DreamtOn != nil {
+		exported.DreamtOn = dream.DreamtOn.String()
+	}
+	for _, tag := range dream.Tags {
+		exported.Tags = append(exported.Tags, tag.Name)
+	}
+	return exported
+}
+
+// Date is the night of the dream, falling back to when it was written down
+func (d ExportedDream) Date() string {
+	if d.DreamtOn != "" {
+		return d.DreamtOn
+	}
+	return d.CreatedAt.Format(time.DateOnly)
+}
+
+// ExportDocument is the top level of a JSON export
+type ExportDocument struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Dreams     []ExportedDream `json:"dreams"`
+}
+
+// ExportService writes the whole journal out in one of the export formats
+type ExportService struct {
+	dreams          repositories.DreamRepository
+	storageProvider storage.StorageProvider
+}
+
+// NewExportService creates an export service
+func NewExportService(dreams repositories.DreamRepository, storageProvider storage.StorageProvider) *ExportService {
+	return &ExportService{
+		dreams:          dreams,
+		storageProvider: storageProvider,
+	}
+}
+
+// Export streams every dream, oldest first, to w in the given format. Dreams are loaded
+// in batches so the journal is never held in memory at once. Nothing is written to w
+// until the first batch has loaded.
+func (s *ExportService) Export(ctx context.Context, w io.Writer, format ExportFormat) error {
+	switch format {
+	case ExportJSON:
+		return s.exportJSON(ctx, w)
+	case ExportMarkdown:
+		return s.exportMarkdown(ctx, w)
+	case ExportZip:
+		return s.exportZip(ctx, w)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// EachDream calls fn with every dream matching the query, oldest first, a batch at a time.
+// The query's limit, cursor and order are overridden.
+func (s *ExportService) EachDream(ctx context.Context, query repositories.DreamListQuery, fn func(models.Dream) error) error {
+	return eachDream(ctx, s.dreams, query, fn)
+}
+
+func eachDream(ctx context.Context, dreams repositories.DreamRepository, query repositories.DreamListQuery, fn func(models.Dream) error) error {
+	query.Limit = exportBatchSize
+	query.Order = repositories.SortOldest
+	query.Cursor = nil
+	for {
+		page, err := dreams.List(ctx, query)
+		if err != nil {
+			return err
+		}
+		more := len(page) > exportBatchSize
+		if more {
+			page = page[:exportBatchSize]
+		}
+		for _, dream := range page {
+			if err := fn(dream); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+		last := page[len(page)-1]
+		query.Cursor = &repositories.DreamCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+func (s *ExportService) exportJSON(ctx context.Context, w io.Writer) error {
+	// Write the ExportDocument envelope by hand so the dreams can be streamed into it
+	exportedAt, err := json.Marshal(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	envelope := fmt.Sprintf(`{"version":%d,"exported_at":%s,"dreams":[`, ExportVersion, exportedAt)
+
+	// Nothing is written until the first batch has loaded, so a failing query can still be
+	// reported to the client
+	first := true
+	err = s.EachDream(ctx, repositories.DreamListQuery{}, func(dream models.Dream) error {
+		data, err := json.Marshal(NewExportedDream(dream))
+		if err != nil {
+			return err
+		}
+		prefix := ","
+		if first {
+			prefix = envelope
+		}
+		first = false
+		_, err = io.WriteString(w, prefix+string(data)+"\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if first {
+		if _, err := io.WriteString(w, envelope); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+func (s *ExportService) exportMarkdown(ctx context.Context, w io.Writer) error {
+	// The title waits for the first batch, like the JSON envelope
+	const title = "# Dream journal\n"
+	first := true
+	err := s.EachDream(ctx, repositories.DreamListQuery{}, func(dream models.Dream) error {
+		exported := NewExportedDream(dream)
+		var b strings.Builder
+		if first {
+			b.WriteString(title)
+			first = false
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", exported.Date())
+		if summary := markdownSummary(exported); summary != "" {
+			fmt.Fprintf(&b, "*%s*\n\n", summary)
+		}
+		if exported.Image != "" {
+			fmt.Fprintf(&b, "![](%s)\n\n", exported.Image)
+		}
+		b.WriteString(strings.TrimSpace(exported.Dream) + "\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+	if err != nil || !first {
+		return err
+	}
+	_, err = io.WriteString(w, title)
+	return err
+}
+
+func (s *ExportService) exportZip(ctx context.Context, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	var index strings.Builder
+	index.WriteString("# Dream journal\n\n")
+	// Image keys are content addresses, so dreams can share an image. Each is written
+	// once and its path reused, as duplicate entries break unzip tools.
+	images := make(map[string]string)
+
+	err := s.EachDream(ctx, repositories.DreamListQuery{}, func(dream models.Dream) error {
+		exported := NewExportedDream(dream)
+		exported.Image = ""
+		if key, ok := storage.ImageKey(s.storageProvider, dream.ImageURL); ok {
+			name, written := images[key]
+			if !written {
+				var err error
+				if name, err = s.writeZipImage(ctx, archive, key); err != nil {
+					return err
+				}
+				images[key] = name
+			}
+			exported.Image = name
+		}
+
+		name := fmt.Sprintf("dreams/%s-%d.md", exported.Date(), dream.ID)
+		data, err := MarshalMarkdownDream(exported)
+		if err != nil {
+			return err
+		}
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: exported.UpdatedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&index, "- [%s](%s) %s\n", exported.Date(), name, markdownExcerpt(exported.Dream))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := archive.Create("index.md")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, index.String()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeZipImage copies an image from storage into the archive and returns its path there.
+// Missing images are skipped so one lost file doesn't fail the whole export.
+func (s *ExportService) writeZipImage(ctx context.Context, archive *zip.Writer, key string) (string, error) {
+	data, err := s.storageProvider.GetImage(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read image %s: %w", key, err)
+	}
+
+	// Images are already compressed, so they are stored as is
+	name := path.Join("images", key)
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	return name, err
+}
+
+// MarshalMarkdownDream renders a dream as Markdown with its metadata as YAML front matter
+func MarshalMarkdownDream(dream ExportedDream) ([]byte, error) {
+	frontMatter, err := yaml.Marshal(dream)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	b.Write(frontMatter)
+	b.WriteString("---\n\n")
+	if dream.Image != "" {
+		// Images live next to the dreams directory in ZIP exports
+		fmt.Fprintf(&b, "![](../%s)\n\n", dream.Image)
+	}
+	b.WriteString(strings.TrimSpace(dream.Dream) + "\n")
+	return b.Bytes(), nil
+}
+
+// markdownSummary lists a dream's tags, flags and ratings on one line
+func markdownSummary(dream ExportedDream) string {
+	var parts []string
+	if len(dream.Tags) > 0 {
+		parts = append(parts, "Tags: "+strings.Join(dream.Tags, ", "))
+	}
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{{"Lucid", dream.Lucid}, {"Nightmare", dream.Nightmare}, {"Recurring", dream.Recurring}} {
+		if flag.set {
+			parts = append(parts, flag.name)
+		}
+	}
+	for _, rating := range []struct {
+		name  string
+		value *int
+	}{{"Mood", dream.Mood}, {"Vividness", dream.Vividness}, {"Sleep quality", dream.SleepQuality}} {
+		if rating.value != nil {
+			parts = append(parts, fmt.Sprintf("%s %d/%d", rating.name, *rating.value, models.MaxRating))
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// markdownExcerpt is the start of the dream text on a single line for the index
+func markdownExcerpt(text string) string {
+	const maxExcerpt = 80
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxExcerpt {
+		text = strings.TrimSpace(string(runes[:maxExcerpt])) + "…"
+	}
+	return text
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services/storage"
+)
+
+func TestExportEachDreamPagesThroughEveryDream(t *testing.T) {
+	dreams := repositories.NewMemoryDreamRepository()
+	ctx := context.Background()
+	total := exportBatchSize*2 + 5
+	for i := 0; i < total; i++ {
+		dreams.Create(ctx, &models.Dream{Dream: "A dream"})
+	}
+
+	seen := map[uint]bool{}
+	var lastID uint
+	err := NewExportService(dreams, nil).EachDream(ctx, repositories.DreamListQuery{}, func(dream models.Dream) error {
+		if seen[dream.ID] || dream.ID < lastID {
+			t.Errorf("dream %d visited out of order", dream.ID)
+		}
+		seen[dream.ID] = true
+		lastID = dream.ID
+		return nil
+	})
+	if err != nil || len(seen) != total {
+		t.Errorf("expected %d dreams, got %d (%v)", total, len(seen), err)
+	}
+}
+
+func TestExportZipWritesSharedImagesOnce(t *testing.T) {
+	dreams := repositories.NewMemoryDreamRepository()
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	key, err := store.SaveImage(ctx, []byte("image"), "ab/cd/abcd.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		dreams.Create(ctx, &models.Dream{Dream: "The same lighthouse", ImageURL: store.GetImageURL(key)})
+	}
+
+	var buf bytes.Buffer
+	if err := NewExportService(dreams, store).Export(ctx, &buf, ExportZip); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := 0
+	for _, file := range archive.File {
+		if file.Name == "images/"+key {
+			images++
+		}
+	}
+	if images != 1 {
+		t.Errorf("expected the shared image once, got %d entries", images)
+	}
+}
+
+func TestExportEmptyJournal(t *testing.T) {
+	service := NewExportService(repositories.NewMemoryDreamRepository(), storage.NewMemoryStorage())
+	for format, want := range map[ExportFormat]string{ExportJSON: "\"dreams\":[]}\n", ExportMarkdown: "# Dream journal\n"} {
+		var buf bytes.Buffer
+		if err := service.Export(t.Context(), &buf, format); err != nil || !strings.HasSuffix(buf.String(), want) {
+			t.Errorf("%s: unexpected export %v %q", format, err, buf.String())
+		}
+	}
+}
+
+func TestBookImagesStopAtTheLimit(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	for _, key := range []string{"a.png", "b.png", "c.png"} {
+		store.SaveImage(ctx, []byte("123456"), key)
+	}
+
+	load := NewExportService(repositories.NewMemoryDreamRepository(), store).bookImages(10)
+	if data, err := load(ctx, "a.png"); err != nil || len(data) != 6 {
+		t.Fatalf("expected the first image, got %d bytes (%v)", len(data), err)
+	}
+	for _, key := range []string{"b.png", "c.png"} {
+		if _, err := load(ctx, key); err == nil {
+			t.Errorf("expected %s to be left out once the limit is reached", key)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+)
+
+// ImageVariant names a derived rendition of a generated image
+type ImageVariant string
+
+const (
+	// VariantThumbnail is a small rendition used for list cards
+	VariantThumbnail ImageVariant = "thumbnail"
+	// VariantMedium is a mid-sized rendition used for detail views on small screens
+	VariantMedium ImageVariant = "medium"
+	// VariantJPEG is a full-size JPEG fallback of the original PNG
+	VariantJPEG ImageVariant = "jpeg"
+)
+
+// variantSpec describes how a variant is rendered
+type variantSpec struct {
+	name   ImageVariant
+	width  int // Target width in pixels, 0 keeps the original size
+	suffix string
+	format string
+}
+
+var variantSpecs = []variantSpec{
+	{name: VariantThumbnail, width: 256, suffix: "_thumb", format: "png"},
+	{name: VariantMedium, width: 768, suffix: "_medium", format: "png"},
+	{name: VariantJPEG, width: 0, suffix: "", format: "jpg"},
+}
+
+const jpegQuality = 85
+
+// renderedVariant holds the encoded bytes of a variant and the key it should be stored under
+type renderedVariant struct {
+	name     ImageVariant
+	filename string
+	data     []byte
+}
+
+// variantFilename derives the storage key of a variant from the original filename
+func variantFilename(filename string, spec variantSpec) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return base + spec.suffix + "." + spec.format
+}
+
+// renderVariants decodes the original image and produces every variant that makes sense for it.
+// Resized variants are skipped when the original is already narrower than the target width.
+func renderVariants(original []byte, filename string) ([]renderedVariant, error) {
+	src, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	variants := make([]renderedVariant, 0, len(variantSpecs))
+	for _, spec := range variantSpecs {
+		// A JPEG original is its own fallback
+		if spec.width == 0 && filepath.Ext(filename) == "."+spec.format {
+			continue
+		}
+
+		img := src
+		if spec.width > 0 {
+			if src.Bounds().Dx() <= spec.width {
+				continue
+			}
+			img = resizeToWidth(src, spec.width)
+		}
+
+		var buf bytes.Buffer
+		switch spec.format {
+		case "jpg":
+			err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: jpegQuality})
+		default:
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s variant: %w", spec.name, err)
+		}
+
+		variants = append(variants, renderedVariant{
+			name:     spec.name,
+			filename: variantFilename(filename, spec),
+			data:     buf.Bytes(),
+		})
+	}
+
+	return variants, nil
+}
+
+// resizeToWidth scales the image down to the given width, keeping the aspect ratio.
+// Each destination pixel is the average of the source pixels it covers (box filter),
+// which gives clean results for the downscaling we need without extra dependencies.
+func resizeToWidth(src image.Image, width int) *image.RGBA {
+	sb := src.Bounds()
+	height := sb.Dy() * width / sb.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := sb.Min.Y + y*sb.Dy()/height
+		y1 := sb.Min.Y + (y+1)*sb.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := sb.Min.X + x*sb.Dx()/width
+			x1 := sb.Min.X + (x+1)*sb.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// flatten composites the image onto a white background since JPEG has no alpha channel
+func flatten(src image.Image) image.Image {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
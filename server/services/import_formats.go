@@ -0,0 +1,417 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImportFormat is a format dreams can be imported from
+type ImportFormat string
+
+const (
+	// ImportJSON is the JSON export, or a bare array of exported dreams
+	ImportJSON ImportFormat = "json"
+	// ImportZip is a ZIP of Markdown files with optional YAML front matter, like the ZIP export
+	ImportZip ImportFormat = "zip"
+	// ImportCSV is a CSV file with a header row, mapped to dream fields by CSVMapping
+	ImportCSV ImportFormat = "csv"
+)
+
+// importItem is one dream read from an import file. Items that failed to parse carry the
+// error so the rest of the file can still be imported.
+type importItem struct {
+	// Source says where the dream came from in error reports, such as "line 4"
+	Source string
+	Dream  ExportedDream
+	Image  []byte
+	Err    error
+}
+
+// importDateLayouts are the date formats accepted in front matter and CSV files
+var importDateLayouts = []string{
+	time.RFC3339Nano,
+	time.DateTime,
+	time.DateOnly,
+	"2006/01/02",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// parseImportTime parses a date or timestamp in any of importDateLayouts
+func parseImportTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// parseImportBool accepts the usual spreadsheet spellings of true and false
+func parseImportBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "false", "no", "n", "f":
+		return false, nil
+	case "1", "true", "yes", "y", "t", "x":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// splitImportTags splits a tag list written as a comma or semicolon separated string
+func splitImportTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// readJSONImport streams the dreams out of a JSON export, or a bare array of dreams
+func readJSONImport(r io.Reader, fn func(importItem) error) error {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	// Skip the envelope fields up to the dreams array
+	if token == json.Delim('{') {
+		for {
+			key, err := decoder.Token()
+			if err != nil {
+				return fmt.Errorf("invalid JSON: %w", err)
+			}
+			if key == json.Delim('}') {
+				return errors.New(`JSON export has no "dreams" array`)
+			}
+			if key == "dreams" {
+				break
+			}
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return fmt.Errorf("invalid JSON: %w", err)
+			}
+		}
+		if token, err = decoder.Token(); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	if token != json.Delim('[') {
+		return errors.New("expected a JSON export or an array of dreams")
+	}
+
+	for i := 1; decoder.More(); i++ {
+		item := importItem{Source: fmt.Sprintf("dream %d", i)}
+		if err := decoder.Decode(&item.Dream); err != nil {
+			// A syntax error leaves the decoder unusable, so only type errors are per item
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				return fmt.Errorf("invalid JSON in %s: %w", item.Source, err)
+			}
+			item.Err = err
+		}
+		// Image URLs point into the exporting journal, so they aren't carried over
+		item.Dream.Image = ""
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownFrontMatter is the YAML front matter understood in Markdown imports. Besides
+// the export's own fields, date is accepted for dreamt_on and tags may be a string.
+type markdownFrontMatter struct {
+	Date         string    `yaml:"date"`
+	DreamtOn     string    `yaml:"dreamt_on"`
+	CreatedAt    string    `yaml:"created_at"`
+	UpdatedAt    string    `yaml:"updated_at"`
+	Lucid        bool      `yaml:"lucid"`
+	Nightmare    bool      `yaml:"nightmare"`
+	Recurring    bool      `yaml:"recurring"`
+	Mood         *int      `yaml:"mood"`
+	Vividness    *int      `yaml:"vividness"`
+	SleepQuality *int      `yaml:"sleep_quality"`
+	Tags         yaml.Node `yaml:"tags"`
+	Image        string    `yaml:"image"`
+}
+
+// readZipImport reads every Markdown file in the archive as a dream, with images
+// referenced from front matter loaded from the archive. The index written by the ZIP
+// export is skipped.
+func readZipImport(archive *zip.Reader, fn func(importItem) error) error {
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[path.Clean(file.Name)] = file
+	}
+
+	for _, file := range archive.File {
+		name := path.Clean(file.Name)
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(name), ".md") || name == "index.md" {
+			continue
+		}
+
+		item := importItem{Source: name}
+		data, err := readZipFile(file)
+		if err == nil {
+			item.Dream, err = parseMarkdownDream(data)
+		}
+		if err == nil && item.Dream.Image != "" {
+			image, ok := files[path.Clean(item.Dream.Image)]
+			if !ok {
+				err = fmt.Errorf("image %s is missing from the archive", item.Dream.Image)
+			} else {
+				item.Image, err = readZipFile(image)
+			}
+		}
+		item.Err = err
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxZipEntrySize guards against archives that inflate far beyond their upload size
+const maxZipEntrySize = 32 << 20
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > maxZipEntrySize {
+		return nil, fmt.Errorf("%s is larger than %d MB", file.Name, maxZipEntrySize>>20)
+	}
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxZipEntrySize))
+}
+
+// parseMarkdownDream reads a dream from Markdown with optional YAML front matter
+func parseMarkdownDream(data []byte) (ExportedDream, error) {
+	var dream ExportedDream
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		frontMatter, body, found := strings.Cut(rest, "\n---\n")
+		if !found {
+			return dream, errors.New("front matter is not closed with ---")
+		}
+		var meta markdownFrontMatter
+		if err := yaml.Unmarshal([]byte(frontMatter), &meta); err != nil {
+			return dream, fmt.Errorf("invalid front matter: %w", err)
+		}
+		if err := meta.apply(&dream); err != nil {
+			return dream, err
+		}
+		text = body
+	}
+
+	// The ZIP export repeats the image above the text, which the image field already covers
+	text = strings.TrimSpace(text)
+	if dream.Image != "" {
+		text = strings.TrimSpace(strings.TrimPrefix(text, fmt.Sprintf("![](../%s)", dream.Image)))
+	}
+	dream.Dream = text
+	return dream, nil
+}
+
+// apply copies the front matter onto the dream
+func (m markdownFrontMatter) apply(dream *ExportedDream) error {
+	dream.Lucid, dream.Nightmare, dream.Recurring = m.Lucid, m.Nightmare, m.Recurring
+	dream.Mood, dream.Vividness, dream.SleepQuality = m.Mood, m.Vividness, m.SleepQuality
+	dream.Image = m.Image
+
+	dreamtOn := m.DreamtOn
+	if dreamtOn == "" {
+		dreamtOn = m.Date
+	}
+	if dreamtOn != "" {
+		t, err := parseImportTime(dreamtOn)
+		if err != nil {
+			return err
+		}
+		dream.DreamtOn = t.Format(time.DateOnly)
+	}
+	for _, timestamp := range []struct {
+		value string
+		dest  *time.Time
+	}{{m.CreatedAt, &dream.CreatedAt}, {m.UpdatedAt, &dream.UpdatedAt}} {
+		if timestamp.value != "" {
+			t, err := parseImportTime(timestamp.value)
+			if err != nil {
+				return err
+			}
+			*timestamp.dest = t
+		}
+	}
+
+	switch m.Tags.Kind {
+	case 0:
+	case yaml.ScalarNode:
+		dream.Tags = splitImportTags(m.Tags.Value)
+	case yaml.SequenceNode:
+		if err := m.Tags.Decode(&dream.Tags); err != nil {
+			return fmt.Errorf("invalid tags: %w", err)
+		}
+	default:
+		return errors.New("tags must be a list or a comma separated string")
+	}
+	return nil
+}
+
+// CSVMapping maps dream fields to the CSV columns holding them
+type CSVMapping map[string]string
+
+// csvFields are the dream fields a CSV column can be mapped to
+var csvFields = []string{"dream", "dreamt_on", "created_at", "tags", "lucid", "nightmare", "recurring", "mood", "vividness", "sleep_quality"}
+
+// Validate checks the mapping only names known fields
+func (m CSVMapping) Validate() error {
+	for field := range m {
+		known := false
+		for _, name := range csvFields {
+			known = known || field == name
+		}
+		if !known {
+			return fmt.Errorf("unknown field %q in column mapping", field)
+		}
+	}
+	return nil
+}
+
+// readCSVImport reads a dream from every row after the header. Fields missing from the
+// mapping are read from columns with the same name as the field, ignoring case.
+func readCSVImport(r io.Reader, mapping CSVMapping, fn func(importItem) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	// Spreadsheet exports often start with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns := make(map[string]int)
+	for _, field := range csvFields {
+		name, mapped := mapping[field]
+		if !mapped {
+			name = field
+		}
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+				columns[field] = i
+				break
+			}
+		}
+		if _, found := columns[field]; mapped && !found {
+			return fmt.Errorf("CSV has no %q column for %s", name, field)
+		}
+	}
+	if _, ok := columns["dream"]; !ok {
+		return errors.New(`CSV has no "dream" column, map one to the dream field`)
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		item := importItem{Source: fmt.Sprintf("line %d", line)}
+		item.Dream, item.Err = parseCSVDream(record, columns)
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+}
+
+// parseCSVDream reads the mapped columns of a CSV record
+func parseCSVDream(record []string, columns map[string]int) (ExportedDream, error) {
+	var dream ExportedDream
+	value := func(field string) string {
+		if i, ok := columns[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	dream.Dream = value("dream")
+	dream.Tags = splitImportTags(value("tags"))
+	if v := value("dreamt_on"); v != "" {
+		t, err := parseImportTime(v)
+		if err != nil {
+			return dream, fmt.Errorf("dreamt_on: %w", err)
+		}
+		dream.DreamtOn = t.Format(time.DateOnly)
+	}
+	if v := value("created_at"); v != "" {
+		t, err := parseImportTime(v)
+		if err != nil {
+			return dream, fmt.Errorf("created_at: %w", err)
+		}
+		dream.CreatedAt = t
+	}
+
+	for _, flag := range []struct {
+		field string
+		dest  *bool
+	}{{"lucid", &dream.Lucid}, {"nightmare", &dream.Nightmare}, {"recurring", &dream.Recurring}} {
+		parsed, err := parseImportBool(value(flag.field))
+		if err != nil {
+			return dream, fmt.Errorf("%s: %w", flag.field, err)
+		}
+		*flag.dest = parsed
+	}
+	for _, rating := range []struct {
+		field string
+		dest  **int
+	}{{"mood", &dream.Mood}, {"vividness", &dream.Vividness}, {"sleep_quality", &dream.SleepQuality}} {
+		if v := value(rating.field); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return dream, fmt.Errorf("%s: invalid number %q", rating.field, v)
+			}
+			*rating.dest = &parsed
+		}
+	}
+	return dream, nil
+}
+
+// DetectImportFormat guesses the format of an upload from its file name and first bytes
+func DetectImportFormat(filename string, head []byte) (ImportFormat, bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return ImportZip, true
+	case strings.EqualFold(path.Ext(filename), ".csv"):
+		return ImportCSV, true
+	case strings.EqualFold(path.Ext(filename), ".json"):
+		return ImportJSON, true
+	}
+	if trimmed := bytes.TrimLeft(head, " \t\r\n\ufeff"); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return ImportJSON, true
+	}
+	return "", false
+}
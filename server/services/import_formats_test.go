@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func collectImport(t *testing.T, read func(fn func(importItem) error) error) []importItem {
+	t.Helper()
+	var items []importItem
+	if err := read(func(item importItem) error {
+		items = append(items, item)
+		return nil
+	}); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	return items
+}
+
+func TestReadJSONImport(t *testing.T) {
+	for _, input := range []string{
+		`{"version":1,"exported_at":"2024-01-01T00:00:00Z","dreams":[{"dream":"One","tags":["a"]},{"dream":"Two","image":"/images/x.png"}]}`,
+		`[{"dream":"One","tags":["a"]},{"dream":"Two"}]`,
+	} {
+		items := collectImport(t, func(fn func(importItem) error) error {
+			return readJSONImport(strings.NewReader(input), fn)
+		})
+		if len(items) != 2 || items[0].Dream.Dream != "One" || fmt.Sprint(items[0].Dream.Tags) != "[a]" || items[1].Dream.Image != "" {
+			t.Errorf("unexpected items from %s: %+v", input, items)
+		}
+	}
+
+	items := collectImport(t, func(fn func(importItem) error) error {
+		return readJSONImport(strings.NewReader(`[{"dream":"ok"},{"dream":5}]`), fn)
+	})
+	if len(items) != 2 || items[0].Err != nil || items[1].Err == nil {
+		t.Errorf("expected only the second dream to fail, got %+v", items)
+	}
+}
+
+func TestParseMarkdownDream(t *testing.T) {
+	dream, err := parseMarkdownDream([]byte("---\r\ndate: March 3, 2021\r\ntags: flying, water\r\nlucid: true\r\nmood: 4\r\n---\r\n\r\nOver the sea.\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dream.DreamtOn != "2021-03-03" || fmt.Sprint(dream.Tags) != "[flying water]" || !dream.Lucid || *dream.Mood != 4 || dream.Dream != "Over the sea." {
+		t.Errorf("unexpected dream %+v", dream)
+	}
+
+	exported := ExportedDream{Dream: "Round trip", DreamtOn: "2022-05-06", Tags: []string{"a", "b"}, Image: "images/x.png"}
+	data, err := MarshalMarkdownDream(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dream, err = parseMarkdownDream(data); err != nil || dream.Dream != "Round trip" || dream.Image != "images/x.png" || fmt.Sprint(dream.Tags) != "[a b]" {
+		t.Errorf("export didn't round trip: %+v (%v)", dream, err)
+	}
+
+	if dream, err = parseMarkdownDream([]byte("Just text")); err != nil || dream.Dream != "Just text" {
+		t.Errorf("expected plain Markdown to be read as text, got %+v (%v)", dream, err)
+	}
+	if _, err := parseMarkdownDream([]byte("---\ndate: someday\n---\nText")); err == nil {
+		t.Error("expected an invalid date to be rejected")
+	}
+}
+
+func TestReadCSVImport(t *testing.T) {
+	input := "\ufeffDate,Entry,Labels,Lucid?\n2020-01-02,Falling down stairs,\"stairs; falling\",yes\n2020-01-03,Late for an exam,,maybe\n"
+	mapping := CSVMapping{"dream": "Entry", "dreamt_on": "date", "tags": "Labels", "lucid": "Lucid?"}
+	items := collectImport(t, func(fn func(importItem) error) error {
+		return readCSVImport(strings.NewReader(input), mapping, fn)
+	})
+	if len(items) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(items))
+	}
+	first := items[0]
+	if first.Err != nil || first.Dream.Dream != "Falling down stairs" || first.Dream.DreamtOn != "2020-01-02" || !first.Dream.Lucid || fmt.Sprint(first.Dream.Tags) != "[stairs falling]" {
+		t.Errorf("unexpected first row %+v", first)
+	}
+	if items[1].Err == nil || items[1].Source != "line 3" {
+		t.Errorf("expected line 3 to fail on its lucid value, got %+v", items[1])
+	}
+
+	err := readCSVImport(strings.NewReader("Text\nx\n"), CSVMapping{}, func(importItem) error { return nil })
+	if err == nil {
+		t.Error("expected a CSV without a dream column to be rejected")
+	}
+	if err := (CSVMapping{"title": "Title"}).Validate(); err == nil {
+		t.Error("expected an unknown field in the mapping to be rejected")
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		head     string
+		want     ImportFormat
+	}{
+		{"journal.zip", "PK\x03\x04...", ImportZip},
+		{"journal.CSV", "date,dream", ImportCSV},
+		{"upload", "  [{\"dream\":\"x\"}]", ImportJSON},
+		{"notes.txt", "hello", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := DetectImportFormat(tt.filename, []byte(tt.head)); got != tt.want {
+			t.Errorf("DetectImportFormat(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
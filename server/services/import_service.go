@@ -0,0 +1,374 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services/storage"
+)
+
+// ImportStatus is the state of an import job
+type ImportStatus string
+
+const (
+	ImportQueued    ImportStatus = "queued"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed"
+)
+
+const (
+	// importJobRetention is how long finished jobs can still be looked up
+	importJobRetention = 24 * time.Hour
+	// maxImportErrors caps the per-dream errors kept on a job
+	maxImportErrors = 100
+	// importPreviewSize is how many dreams a dry run shows
+	importPreviewSize = 20
+)
+
+// ImportError describes a dream that couldn't be imported
+type ImportError struct {
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// ImportJob is the progress and outcome of an import. In a dry run nothing is saved and
+// Imported counts the dreams that would be.
+type ImportJob struct {
+	ID     string       `json:"id"`
+	Format ImportFormat `json:"format"`
+	DryRun bool         `json:"dry_run"`
+	Status ImportStatus `json:"status"`
+	// Progress is the fraction of the file read so far, from 0 to 1
+	Progress   float64         `json:"progress"`
+	Processed  int             `json:"processed"`
+	Imported   int             `json:"imported"`
+	Duplicates int             `json:"duplicates"`
+	Failed     int             `json:"failed"`
+	Errors     []ImportError   `json:"errors,omitempty"`
+	Preview    []ExportedDream `json:"preview,omitempty"`
+	// Error is why the whole job failed, such as an unreadable file
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportRequest holds the options for an import
+type ImportRequest struct {
+	Format  ImportFormat
+	DryRun  bool
+	Mapping CSVMapping
+}
+
+// ImportService runs imports in the background, one at a time, and keeps their status
+// in memory. Dreams whose content hash matches an existing dream are skipped.
+type ImportService struct {
+	dreams          repositories.DreamRepository
+	storageProvider storage.StorageProvider
+	mu              sync.Mutex
+	jobs            map[string]*ImportJob
+	// running serializes jobs so each sees the dreams imported by the one before
+	running sync.Mutex
+}
+
+// NewImportService creates an import service
+func NewImportService(dreams repositories.DreamRepository, storageProvider storage.StorageProvider) *ImportService {
+	return &ImportService{
+		dreams:          dreams,
+		storageProvider: storageProvider,
+		jobs:            make(map[string]*ImportJob),
+	}
+}
+
+// Start queues an import of the file at path, which the job takes ownership of and
+// removes when it finishes
+func (s *ImportService) Start(path string, req ImportRequest) ImportJob {
+	id := make([]byte, 8)
+	rand.Read(id)
+	job := &ImportJob{
+		ID:        hex.EncodeToString(id),
+		Format:    req.Format,
+		DryRun:    req.DryRun,
+		Status:    ImportQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	for id, old := range s.jobs {
+		if old.FinishedAt != nil && time.Since(*old.FinishedAt) > importJobRetention {
+			delete(s.jobs, id)
+		}
+	}
+	s.jobs[job.ID] = job
+	snapshot := s.snapshot(job)
+	s.mu.Unlock()
+
+	go func() {
+		defer os.Remove(path)
+		s.running.Lock()
+		defer s.running.Unlock()
+
+		s.update(job, func(job *ImportJob) { job.Status = ImportRunning })
+		err := s.run(context.Background(), job, path, req)
+		s.update(job, func(job *ImportJob) {
+			now := time.Now().UTC()
+			job.FinishedAt = &now
+			if err != nil {
+				job.Status = ImportFailed
+				job.Error = err.Error()
+				return
+			}
+			job.Status = ImportCompleted
+			job.Progress = 1
+		})
+		if err != nil {
+			log.Printf("Import %s failed: %v", job.ID, err)
+		}
+	}()
+
+	return snapshot
+}
+
+// Job returns the current state of an import job
+func (s *ImportService) Job(id string) (ImportJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return ImportJob{}, false
+	}
+	return s.snapshot(job), true
+}
+
+// snapshot copies a job so it can be read without the lock. Callers must hold s.mu.
+func (s *ImportService) snapshot(job *ImportJob) ImportJob {
+	copied := *job
+	copied.Errors = append([]ImportError(nil), job.Errors...)
+	copied.Preview = append([]ExportedDream(nil), job.Preview...)
+	return copied
+}
+
+func (s *ImportService) update(job *ImportJob, fn func(*ImportJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+// run reads the file in the requested format and imports each dream
+func (s *ImportService) run(ctx context.Context, job *ImportJob, path string, req ImportRequest) error {
+	// Existing dreams are hashed up front, which is cheap next to the import itself
+	seen := make(map[string]bool)
+	err := eachDream(ctx, s.dreams, repositories.DreamListQuery{}, func(dream models.Dream) error {
+		seen[DreamContentHash(NewExportedDream(dream))] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load existing dreams: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	importer := &dreamImporter{service: s, job: job, dryRun: req.DryRun, seen: seen}
+	switch req.Format {
+	case ImportJSON, ImportCSV:
+		reader := &progressReader{r: file, size: info.Size(), onProgress: func(progress float64) {
+			s.update(job, func(job *ImportJob) { job.Progress = progress })
+		}}
+		if req.Format == ImportCSV {
+			return readCSVImport(reader, req.Mapping, importer.add(ctx))
+		}
+		return readJSONImport(reader, importer.add(ctx))
+	case ImportZip:
+		archive, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return fmt.Errorf("invalid ZIP archive: %w", err)
+		}
+		add := importer.add(ctx)
+		read := 0
+		return readZipImport(archive, func(item importItem) error {
+			read++
+			s.update(job, func(job *ImportJob) { job.Progress = float64(read) / float64(len(archive.File)) })
+			return add(item)
+		})
+	default:
+		return fmt.Errorf("unknown import format %q", req.Format)
+	}
+}
+
+// dreamImporter validates, dedupes and saves the dreams of one job
+type dreamImporter struct {
+	service *ImportService
+	job     *ImportJob
+	dryRun  bool
+	seen    map[string]bool
+}
+
+func (i *dreamImporter) add(ctx context.Context) func(importItem) error {
+	return func(item importItem) error {
+		dream, err := item.Dream.toDream()
+		if item.Err != nil {
+			err = item.Err
+		}
+		if err != nil {
+			i.fail(item.Source, err)
+			return nil
+		}
+
+		hash := DreamContentHash(NewExportedDream(dream))
+		if i.seen[hash] {
+			i.service.update(i.job, func(job *ImportJob) {
+				job.Processed++
+				job.Duplicates++
+			})
+			return nil
+		}
+		i.seen[hash] = true
+
+		if i.dryRun {
+			i.service.update(i.job, func(job *ImportJob) {
+				job.Processed++
+				job.Imported++
+				if len(job.Preview) < importPreviewSize {
+					preview := NewExportedDream(dream)
+					preview.Image = item.Dream.Image
+					job.Preview = append(job.Preview, preview)
+				}
+			})
+			return nil
+		}
+
+		// A broken image shouldn't lose the dream, so it's reported and the text imported
+		var imageErr error
+		if len(item.Image) > 0 {
+			image, err := StoreImage(ctx, i.service.storageProvider, item.Image)
+			if err != nil {
+				imageErr = fmt.Errorf("image not imported: %w", err)
+			} else {
+				dream.ImageURL = image.URL
+				dream.ImageVariants = image.Variants
+			}
+		}
+		if err := i.service.dreams.Create(ctx, &dream); err != nil {
+			i.fail(item.Source, err)
+			return nil
+		}
+		i.service.update(i.job, func(job *ImportJob) {
+			job.Processed++
+			job.Imported++
+			if imageErr != nil {
+				job.addError(item.Source, imageErr)
+			}
+		})
+		return nil
+	}
+}
+
+func (i *dreamImporter) fail(source string, err error) {
+	i.service.update(i.job, func(job *ImportJob) {
+		job.Processed++
+		job.Failed++
+		job.addError(source, err)
+	})
+}
+
+func (job *ImportJob) addError(source string, err error) {
+	if len(job.Errors) < maxImportErrors {
+		job.Errors = append(job.Errors, ImportError{Source: source, Message: err.Error()})
+	}
+}
+
+// toDream validates an imported dream and converts it for saving. Dreams without a
+// creation time are dated to the night they happened, or failing that to now.
+func (d ExportedDream) toDream() (models.Dream, error) {
+	dream := models.Dream{
+		Dream:        strings.TrimSpace(d.Dream),
+		Lucid:        d.Lucid,
+		Nightmare:    d.Nightmare,
+		Recurring:    d.Recurring,
+		Mood:         d.Mood,
+		Vividness:    d.Vividness,
+		SleepQuality: d.SleepQuality,
+	}
+	dream.CreatedAt = d.CreatedAt
+	dream.UpdatedAt = d.UpdatedAt
+
+	if d.DreamtOn != "" {
+		date, err := models.ParseDate(d.DreamtOn)
+		if err != nil {
+			return dream, err
+		}
+		dream.DreamtOn = &date
+	}
+	if dream.CreatedAt.IsZero() {
+		if dream.DreamtOn != nil {
+			dream.CreatedAt = dream.DreamtOn.Time
+		} else {
+			dream.CreatedAt = time.Now()
+		}
+	}
+	if dream.DreamtOn == nil {
+		date := models.NewDate(dream.CreatedAt)
+		dream.DreamtOn = &date
+	}
+	if dream.UpdatedAt.Before(dream.CreatedAt) {
+		dream.UpdatedAt = dream.CreatedAt
+	}
+
+	names := make(map[string]bool)
+	for _, tag := range d.Tags {
+		name, err := models.NormalizeTagName(tag)
+		if err != nil {
+			return dream, err
+		}
+		if !names[name] {
+			names[name] = true
+			dream.Tags = append(dream.Tags, models.Tag{Name: name})
+		}
+	}
+
+	return dream, dream.Validate()
+}
+
+// DreamContentHash identifies a dream by the night it happened and its text, ignoring
+// differences in whitespace, so the same dream imported twice is recognised
+func DreamContentHash(dream ExportedDream) string {
+	sum := sha256.Sum256([]byte(dream.Date() + "\n" + strings.Join(strings.Fields(dream.Dream), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// progressReader reports the fraction of a file read
+type progressReader struct {
+	r          io.Reader
+	size       int64
+	read       int64
+	onProgress func(float64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.size > 0 && n > 0 {
+		p.onProgress(float64(p.read) / float64(p.size))
+	}
+	return n, err
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// LLMClient asks a language model served by Ollama for JSON answers
+type LLMClient struct {
+	client *http.Client
+	host   string
+	model  string
+}
+
+// NewLLMClient creates a client for the model on the Ollama server at host. It returns nil
+// when no model is configured, which callers treat as the model being disabled.
+func NewLLMClient(host, model string) *LLMClient {
+	if model == "" {
+		return nil
+	}
+	return &LLMClient{
+		client: &http.Client{Timeout: 2 * time.Minute},
+		host:   host,
+		model:  model,
+	}
+}
+
+// GenerateJSON sends the prompt and decodes the model's JSON answer into out
+func (c *LLMClient) GenerateJSON(ctx context.Context, prompt string, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":  c.model,
+		"prompt": prompt,
+		"format": "json",
+		"stream": false,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.host+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach language model: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("language model returned status %d: %s", resp.StatusCode, message)
+	}
+
+	var response struct {
+		Response string `json:"response"`
+		Error    string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("language model error: %s", response.Error)
+	}
+	if err := json.Unmarshal([]byte(response.Response), out); err != nil {
+		return fmt.Errorf("language model answered with invalid JSON: %w", err)
+	}
+	return nil
+}
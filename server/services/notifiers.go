@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"syscall"
+	"time"
+
+	"dreams/models"
+)
+
+// ErrSubscriptionGone is returned when a reminder's target no longer accepts
+// notifications, such as a Web Push subscription the browser has dropped
+var ErrSubscriptionGone = errors.New("subscription is no longer valid")
+
+// Notification is the message a reminder sends
+type Notification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// URL opens the journal to write the dream down
+	URL string `json:"url"`
+}
+
+// Notifier delivers notifications over one reminder channel
+type Notifier interface {
+	Notify(ctx context.Context, reminder models.Reminder, notification Notification) error
+}
+
+// SMTPConfig is how to reach the mail server for email reminders
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// EmailNotifier sends reminders by email, using STARTTLS when the server offers it
+type EmailNotifier struct {
+	config SMTPConfig
+	now    func() time.Time
+}
+
+// NewEmailNotifier creates an email notifier
+func NewEmailNotifier(config SMTPConfig) *EmailNotifier {
+	return &EmailNotifier{config: config, now: time.Now}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, reminder models.Reminder, notification Notification) error {
+	// Targets can carry a display name, as in "Sam <sam@example.com>", which isn't valid in
+	// the SMTP envelope
+	to, err := mail.ParseAddress(reminder.Target)
+	if err != nil {
+		return fmt.Errorf("invalid email address: %w", err)
+	}
+
+	var message bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", n.config.From},
+		{"To", to.Address},
+		{"Subject", mime.QEncoding.Encode("utf-8", notification.Title)},
+		{"Date", n.now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+	} {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	fmt.Fprintf(&message, "\r\n%s\r\n\r\n%s\r\n", notification.Body, notification.URL)
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+	// net/smtp has no context support, so the send isn't cancelled with ctx
+	addr := net.JoinHostPort(n.config.Host, n.config.Port)
+	if err := smtp.SendMail(addr, auth, n.config.From, []string{to.Address}, message.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// WebhookNotifier posts reminders as JSON to the reminder's URL, for chat bots and home
+// automation. Anyone can create a reminder, so webhooks can't reach loopback or link-local
+// addresses such as the server itself or a cloud metadata service.
+type WebhookNotifier struct {
+	client *http.Client
+	now    func() time.Time
+	// AllowLoopback lets webhooks reach loopback addresses, for tests and single-machine setups
+	AllowLoopback bool
+}
+
+// NewWebhookNotifier creates a webhook notifier
+func NewWebhookNotifier() *WebhookNotifier {
+	n := &WebhookNotifier{now: time.Now}
+	// Addresses are checked as they are dialled, which covers host names and redirects
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: n.checkAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	n.client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return n
+}
+
+// checkAddress rejects connections to addresses webhooks may not reach
+func (n *WebhookNotifier) checkAddress(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("unexpected address %s", address)
+	}
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || (ip.IsLoopback() && !n.AllowLoopback) {
+		return fmt.Errorf("webhooks can't reach %s", ip)
+	}
+	return nil
+}
+
+// webhookPayload is the body of webhook reminders
+type webhookPayload struct {
+	ReminderID uint `json:"reminder_id"`
+	Notification
+	SentAt time.Time `json:"sent_at"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder models.Reminder, notification Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		ReminderID:   reminder.ID,
+		Notification: notification,
+		SentAt:       n.now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reminder.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dreams/models"
+)
+
+var testNotification = Notification{Title: "What did you dream?", Body: "Write it down", URL: "http://localhost:3000"}
+
+// fakeSMTPServer accepts one message and returns it on the channel
+func fakeSMTPServer(t *testing.T) (host, port string, messages chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages = make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		// The envelope commands are passed on ahead of the message
+		var envelope strings.Builder
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 go ahead")
+				var message strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					message.WriteString(line)
+				}
+				messages <- envelope.String() + message.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				if strings.HasPrefix(command, "MAIL") || strings.HasPrefix(command, "RCPT") {
+					envelope.WriteString(strings.TrimSpace(line) + "\r\n")
+				}
+				reply("250 ok")
+			}
+		}
+	}()
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port, messages
+}
+
+func TestEmailNotifier(t *testing.T) {
+	host, port, messages := fakeSMTPServer(t)
+	notifier := NewEmailNotifier(SMTPConfig{Host: host, Port: port, From: "dreams@localhost"})
+	reminder := models.Reminder{Channel: models.ReminderEmail, Target: "Sam Sleeper <sleeper@example.com>"}
+	if err := notifier.Notify(t.Context(), reminder, testNotification); err != nil {
+		t.Fatal(err)
+	}
+	message := <-messages
+	for _, want := range []string{"RCPT TO:<sleeper@example.com>\r\n", "To: sleeper@example.com\r\n", "Subject: What did you dream?\r\n", "\r\n\r\nWrite it down\r\n\r\nhttp://localhost:3000"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("expected the message to contain %q, got %q", want, message)
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received map[string]interface{}
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier()
+	reminder := models.Reminder{ID: 3, Channel: models.ReminderWebhook, Target: server.URL}
+	if err := notifier.Notify(t.Context(), reminder, testNotification); err == nil {
+		t.Error("expected webhooks to the server itself to be refused")
+	}
+	for _, target := range []string{"http://169.254.169.254/latest/meta-data", "http://[::1]:8080/"} {
+		if err := notifier.Notify(t.Context(), models.Reminder{Target: target}, testNotification); err == nil {
+			t.Errorf("expected a webhook to %s to be refused", target)
+		}
+	}
+
+	notifier.AllowLoopback = true
+	if err := notifier.Notify(t.Context(), reminder, testNotification); err != nil {
+		t.Fatal(err)
+	}
+	if received["reminder_id"] != 3.0 || received["title"] != testNotification.Title || received["sent_at"] == nil {
+		t.Errorf("unexpected payload %v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := notifier.Notify(t.Context(), reminder, testNotification); err == nil {
+		t.Error("expected an error for a failed webhook")
+	}
+}
+
+// TestPushContentKeys checks key derivation against the example in RFC 8291 appendix A
+func TestPushContentKeys(t *testing.T) {
+	decode := func(s string) []byte {
+		data, err := models.DecodePushKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	key, nonce, err := pushContentKeys(
+		decode("kyrL1jIIOHEzg3sM2ZWRHDRB62YACZhhSlknJ672kSs"),
+		decode("BTBZMqHH6r4Tts7J_aSIgg"),
+		decode("DGv6ra1nlYgDCS1FRnbzlw"),
+		decode("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		decode("BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	if encode(key) != "oIhVW04MRdy2XN9CiKLxTg" || encode(nonce) != "4h_95klXJ5E_qnoN" {
+		t.Errorf("unexpected key %s and nonce %s", encode(key), encode(nonce))
+	}
+}
+
+// fakePushService stands in for a browser vendor's push service, checking the VAPID
+// token and decrypting messages with the browser's keys
+type fakePushService struct {
+	t          *testing.T
+	server     *httptest.Server
+	browserKey *ecdh.PrivateKey
+	authSecret []byte
+	status     int
+	received   chan Notification
+}
+
+func newFakePushService(t *testing.T) *fakePushService {
+	browserKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakePushService{t: t, browserKey: browserKey, authSecret: make([]byte, 16), status: http.StatusCreated, received: make(chan Notification, 1)}
+	rand.Read(p.authSecret)
+	p.server = httptest.NewServer(http.HandlerFunc(p.handle))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakePushService) subscription() *models.PushSubscription {
+	subscription := &models.PushSubscription{Endpoint: p.server.URL + "/push/abc"}
+	subscription.Keys.P256DH = base64.RawURLEncoding.EncodeToString(p.browserKey.PublicKey().Bytes())
+	subscription.Keys.Auth = base64.RawURLEncoding.EncodeToString(p.authSecret)
+	return subscription
+}
+
+func (p *fakePushService) handle(w http.ResponseWriter, r *http.Request) {
+	if err := p.checkVAPID(r.Header.Get("Authorization")); err != nil {
+		p.t.Errorf("invalid VAPID authorization: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		p.t.Errorf("unexpected headers %v", r.Header)
+	}
+	body, _ := io.ReadAll(r.Body)
+	plaintext, err := p.decrypt(body)
+	if err != nil {
+		p.t.Errorf("failed to decrypt message: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var notification Notification
+	json.Unmarshal(plaintext, &notification)
+	if p.status == http.StatusCreated {
+		p.received <- notification
+	}
+	w.WriteHeader(p.status)
+}
+
+func (p *fakePushService) checkVAPID(header string) error {
+	token, key, ok := strings.Cut(strings.TrimPrefix(header, "vapid t="), ", k=")
+	if !ok {
+		return errors.New("missing token or key")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims struct {
+		Aud string `json:"aud"`
+		Sub string `json:"sub"`
+	}
+	json.Unmarshal(claimsJSON, &claims)
+	if claims.Aud != p.server.URL || claims.Sub != "mailto:admin@example.com" {
+		return errors.New("unexpected claims " + string(claimsJSON))
+	}
+	publicKey, _ := base64.RawURLEncoding.DecodeString(key)
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if len(publicKey) != 65 || len(signature) != 64 {
+		return errors.New("malformed key or signature")
+	}
+	verifier := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(publicKey[1:33]), Y: new(big.Int).SetBytes(publicKey[33:])}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(verifier, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+func (p *fakePushService) decrypt(body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("message too short")
+	}
+	salt, recordSize, idLength := body[:16], binary.BigEndian.Uint32(body[16:20]), int(body[20])
+	serverPublic, ciphertext := body[21:21+idLength], body[21+idLength:]
+	if recordSize < uint32(len(ciphertext)) {
+		return nil, errors.New("record larger than the record size")
+	}
+	serverKey, err := ecdh.P256().NewPublicKey(serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := p.browserKey.ECDH(serverKey)
+	if err != nil {
+		return nil, err
+	}
+	key, nonce, err := pushContentKeys(shared, p.authSecret, salt, p.browserKey.PublicKey().Bytes(), serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		return nil, errors.New("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+func TestWebPushNotifier(t *testing.T) {
+	push := newFakePushService(t)
+	vapidKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier, err := NewWebPushNotifier(base64.RawURLEncoding.EncodeToString(vapidKey.Bytes()), "mailto:admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifier.PublicKey() != base64.RawURLEncoding.EncodeToString(vapidKey.PublicKey().Bytes()) {
+		t.Error("expected the public key of the VAPID key")
+	}
+
+	reminder := models.Reminder{Channel: models.ReminderWebPush, Subscription: push.subscription()}
+	if err := notifier.Notify(t.Context(), reminder, testNotification); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-push.received; got != testNotification {
+		t.Errorf("expected the notification to arrive intact, got %+v", got)
+	}
+
+	push.status = http.StatusGone
+	if err := notifier.Notify(t.Context(), reminder, testNotification); !errors.Is(err, ErrSubscriptionGone) {
+		t.Errorf("expected the subscription to be gone, got %v", err)
+	}
+
+	if _, err := NewWebPushNotifier("not a key", "mailto:admin@example.com"); err == nil {
+		t.Error("expected an invalid key to be rejected")
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// pngSignature is the fixed 8-byte header every PNG file starts with
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Keywords used for the PNG text chunks. "Software" and "Creation Time" are
+// registered PNG keywords, the rest are specific to this application.
+const (
+	keywordPrompt         = "prompt"
+	keywordNegativePrompt = "negative_prompt"
+	keywordModel          = "model"
+	keywordSeed           = "seed"
+	keywordDreamID        = "dream_id"
+	keywordCreationTime   = "Creation Time"
+	keywordSoftware       = "Software"
+)
+
+// provenanceGenerator identifies this application in the Software chunk
+const provenanceGenerator = "dreams"
+
+// maxTextChunkSize caps how far a compressed iTXt chunk is inflated, as uploaded PNGs can
+// carry a small chunk that inflates to gigabytes
+const maxTextChunkSize = 1 << 20
+
+// ErrNotPNG is returned when provenance is requested for data that is not a PNG
+var ErrNotPNG = errors.New("data is not a PNG image")
+
+// ImageProvenance describes how a generated image was produced
+type ImageProvenance struct {
+	Prompt         string    `json:"prompt"`
+	NegativePrompt string    `json:"negative_prompt,omitempty"`
+	Model          string    `json:"model"`
+	Seed           int64     `json:"seed"`
+	DreamID        uint      `json:"dream_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Generator      string    `json:"generator"`
+}
+
+// textEntries returns the provenance as ordered keyword/value pairs
+func (p ImageProvenance) textEntries() [][2]string {
+	return [][2]string{
+		{keywordPrompt, p.Prompt},
+		{keywordNegativePrompt, p.NegativePrompt},
+		{keywordModel, p.Model},
+		{keywordSeed, strconv.FormatInt(p.Seed, 10)},
+		{keywordDreamID, strconv.FormatUint(uint64(p.DreamID), 10)},
+		{keywordCreationTime, p.CreatedAt.UTC().Format(time.RFC3339)},
+		{keywordSoftware, p.Generator},
+	}
+}
+
+// embedProvenance returns a copy of the PNG with text chunks describing its provenance
+// inserted right after the IHDR chunk
+func embedProvenance(data []byte, provenance ImageProvenance) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrNotPNG
+	}
+
+	// IHDR is always the first chunk: 4 bytes length, 4 bytes type, data, 4 bytes CRC
+	offset := len(pngSignature)
+	if len(data) < offset+8 || string(data[offset+4:offset+8]) != "IHDR" {
+		return nil, fmt.Errorf("PNG is missing IHDR chunk")
+	}
+	ihdrEnd := offset + 12 + int(binary.BigEndian.Uint32(data[offset:offset+4]))
+	if ihdrEnd > len(data) {
+		return nil, fmt.Errorf("PNG IHDR chunk is truncated")
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:ihdrEnd])
+	for _, entry := range provenance.textEntries() {
+		if entry[1] == "" {
+			continue
+		}
+		writeTextChunk(&out, entry[0], entry[1])
+	}
+	out.Write(data[ihdrEnd:])
+
+	return out.Bytes(), nil
+}
+
+// writeTextChunk writes a tEXt chunk for ASCII values, whose UTF-8 bytes are also valid
+// Latin-1, and an uncompressed iTXt chunk for anything else, since user prompts can contain
+// any UTF-8
+func writeTextChunk(w *bytes.Buffer, keyword, value string) {
+	var payload bytes.Buffer
+	payload.WriteString(keyword)
+	payload.WriteByte(0)
+
+	chunkType := "tEXt"
+	if !isASCII(value) {
+		chunkType = "iTXt"
+		// Compression flag, compression method, empty language tag and translated keyword
+		payload.Write([]byte{0, 0, 0, 0})
+	}
+	payload.WriteString(value)
+
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(payload.Len()))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(payload.Bytes())
+
+	w.Write(header[:])
+	w.Write(payload.Bytes())
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadProvenance extracts the provenance text chunks from a PNG.
+// It returns nil without an error if the PNG carries no provenance, including PNGs from
+// other software that only have their own Software chunk.
+func ReadProvenance(data []byte) (*ImageProvenance, error) {
+	texts, err := readTextChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := texts[keywordDreamID]; !ok && texts[keywordSoftware] != provenanceGenerator {
+		return nil, nil
+	}
+
+	provenance := &ImageProvenance{
+		Prompt:         texts[keywordPrompt],
+		NegativePrompt: texts[keywordNegativePrompt],
+		Model:          texts[keywordModel],
+		Generator:      texts[keywordSoftware],
+	}
+	if seed, err := strconv.ParseInt(texts[keywordSeed], 10, 64); err == nil {
+		provenance.Seed = seed
+	}
+	if dreamID, err := strconv.ParseUint(texts[keywordDreamID], 10, 32); err == nil {
+		provenance.DreamID = uint(dreamID)
+	}
+	if createdAt, err := time.Parse(time.RFC3339, texts[keywordCreationTime]); err == nil {
+		provenance.CreatedAt = createdAt
+	}
+
+	return provenance, nil
+}
+
+// readTextChunks walks the PNG chunks and collects tEXt and iTXt keyword/value pairs
+func readTextChunks(data []byte) (map[string]string, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrNotPNG
+	}
+
+	texts := make(map[string]string)
+	offset := len(pngSignature)
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		chunkType := string(data[offset+4 : offset+8])
+		start := offset + 8
+		end := start + length
+		if length < 0 || end+4 > len(data) {
+			return nil, fmt.Errorf("PNG chunk %q is truncated", chunkType)
+		}
+		payload := data[start:end]
+
+		switch chunkType {
+		case "tEXt":
+			if keyword, value, ok := bytes.Cut(payload, []byte{0}); ok {
+				texts[string(keyword)] = latin1ToUTF8(value)
+			}
+		case "iTXt":
+			if keyword, value, err := parseITXt(payload); err == nil {
+				texts[keyword] = value
+			}
+		case "IEND":
+			return texts, nil
+		}
+
+		offset = end + 4
+	}
+
+	return texts, nil
+}
+
+// parseITXt decodes an iTXt chunk payload, inflating it when compressed
+func parseITXt(payload []byte) (string, string, error) {
+	keyword, rest, ok := bytes.Cut(payload, []byte{0})
+	if !ok || len(rest) < 2 {
+		return "", "", fmt.Errorf("malformed iTXt chunk")
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+
+	// Skip the language tag and translated keyword
+	for i := 0; i < 2; i++ {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return "", "", fmt.Errorf("malformed iTXt chunk")
+		}
+	}
+
+	if compressed {
+		reader, err := zlib.NewReader(bytes.NewReader(rest))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to inflate iTXt chunk: %w", err)
+		}
+		defer reader.Close()
+		if rest, err = io.ReadAll(io.LimitReader(reader, maxTextChunkSize)); err != nil {
+			return "", "", fmt.Errorf("failed to inflate iTXt chunk: %w", err)
+		}
+		if len(rest) >= maxTextChunkSize {
+			return "", "", fmt.Errorf("iTXt chunk inflates to more than %d bytes", maxTextChunkSize)
+		}
+	}
+
+	return string(keyword), string(rest), nil
+}
+
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
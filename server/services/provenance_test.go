@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// testPNG encodes a small blank PNG
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withChunk returns a copy of the PNG with a raw chunk inserted after IHDR
+func withChunk(data []byte, chunkType string, payload []byte) []byte {
+	ihdrEnd := len(pngSignature) + 12 + int(binary.BigEndian.Uint32(data[len(pngSignature):]))
+	var out bytes.Buffer
+	out.Write(data[:ihdrEnd])
+	binary.Write(&out, binary.BigEndian, uint32(len(payload)))
+	out.WriteString(chunkType)
+	out.Write(payload)
+	binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(chunkType), payload...)))
+	out.Write(data[ihdrEnd:])
+	return out.Bytes()
+}
+
+func TestProvenanceRoundTrip(t *testing.T) {
+	provenance := ImageProvenance{
+		Prompt:    "A lighthouse made of glass, ☾",
+		Model:     "test-model",
+		Seed:      42,
+		DreamID:   7,
+		CreatedAt: time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC),
+		Generator: provenanceGenerator,
+	}
+	data, err := embedProvenance(testPNG(t), provenance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadProvenance(data)
+	if err != nil || got == nil || *got != provenance {
+		t.Errorf("expected %+v, got %+v (%v)", provenance, got, err)
+	}
+}
+
+func TestReadProvenanceCompressedITXt(t *testing.T) {
+	compress := func(text []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(text)
+		w.Close()
+		return append([]byte("dream_id\x00\x01\x00\x00\x00"), buf.Bytes()...)
+	}
+
+	got, err := ReadProvenance(withChunk(testPNG(t), "iTXt", compress([]byte("12"))))
+	if err != nil || got == nil || got.DreamID != 12 {
+		t.Errorf("expected dream 12 from a compressed chunk, got %+v (%v)", got, err)
+	}
+
+	// A chunk that inflates past the limit is ignored rather than read into memory
+	bomb := compress(bytes.Repeat([]byte("1"), maxTextChunkSize+1))
+	if got, err := ReadProvenance(withChunk(testPNG(t), "iTXt", bomb)); err != nil || got != nil {
+		t.Errorf("expected the oversized chunk to be ignored, got %+v (%v)", got, err)
+	}
+}
+
+func TestReadProvenanceIgnoresForeignSoftware(t *testing.T) {
+	data := withChunk(testPNG(t), "tEXt", []byte("Software\x00GIMP 2.10"))
+	if got, err := ReadProvenance(data); err != nil || got != nil {
+		t.Errorf("expected no provenance for a PNG from another editor, got %+v (%v)", got, err)
+	}
+}
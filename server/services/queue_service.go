@@ -4,12 +4,11 @@ import (
 	"container/list"
 	"context"
 	"dreams/models"
+	"dreams/repositories"
 	"fmt"
 	"log"
 	"sync"
 	"time"
-
-	"gorm.io/gorm"
 )
 
 type QueuedImageRequest struct {
@@ -23,16 +22,16 @@ type QueueService struct {
 	mu        sync.Mutex
 	aiService *AIService
 	isRunning bool
-	db        *gorm.DB
+	dreams    repositories.DreamRepository
 	// Track active requests by dream ID
 	activeRequests map[uint]*QueuedImageRequest
 }
 
-func NewQueueService(aiService *AIService, db *gorm.DB) *QueueService {
+func NewQueueService(aiService *AIService, dreams repositories.DreamRepository) *QueueService {
 	qs := &QueueService{
 		queue:          list.New(),
 		aiService:      aiService,
-		db:             db,
+		dreams:         dreams,
 		activeRequests: make(map[uint]*QueuedImageRequest),
 	}
 	return qs
@@ -103,27 +102,16 @@ func (qs *QueueService) processQueue() {
 			}()
 
 			// Generate the image with a timeout
-			imagePath, err := qs.aiService.GenerateImage(req.Dream.Dream)
+			image, err := qs.aiService.GenerateImage(req.Dream)
 			if err != nil {
 				req.ErrorCh <- fmt.Errorf("error generating image: %w", err)
 				return
 			}
 
 			// Update the dream with the generated image URL
-			err = qs.db.Transaction(func(tx *gorm.DB) error {
-				// Set a timeout for the database operation
-				dbCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-				defer cancel()
-
-				// Use the transaction with timeout context
-				tx = tx.WithContext(dbCtx)
-				if err := tx.Model(&models.Dream{}).
-					Where("id = ?", req.Dream.ID).
-					Update("image_url", imagePath).Error; err != nil {
-					return fmt.Errorf("failed to update dream with image URL: %w", err)
-				}
-				return nil
-			})
+			dbCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err = qs.dreams.SetImage(dbCtx, req.Dream.ID, image.URL, models.ImageVariants(image.Variants))
+			cancel()
 
 			if err != nil {
 				req.ErrorCh <- fmt.Errorf("failed to update dream: %w", err)
@@ -131,7 +119,7 @@ func (qs *QueueService) processQueue() {
 			}
 
 			// Send the result
-			req.ResultCh <- imagePath
+			req.ResultCh <- image.URL
 		}(request)
 
 		// Wait for either the result or an error
@@ -149,12 +137,7 @@ func (qs *QueueService) GetQueuePosition(dreamID uint) (int, bool) {
 	qs.mu.Lock()
 	defer qs.mu.Unlock()
 
-	// First check active requests (currently processing)
-	if _, exists := qs.activeRequests[dreamID]; exists {
-		return 0, true // Currently processing, so position is 0
-	}
-
-	// Then check the queue
+	// First check the queue, since queued requests are also tracked as active
 	position := 0
 	for e := qs.queue.Front(); e != nil; e = e.Next() {
 		position++
@@ -163,6 +146,11 @@ func (qs *QueueService) GetQueuePosition(dreamID uint) (int, bool) {
 		}
 	}
 
+	// Then check active requests (currently processing)
+	if _, exists := qs.activeRequests[dreamID]; exists {
+		return 0, true // Currently processing, so position is 0
+	}
+
 	// Not found in queue
 	return -1, false
 }
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+	"dreams/services/storage"
+)
+
+func newTestQueue(t *testing.T, store storage.StorageProvider) (*QueueService, *repositories.MemoryDreamRepository) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 320, 240))); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Slow enough that a second request can be observed waiting in the queue
+		time.Sleep(200 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"images": []map[string]string{{"base64": base64.StdEncoding.EncodeToString(buf.Bytes())}},
+		})
+	}))
+	t.Cleanup(ai.Close)
+
+	dreams := repositories.NewMemoryDreamRepository()
+	qs := NewQueueService(NewAIService(ai.URL, "/generate", "test-model", store), dreams)
+	return qs, dreams
+}
+
+func waitUntilIdle(t *testing.T, qs *QueueService, ids ...uint) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, id := range ids {
+		for {
+			if _, queued := qs.GetQueuePosition(id); !queued {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for dream %d to be processed", id)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func TestQueueServiceProcessesRequestsInOrder(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	qs, dreams := newTestQueue(t, store)
+
+	first := models.Dream{Dream: "Flying over the ocean"}
+	second := models.Dream{Dream: "Lost in a library"}
+	dreams.Create(context.Background(), &first)
+	dreams.Create(context.Background(), &second)
+
+	if position, err := qs.EnqueueRequest(first); err != nil || position != 1 {
+		t.Fatalf("expected position 1, got %d (%v)", position, err)
+	}
+	if position, err := qs.EnqueueRequest(second); err != nil || position != 2 {
+		t.Fatalf("expected position 2, got %d (%v)", position, err)
+	}
+	if _, err := qs.EnqueueRequest(first); err == nil {
+		t.Fatal("expected duplicate request to be rejected")
+	}
+	if position, queued := qs.GetQueuePosition(second.ID); !queued || position != 2 {
+		t.Fatalf("expected second dream at position 2, got %d %v", position, queued)
+	}
+
+	qs.Start()
+	t.Cleanup(qs.Stop)
+	waitUntilIdle(t, qs, first.ID, second.ID)
+
+	for _, id := range []uint{first.ID, second.ID} {
+		dream, _ := dreams.Get(context.Background(), id)
+		if dream.ImageURL == "" {
+			t.Errorf("expected dream %d to have an image", id)
+		}
+		if dream.ImageVariants["thumbnail"] == "" {
+			t.Errorf("expected dream %d to have a thumbnail, got %v", id, dream.ImageVariants)
+		}
+	}
+}
+
+func TestQueueServiceStorageFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults storage.Faults
+	}{
+		{"save error", storage.Faults{SaveErr: errors.New("bucket unavailable")}},
+		{"exists error", storage.Faults{ExistsErr: errors.New("timeout")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStorage()
+			store.SetFaults(tt.faults)
+			qs, dreams := newTestQueue(t, store)
+
+			dream := models.Dream{Dream: "A door that opens onto the sky"}
+			dreams.Create(context.Background(), &dream)
+			if _, err := qs.EnqueueRequest(dream); err != nil {
+				t.Fatalf("failed to enqueue: %v", err)
+			}
+			qs.Start()
+			t.Cleanup(qs.Stop)
+			waitUntilIdle(t, qs, dream.ID)
+
+			stored, _ := dreams.Get(context.Background(), dream.ID)
+			if stored.ImageURL != "" {
+				t.Errorf("expected no image after storage failure, got %q", stored.ImageURL)
+			}
+
+			// The failed request must not block a retry
+			if _, err := qs.EnqueueRequest(dream); err != nil {
+				t.Errorf("expected retry to be accepted, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// reminderInterval is how often the scheduler looks for due reminders
+	reminderInterval = 30 * time.Second
+	// reminderWindow is how late a reminder is still sent, so a server that was down at
+	// the reminder time doesn't nag in the afternoon
+	reminderWindow = 2 * time.Hour
+)
+
+var (
+	// ErrReminderNotFound is returned for reminders that don't exist
+	ErrReminderNotFound = errors.New("reminder not found")
+	// ErrNotificationFailed is returned when a notifier couldn't deliver a reminder
+	ErrNotificationFailed = errors.New("failed to send reminder")
+)
+
+// ReminderService stores reminder schedules and sends the ones that are due. Dreams are
+// not owned by users yet, so any dream written that morning skips every reminder.
+type ReminderService struct {
+	db *gorm.DB
+	// notifiers holds a notifier for each configured channel
+	notifiers map[string]Notifier
+	appURL    string
+	now       func() time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewReminderService creates a reminder service. Reminders can only use the channels in
+// notifiers, and link to the journal at appURL.
+func NewReminderService(db *gorm.DB, notifiers map[string]Notifier, appURL string) *ReminderService {
+	return &ReminderService{
+		db:        db,
+		notifiers: notifiers,
+		appURL:    appURL,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start sends due reminders in the background until Stop is called
+func (s *ReminderService) Start() {
+	go func() {
+		ticker := time.NewTicker(reminderInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.RunDue(context.Background()); err != nil {
+				log.Printf("Error sending reminders: %v", err)
+			} else if n > 0 {
+				log.Printf("Sent %d reminders", n)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler
+func (s *ReminderService) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// PushPublicKey returns the VAPID public key browsers subscribe with, or an empty string
+// when Web Push isn't configured
+func (s *ReminderService) PushPublicKey() string {
+	if notifier, ok := s.notifiers[models.ReminderWebPush].(*WebPushNotifier); ok {
+		return notifier.PublicKey()
+	}
+	return ""
+}
+
+// validate checks the reminder and that its channel is configured
+func (s *ReminderService) validate(reminder *models.Reminder) error {
+	var errs models.ValidationErrors
+	if err := reminder.Validate(); err != nil {
+		errors.As(err, &errs)
+	}
+	for _, e := range errs {
+		if e.Field == "channel" {
+			return errs
+		}
+	}
+	if _, ok := s.notifiers[reminder.Channel]; !ok {
+		errs.Add("channel", fmt.Sprintf("%s reminders are not configured on this server", reminder.Channel))
+	}
+	return errs.Err()
+}
+
+// List returns every reminder, oldest first
+func (s *ReminderService) List(ctx context.Context) ([]models.Reminder, error) {
+	reminders := []models.Reminder{}
+	err := s.db.WithContext(ctx).Order("id").Find(&reminders).Error
+	return reminders, err
+}
+
+// Get returns a reminder or ErrReminderNotFound
+func (s *ReminderService) Get(ctx context.Context, id uint) (models.Reminder, error) {
+	var reminder models.Reminder
+	err := s.db.WithContext(ctx).First(&reminder, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return reminder, ErrReminderNotFound
+	}
+	return reminder, err
+}
+
+// Create validates and saves a new reminder, returning models.ValidationErrors if it
+// isn't valid
+func (s *ReminderService) Create(ctx context.Context, reminder *models.Reminder) error {
+	if err := s.validate(reminder); err != nil {
+		return err
+	}
+	reminder.ID = 0
+	reminder.LastSentOn = nil
+	return s.db.WithContext(ctx).Create(reminder).Error
+}
+
+// Update replaces the schedule and channel of a reminder
+func (s *ReminderService) Update(ctx context.Context, reminder *models.Reminder) error {
+	existing, err := s.Get(ctx, reminder.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.validate(reminder); err != nil {
+		return err
+	}
+	reminder.LastSentOn = existing.LastSentOn
+	reminder.CreatedAt = existing.CreatedAt
+	return s.db.WithContext(ctx).Select("*").Updates(reminder).Error
+}
+
+// Delete removes a reminder
+func (s *ReminderService) Delete(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&models.Reminder{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReminderNotFound
+	}
+	return nil
+}
+
+// Send sends a reminder right away whatever its schedule, so the channel can be checked
+func (s *ReminderService) Send(ctx context.Context, id uint) error {
+	reminder, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.notify(ctx, reminder)
+}
+
+// notify sends the reminder over its channel. Reminders whose target has gone away are
+// disabled.
+func (s *ReminderService) notify(ctx context.Context, reminder models.Reminder) error {
+	notifier, ok := s.notifiers[reminder.Channel]
+	if !ok {
+		return fmt.Errorf("%w %d: %s reminders are not configured", ErrNotificationFailed, reminder.ID, reminder.Channel)
+	}
+	err := notifier.Notify(ctx, reminder, Notification{
+		Title: "What did you dream?",
+		Body:  "Write your dream down now, before it fades.",
+		URL:   s.appURL,
+	})
+	if errors.Is(err, ErrSubscriptionGone) {
+		log.Printf("Disabling reminder %d as its subscription is gone", reminder.ID)
+		if err := s.db.WithContext(ctx).Model(&models.Reminder{}).Where("id = ?", reminder.ID).UpdateColumn("enabled", false).Error; err != nil {
+			log.Printf("Error disabling reminder %d: %v", reminder.ID, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w %d: %w", ErrNotificationFailed, reminder.ID, err)
+	}
+	return nil
+}
+
+// due reports whether the reminder should fire at local, its time zone's current time. A
+// reminder saved after today's time waits until its next day.
+func due(reminder models.Reminder, local time.Time) bool {
+	if !reminder.Weekdays.Includes(local.Weekday()) {
+		return false
+	}
+	if reminder.LastSentOn != nil && reminder.LastSentOn.Equal(models.NewDate(local).Time) {
+		return false
+	}
+	at, err := time.Parse("15:04", reminder.TimeOfDay)
+	if err != nil {
+		return false
+	}
+	scheduled := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, local.Location())
+	return !local.Before(scheduled) && local.Before(scheduled.Add(reminderWindow)) && !reminder.UpdatedAt.After(scheduled)
+}
+
+// RunDue sends every reminder that is due and returns how many were sent. Reminders are
+// claimed for the day before sending, so several servers sharing a database send each
+// once, and one that fails to send is released to be retried on the next run.
+func (s *ReminderService) RunDue(ctx context.Context) (int, error) {
+	var reminders []models.Reminder
+	if err := s.db.WithContext(ctx).Where("enabled = ?", true).Order("id").Find(&reminders).Error; err != nil {
+		return 0, fmt.Errorf("failed to load reminders: %w", err)
+	}
+
+	sent := 0
+	for _, reminder := range reminders {
+		local := s.now().In(reminder.Location())
+		if !due(reminder, local) {
+			continue
+		}
+		today := models.NewDate(local)
+		claim := s.db.WithContext(ctx).Model(&models.Reminder{}).
+			Where("id = ? AND (last_sent_on IS NULL OR last_sent_on <> ?)", reminder.ID, today).
+			UpdateColumn("last_sent_on", today)
+		if claim.Error != nil {
+			return sent, fmt.Errorf("failed to claim reminder %d: %w", reminder.ID, claim.Error)
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		// Dream recall is the point, so there's nothing to remind about once one is written
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		var written int64
+		if err := s.db.WithContext(ctx).Model(&models.Dream{}).Where("created_at >= ?", midnight.UTC()).Count(&written).Error; err != nil {
+			return sent, fmt.Errorf("failed to check for dreams: %w", err)
+		}
+		if written > 0 {
+			continue
+		}
+
+		if err := s.notify(ctx, reminder); err != nil {
+			log.Printf("Error sending reminder: %v", err)
+			if !errors.Is(err, ErrSubscriptionGone) {
+				// Only the previous value is restored, so a run that already moved on isn't undone
+				release := s.db.WithContext(ctx).Model(&models.Reminder{}).Where("id = ? AND last_sent_on = ?", reminder.ID, today)
+				if err := release.UpdateColumn("last_sent_on", reminder.LastSentOn).Error; err != nil {
+					log.Printf("Error releasing reminder %d: %v", reminder.ID, err)
+				}
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dreams/models"
+)
+
+// fakeNotifier records the reminders it sends, failing with err if set
+type fakeNotifier struct {
+	sent []uint
+	err  error
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, reminder models.Reminder, notification Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, reminder.ID)
+	return nil
+}
+
+func TestRunDueReminders(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	notifier := &fakeNotifier{}
+	s := NewReminderService(db, map[string]Notifier{models.ReminderWebhook: notifier}, "http://localhost:3000")
+
+	reminder := models.Reminder{
+		TimeOfDay: "07:00",
+		TimeZone:  "America/New_York",
+		Weekdays:  models.Weekdays{"mon", "wed", "fri"},
+		Channel:   models.ReminderWebhook,
+		Target:    "http://example.com/hook",
+		Enabled:   true,
+	}
+	if err := s.Create(ctx, &reminder); err != nil {
+		t.Fatal(err)
+	}
+	// Saved long before any of the mornings below
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.Model(&reminder).UpdateColumn("updated_at", created).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(now time.Time) int {
+		t.Helper()
+		s.now = func() time.Time { return now }
+		before := len(notifier.sent)
+		if _, err := s.RunDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return len(notifier.sent) - before
+	}
+
+	// Monday 4 March, New York is five hours behind UTC
+	if n := run(time.Date(2024, 3, 4, 11, 59, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("expected no reminder before 07:00 local time, sent %d", n)
+	}
+	if n := run(time.Date(2024, 3, 4, 12, 0, 30, 0, time.UTC)); n != 1 {
+		t.Errorf("expected the reminder at 07:00 local time, sent %d", n)
+	}
+	if n := run(time.Date(2024, 3, 4, 12, 1, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("expected the reminder once a day, sent %d", n)
+	}
+	if n := run(time.Date(2024, 3, 5, 12, 5, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("expected no reminder on a Tuesday, sent %d", n)
+	}
+
+	// A dream written on Wednesday morning skips the reminder
+	dream := models.Dream{Dream: "Flying over the harbour"}
+	dream.CreatedAt = time.Date(2024, 3, 6, 10, 30, 0, 0, time.UTC)
+	if err := db.Create(&dream).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := run(time.Date(2024, 3, 6, 12, 5, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("expected no reminder after a dream was written, sent %d", n)
+	}
+
+	// A failed send is retried on the next run
+	notifier.err = errors.New("webhook is down")
+	if n := run(time.Date(2024, 3, 8, 12, 5, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("expected the send to fail, sent %d", n)
+	}
+	notifier.err = nil
+	if n := run(time.Date(2024, 3, 8, 12, 6, 0, 0, time.UTC)); n != 1 {
+		t.Errorf("expected the failed reminder to be retried, sent %d", n)
+	}
+
+	// A server that was down all morning doesn't send it in the afternoon
+	if n := run(time.Date(2024, 3, 11, 15, 0, 0, 0, time.UTC)); n != 0 {
+		t.Errorf("expected no reminder hours after 07:00, sent %d", n)
+	}
+}
+
+func TestRunDueSkipsRemindersSavedAfterTheirTime(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	notifier := &fakeNotifier{}
+	s := NewReminderService(db, map[string]Notifier{models.ReminderWebhook: notifier}, "http://localhost:3000")
+
+	disabled := models.Reminder{TimeOfDay: "07:00", TimeZone: "UTC", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderWebhook, Target: "http://example.com/hook"}
+	if err := s.Create(ctx, &disabled); err != nil {
+		t.Fatal(err)
+	}
+	late := models.Reminder{TimeOfDay: "07:00", TimeZone: "UTC", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderWebhook, Target: "http://example.com/hook", Enabled: true}
+	if err := s.Create(ctx, &late); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.Reminder{}).Where("1 = 1").UpdateColumn("updated_at", time.Date(2024, 3, 4, 7, 30, 0, 0, time.UTC))
+
+	s.now = func() time.Time { return time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC) }
+	if n, err := s.RunDue(ctx); err != nil || n != 0 {
+		t.Errorf("expected nothing to be sent, sent %d: %v", n, err)
+	}
+	s.now = func() time.Time { return time.Date(2024, 3, 11, 7, 0, 0, 0, time.UTC) }
+	if n, err := s.RunDue(ctx); err != nil || n != 1 || notifier.sent[0] != late.ID {
+		t.Errorf("expected only the enabled reminder the next week, sent %v: %v", notifier.sent, err)
+	}
+}
+
+func TestReminderValidation(t *testing.T) {
+	db := openTestDB(t)
+	s := NewReminderService(db, map[string]Notifier{models.ReminderWebhook: &fakeNotifier{}}, "http://localhost:3000")
+
+	for name, tc := range map[string]struct {
+		reminder models.Reminder
+		field    string
+	}{
+		"time of day":  {models.Reminder{TimeOfDay: "7am", TimeZone: "UTC", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderWebhook, Target: "http://example.com"}, "time_of_day"},
+		"time zone":    {models.Reminder{TimeOfDay: "07:00", TimeZone: "Mars/Olympus", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderWebhook, Target: "http://example.com"}, "time_zone"},
+		"weekday":      {models.Reminder{TimeOfDay: "07:00", TimeZone: "UTC", Weekdays: models.Weekdays{"monday"}, Channel: models.ReminderWebhook, Target: "http://example.com"}, "weekdays"},
+		"webhook URL":  {models.Reminder{TimeOfDay: "07:00", TimeZone: "UTC", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderWebhook, Target: "ftp://example.com"}, "target"},
+		"unconfigured": {models.Reminder{TimeOfDay: "07:00", TimeZone: "UTC", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderEmail, Target: "me@example.com"}, "channel"},
+		"push":         {models.Reminder{TimeOfDay: "07:00", TimeZone: "UTC", Weekdays: models.Weekdays{"mon"}, Channel: models.ReminderWebPush}, "channel"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var errs models.ValidationErrors
+			if err := s.Create(context.Background(), &tc.reminder); !errors.As(err, &errs) {
+				t.Fatalf("expected validation errors, got %v", err)
+			}
+			found := false
+			for _, e := range errs {
+				found = found || e.Field == tc.field
+			}
+			if !found {
+				t.Errorf("expected an error for %s, got %v", tc.field, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"dreams/models"
+	"dreams/repositories"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// embeddingInterval is how often the indexer looks for dreams without a current embedding
+	embeddingInterval = time.Minute
+	// embeddingBatchSize is how many dreams the indexer embeds per query
+	embeddingBatchSize = 50
+)
+
+// ErrEmbeddingFailed is returned when the embedder can't embed a dream, such as when the
+// embedding model is unreachable
+var ErrEmbeddingFailed = errors.New("failed to embed dream")
+
+// SimilarDream is a dream and how similar it is to another, from -1 to 1
+type SimilarDream struct {
+	Dream      models.Dream `json:"dream"`
+	Similarity float64      `json:"similarity"`
+}
+
+// SimilarityService keeps an embedding of every dream and finds the dreams closest to one
+// another. Vectors are compared in process: their dimension depends on the configured
+// embedder, so the database can't index them, and a journal is small enough to scan.
+type SimilarityService struct {
+	db       *gorm.DB
+	dreams   repositories.DreamRepository
+	embedder Embedder
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSimilarityService creates a similarity service
+func NewSimilarityService(db *gorm.DB, dreams repositories.DreamRepository, embedder Embedder) *SimilarityService {
+	return &SimilarityService{
+		db:       db,
+		dreams:   dreams,
+		embedder: embedder,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start embeds new and edited dreams in the background until Stop is called
+func (s *SimilarityService) Start() {
+	go func() {
+		ticker := time.NewTicker(embeddingInterval)
+		defer ticker.Stop()
+		for {
+			if n, err := s.IndexStale(context.Background()); err != nil {
+				log.Printf("Error embedding dreams: %v", err)
+			} else if n > 0 {
+				log.Printf("Embedded %d dreams with %s", n, s.embedder.Name())
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background indexer
+func (s *SimilarityService) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// staleDreams returns dreams that have no embedding from the current model for their
+// current version
+func (s *SimilarityService) staleDreams(ctx context.Context, limit int) ([]models.Dream, error) {
+	var dreams []models.Dream
+	err := s.db.WithContext(ctx).Select("dreams.id", "dreams.version", "dreams.dream").
+		Joins("LEFT JOIN dream_embeddings ON dream_embeddings.dream_id = dreams.id").
+		Where("dream_embeddings.dream_id IS NULL OR dream_embeddings.model <> ? OR dream_embeddings.dream_version <> dreams.version", s.embedder.Name()).
+		Order("dreams.id").Limit(limit).Find(&dreams).Error
+	return dreams, err
+}
+
+// IndexStale embeds every dream whose embedding is missing or out of date and returns how
+// many were embedded
+func (s *SimilarityService) IndexStale(ctx context.Context) (int, error) {
+	embedded := 0
+	for {
+		dreams, err := s.staleDreams(ctx, embeddingBatchSize)
+		if err != nil {
+			return embedded, err
+		}
+		for _, dream := range dreams {
+			if _, err := s.embed(ctx, dream); err != nil {
+				return embedded, err
+			}
+			embedded++
+		}
+		if len(dreams) < embeddingBatchSize {
+			return embedded, nil
+		}
+	}
+}
+
+// embed computes and stores the embedding of a dream
+func (s *SimilarityService) embed(ctx context.Context, dream models.Dream) ([]float32, error) {
+	vector, err := s.embedder.Embed(ctx, dream.Dream)
+	if err != nil {
+		return nil, fmt.Errorf("%w %d: %v", ErrEmbeddingFailed, dream.ID, err)
+	}
+	embedding := models.DreamEmbedding{
+		DreamID:      dream.ID,
+		Model:        s.embedder.Name(),
+		DreamVersion: dream.Version,
+		Vector:       encodeVector(vector),
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&embedding).Error; err != nil {
+		return nil, fmt.Errorf("failed to save embedding of dream %d: %w", dream.ID, err)
+	}
+	return vector, nil
+}
+
+// vector returns the current embedding of a dream, computing it if it is missing or stale
+func (s *SimilarityService) vector(ctx context.Context, dream models.Dream) ([]float32, error) {
+	var embedding models.DreamEmbedding
+	err := s.db.WithContext(ctx).Where("dream_id = ? AND model = ? AND dream_version = ?", dream.ID, s.embedder.Name(), dream.Version).
+		Limit(1).Find(&embedding).Error
+	if err != nil {
+		return nil, err
+	}
+	if embedding.DreamID != 0 {
+		return decodeVector(embedding.Vector), nil
+	}
+	return s.embed(ctx, dream)
+}
+
+// scoredDream is a dream ID and its similarity to the dream being matched
+type scoredDream struct {
+	DreamID    uint
+	Similarity float64
+}
+
+// Similar returns up to limit dreams most like the given one, most similar first. Returns
+// repositories.ErrNotFound if the dream doesn't exist.
+func (s *SimilarityService) Similar(ctx context.Context, id uint, limit int) ([]SimilarDream, error) {
+	dream, err := s.dreams.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	vector, err := s.vector(ctx, dream)
+	if err != nil {
+		return nil, err
+	}
+
+	scored, err := s.searchInProcess(ctx, id, vector, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	similar := make([]SimilarDream, 0, len(scored))
+	for _, match := range scored {
+		// Dreams with nothing in common aren't worth suggesting
+		if match.Similarity <= 0 {
+			continue
+		}
+		dream, err := s.dreams.Get(ctx, match.DreamID)
+		if err == repositories.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, SimilarDream{Dream: dream, Similarity: match.Similarity})
+	}
+	return similar, nil
+}
+
+// searchInProcess compares the vector with every stored embedding from the same model
+func (s *SimilarityService) searchInProcess(ctx context.Context, id uint, vector []float32, limit int) ([]scoredDream, error) {
+	rows, err := s.db.WithContext(ctx).Table("dream_embeddings").
+		Select("dream_embeddings.dream_id, dream_embeddings.vector").
+		Joins("JOIN dreams ON dreams.id = dream_embeddings.dream_id AND dreams.deleted_at IS NULL").
+		Where("dream_embeddings.model = ? AND dream_embeddings.dream_id <> ?", s.embedder.Name(), id).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var scored []scoredDream
+	for rows.Next() {
+		var match scoredDream
+		var data []byte
+		if err := rows.Scan(&match.DreamID, &data); err != nil {
+			return nil, err
+		}
+		match.Similarity = dot(vector, decodeVector(data))
+		scored = append(scored, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Similarity != scored[j].Similarity {
+			return scored[i].Similarity > scored[j].Similarity
+		}
+		return scored[i].DreamID < scored[j].DreamID
+	})
+	return scored[:min(limit, len(scored))], nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dreams/models"
+	"dreams/repositories"
+)
+
+func TestHashingEmbedder(t *testing.T) {
+	embedder := NewHashingEmbedder(256)
+	embed := func(text string) []float32 {
+		v, err := embedder.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	flooded := embed("The school was flooded and I swam through the classrooms")
+	swimming := embed("Swimming through my old school, the corridors were flooded")
+	desert := embed("Walking alone across a red desert at dusk")
+
+	if got := dot(flooded, flooded); got < 0.999 || got > 1.001 {
+		t.Errorf("expected unit vectors, got length %v", got)
+	}
+	if dot(flooded, swimming) <= dot(flooded, desert) {
+		t.Errorf("expected the flooded school dreams to be closest, got %v and %v", dot(flooded, swimming), dot(flooded, desert))
+	}
+	if got := decodeVector(encodeVector(flooded)); dot(got, flooded) < 0.999 {
+		t.Error("expected vectors to survive encoding")
+	}
+}
+
+func TestOllamaEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/api/embed" || req["model"] != "nomic-embed-text" || req["input"] != "a dream" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"embeddings": [][]float32{{3, 4}}})
+	}))
+	defer server.Close()
+
+	embedder := NewEmbedder(server.URL, "nomic-embed-text")
+	v, err := embedder.Embed(t.Context(), "a dream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder.Name() != "ollama:nomic-embed-text" || len(v) != 2 || v[0] != 0.6 || v[1] != 0.8 {
+		t.Errorf("unexpected embedding %s %v", embedder.Name(), v)
+	}
+}
+
+// failingEmbedder stands in for an unreachable embedding model
+type failingEmbedder struct{}
+
+func (failingEmbedder) Name() string { return "failing" }
+func (failingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSimilarDreams(t *testing.T) {
+	db := openTestDB(t)
+	dreams := repositories.NewDreamRepository(db)
+	texts := []string{
+		"The school was flooded and I swam through the classrooms",
+		"Swimming through my old school, the corridors were flooded",
+		"Walking alone across a red desert at dusk",
+		"The desert sand was red and hot under my feet",
+	}
+	created := make([]models.Dream, len(texts))
+	for i, text := range texts {
+		created[i] = models.Dream{Dream: text}
+		if err := dreams.Create(t.Context(), &created[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := NewSimilarityService(db, dreams, NewHashingEmbedder(defaultHashingDimensions))
+	if n, err := service.IndexStale(t.Context()); err != nil || n != len(texts) {
+		t.Fatalf("expected every dream to be embedded, got %d (%v)", n, err)
+	}
+	if n, _ := service.IndexStale(t.Context()); n != 0 {
+		t.Errorf("expected nothing left to embed, got %d", n)
+	}
+
+	similar, err := service.Similar(t.Context(), created[0].ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similar) == 0 || similar[0].Dream.ID != created[1].ID || similar[0].Similarity <= 0 {
+		t.Fatalf("expected the other flooded school dream first, got %+v", similar)
+	}
+
+	// Editing a dream makes its embedding stale
+	edited := created[2]
+	edited.Dream = "I swam through a flooded school once more"
+	if err := dreams.Update(t.Context(), &edited, edited.Version); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := service.IndexStale(t.Context()); n != 1 {
+		t.Errorf("expected the edited dream to be embedded again, got %d", n)
+	}
+
+	// Dreams without an embedding from the current model are embedded on demand
+	failing := NewSimilarityService(db, dreams, failingEmbedder{})
+	if _, err := failing.Similar(t.Context(), created[0].ID, 2); !errors.Is(err, ErrEmbeddingFailed) {
+		t.Errorf("expected ErrEmbeddingFailed, got %v", err)
+	}
+	if _, err := service.Similar(t.Context(), 999, 2); err != repositories.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
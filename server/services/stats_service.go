@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dreams/models"
+
+	"gorm.io/gorm"
+)
+
+// statsTopCount is how many words and tags the stats list
+const statsTopCount = 20
+
+// dreamDay is the night a dream happened, falling back to the day it was written down
+const dreamDay = "COALESCE(dreams.dreamt_on, DATE(dreams.created_at))"
+
+// StatsRange limits the stats to dreams from From to To inclusive, either of which can be
+// nil for an open range
+type StatsRange struct {
+	From *models.Date
+	To   *models.Date
+}
+
+// PeriodCount is the number of dreams in a week (2024-W05) or month (2024-02)
+type PeriodCount struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+// WordCount is how many times a word appears across dreams
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// DreamStats summarises the journal. Ratios are fractions of TotalDreams, from 0 to 1.
+type DreamStats struct {
+	From           *models.Date      `json:"from,omitempty"`
+	To             *models.Date      `json:"to,omitempty"`
+	TotalDreams    int               `json:"total_dreams"`
+	PerWeek        []PeriodCount     `json:"per_week"`
+	PerMonth       []PeriodCount     `json:"per_month"`
+	CurrentStreak  int               `json:"current_streak"`
+	LongestStreak  int               `json:"longest_streak"`
+	LucidCount     int               `json:"lucid_count"`
+	LucidRatio     float64           `json:"lucid_ratio"`
+	NightmareCount int               `json:"nightmare_count"`
+	NightmareRatio float64           `json:"nightmare_ratio"`
+	TopWords       []WordCount       `json:"top_words"`
+	TopTags        []models.TagCount `json:"top_tags"`
+	// AverageLength is the mean dream length in characters, AverageWords in words
+	AverageLength float64 `json:"average_length"`
+	AverageWords  float64 `json:"average_words"`
+	// ImagesGenerated counts dreams with a generated image
+	ImagesGenerated int `json:"images_generated"`
+}
+
+// StatsService computes journal statistics, aggregating in the database where it can.
+// Dreams are not owned by users yet, so the stats cover every dream.
+type StatsService struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewStatsService creates a stats service
+func NewStatsService(db *gorm.DB) *StatsService {
+	return &StatsService{db: db, now: time.Now}
+}
+
+// dreams returns a query over the dreams in the range
+func (s *StatsService) dreams(ctx context.Context, r StatsRange) *gorm.DB {
+	return dreamsInRange(s.db.WithContext(ctx), r)
+}
+
+// dreamsInRange narrows db to the dreams in the range that aren't in the trash
+func dreamsInRange(db *gorm.DB, r StatsRange) *gorm.DB {
+	query := db.Table("dreams").Where("dreams.deleted_at IS NULL")
+	if r.From != nil {
+		query = query.Where(dreamDay+" >= ?", *r.From)
+	}
+	if r.To != nil {
+		query = query.Where(dreamDay+" <= ?", *r.To)
+	}
+	return query
+}
+
+// Stats computes the statistics for the dreams in the range. Streaks count consecutive
+// days with at least one dream, and the current streak is still running if the last
+// dream was yesterday.
+func (s *StatsService) Stats(ctx context.Context, r StatsRange) (DreamStats, error) {
+	stats := DreamStats{From: r.From, To: r.To}
+
+	var totals struct {
+		Total         int
+		Lucid         int
+		Nightmare     int
+		Images        int
+		AverageLength float64
+	}
+	err := s.dreams(ctx, r).Select(`COUNT(*) AS total,
+		COALESCE(SUM(CASE WHEN lucid THEN 1 ELSE 0 END), 0) AS lucid,
+		COALESCE(SUM(CASE WHEN nightmare THEN 1 ELSE 0 END), 0) AS nightmare,
+		COALESCE(SUM(CASE WHEN image_url <> '' THEN 1 ELSE 0 END), 0) AS images,
+		COALESCE(AVG(LENGTH(dream)), 0) AS average_length`).Scan(&totals).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count dreams: %w", err)
+	}
+	stats.TotalDreams = totals.Total
+	stats.LucidCount = totals.Lucid
+	stats.NightmareCount = totals.Nightmare
+	stats.ImagesGenerated = totals.Images
+	stats.AverageLength = totals.AverageLength
+	if totals.Total > 0 {
+		stats.LucidRatio = float64(totals.Lucid) / float64(totals.Total)
+		stats.NightmareRatio = float64(totals.Nightmare) / float64(totals.Total)
+	}
+
+	var days []struct {
+		Day   models.Date
+		Count int
+	}
+	err = s.dreams(ctx, r).Select(dreamDay + " AS day, COUNT(*) AS count").
+		Group("day").Order("day").Scan(&days).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count dreams by day: %w", err)
+	}
+	weeks := make(map[string]int)
+	months := make(map[string]int)
+	dates := make([]time.Time, len(days))
+	for i, day := range days {
+		dates[i] = day.Day.Time
+		weeks[isoWeek(day.Day.Time)] += day.Count
+		months[day.Day.Format("2006-01")] += day.Count
+	}
+	// Weeks and months without dreams are included so the counts can be charted directly
+	stats.PerWeek, stats.PerMonth = []PeriodCount{}, []PeriodCount{}
+	if len(dates) > 0 {
+		first, last := dates[0], dates[len(dates)-1]
+		monday := first.AddDate(0, 0, -(int(first.Weekday())+6)%7)
+		for week := monday; !week.After(last); week = week.AddDate(0, 0, 7) {
+			period := isoWeek(week)
+			stats.PerWeek = append(stats.PerWeek, PeriodCount{period, weeks[period]})
+		}
+		for month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(last); month = month.AddDate(0, 1, 0) {
+			period := month.Format("2006-01")
+			stats.PerMonth = append(stats.PerMonth, PeriodCount{period, months[period]})
+		}
+	}
+
+	today := models.NewDate(s.now())
+	if r.To != nil && r.To.Before(today.Time) {
+		today = *r.To
+	}
+	stats.CurrentStreak, stats.LongestStreak = streaks(dates, today.Time)
+
+	stats.TopTags = []models.TagCount{}
+	err = s.dreams(ctx, r).Select("tags.id, tags.name, COUNT(*) AS count").
+		Joins("JOIN dream_tags ON dream_tags.dream_id = dreams.id").
+		Joins("JOIN tags ON tags.id = dream_tags.tag_id").
+		Group("tags.id, tags.name").
+		Order("count DESC, tags.name ASC").
+		Limit(statsTopCount).
+		Scan(&stats.TopTags).Error
+	if err != nil {
+		return stats, fmt.Errorf("failed to count tags: %w", err)
+	}
+
+	// Words are counted in Go as SQL has no portable way to split text
+	rows, err := s.dreams(ctx, r).Select("dream").Rows()
+	if err != nil {
+		return stats, fmt.Errorf("failed to read dreams: %w", err)
+	}
+	defer rows.Close()
+	words := make(map[string]int)
+	totalWords := 0
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return stats, err
+		}
+		totalWords += len(strings.Fields(text))
+		for _, word := range contentWords(text) {
+			words[word]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+	if totals.Total > 0 {
+		stats.AverageWords = float64(totalWords) / float64(totals.Total)
+	}
+	stats.TopWords = topWords(words, statsTopCount)
+
+	return stats, nil
+}
+
+// isoWeek labels the ISO week of t, like 2024-W05
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// streaks returns the run of consecutive days ending today, or yesterday if nothing was
+// written today yet, and the longest run. days must be sorted and distinct.
+func streaks(days []time.Time, today time.Time) (current, longest int) {
+	run := 0
+	for i, day := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, 1).Equal(day) {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+	if len(days) > 0 {
+		last := days[len(days)-1]
+		if last.Equal(today) || last.AddDate(0, 0, 1).Equal(today) {
+			current = run
+		}
+	}
+	return current, longest
+}
+
+// topWords returns the n most frequent words, ties broken alphabetically
+func topWords(counts map[string]int, n int) []WordCount {
+	words := make([]WordCount, 0, len(counts))
+	for word, count := range counts {
+		words = append(words, WordCount{word, count})
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count != words[j].Count {
+			return words[i].Count > words[j].Count
+		}
+		return words[i].Word < words[j].Word
+	})
+	return words[:min(n, len(words))]
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"dreams/models"
+)
+
+func TestStats(t *testing.T) {
+	db := openTestDB(t)
+	date := func(s string) *models.Date {
+		d, err := models.ParseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+
+	water := models.Tag{Name: "water"}
+	dreams := []models.Dream{
+		{Dream: "The ocean swallowed the school", DreamtOn: date("2024-01-29"), Lucid: true, Tags: []models.Tag{water}},
+		{Dream: "Swimming in the ocean at night", DreamtOn: date("2024-01-30"), ImageURL: "/images/ocean.png"},
+		{Dream: "The ocean was made of glass", DreamtOn: date("2024-01-31"), Nightmare: true},
+		{Dream: "A train through the desert", DreamtOn: date("2024-02-14")},
+		{Dream: "Outside the range", DreamtOn: date("2024-05-01")},
+	}
+	for i := range dreams {
+		if err := db.Create(&dreams[i]).Error; err != nil {
+			t.Fatalf("failed to create dream: %v", err)
+		}
+	}
+	// Dreams without a dreamt on date fall on the day they were written
+	written := models.Dream{Dream: "Falling from the ocean cliffs"}
+	written.CreatedAt = time.Date(2024, 2, 15, 8, 0, 0, 0, time.UTC)
+	db.Create(&written)
+	db.Delete(&models.Dream{}, dreams[3].ID)
+
+	service := NewStatsService(db)
+	service.now = func() time.Time { return time.Date(2024, 2, 16, 9, 0, 0, 0, time.UTC) }
+	stats, err := service.Stats(t.Context(), StatsRange{From: date("2024-01-01"), To: date("2024-03-31")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.TotalDreams != 4 || stats.LucidCount != 1 || stats.NightmareCount != 1 || stats.LucidRatio != 0.25 || stats.ImagesGenerated != 1 {
+		t.Errorf("unexpected totals %+v", stats)
+	}
+	if got := fmt.Sprint(stats.PerMonth); got != "[{2024-01 3} {2024-02 1}]" {
+		t.Errorf("unexpected months %s", got)
+	}
+	if got := fmt.Sprint(stats.PerWeek); got != "[{2024-W05 3} {2024-W06 0} {2024-W07 1}]" {
+		t.Errorf("unexpected weeks %s", got)
+	}
+	if stats.LongestStreak != 3 || stats.CurrentStreak != 1 {
+		t.Errorf("expected streaks 1 and 3, got %d and %d", stats.CurrentStreak, stats.LongestStreak)
+	}
+	if len(stats.TopWords) == 0 || stats.TopWords[0] != (WordCount{"ocean", 4}) {
+		t.Errorf("unexpected top words %v", stats.TopWords)
+	}
+	if len(stats.TopTags) != 1 || stats.TopTags[0].Name != "water" || stats.TopTags[0].Count != 1 {
+		t.Errorf("unexpected top tags %v", stats.TopTags)
+	}
+	if stats.AverageWords != 5.5 {
+		t.Errorf("expected 5.5 words on average, got %v", stats.AverageWords)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	for _, test := range []struct {
+		days             []time.Time
+		today            time.Time
+		current, longest int
+	}{
+		{nil, day(10), 0, 0},
+		{[]time.Time{day(1), day(2), day(3), day(8), day(9)}, day(10), 2, 3},
+		{[]time.Time{day(1), day(2), day(3), day(8), day(9), day(10)}, day(10), 3, 3},
+		{[]time.Time{day(1), day(2), day(3)}, day(10), 0, 3},
+	} {
+		current, longest := streaks(test.days, test.today)
+		if current != test.current || longest != test.longest {
+			t.Errorf("streaks(%v) = %d, %d, want %d, %d", test.days, current, longest, test.current, test.longest)
+		}
+	}
+}
+
+func TestContentWords(t *testing.T) {
+	got := fmt.Sprint(contentWords("I was flying over my grandmother's house, and I didn't fall! 42 times"))
+	if got != "[flying grandmother house fall times]" {
+		t.Errorf("unexpected words %s", got)
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+)
+
+// Cache-Control values for stored images
+const (
+	// ImmutableCacheControl is used for content-addressed keys, whose bytes can never change
+	ImmutableCacheControl = "public, max-age=31536000, immutable"
+	// DefaultCacheControl is used for any other key
+	DefaultCacheControl = "public, max-age=300"
+)
+
+// contentKeyPattern matches keys produced by ContentKey, including variants derived from them
+var contentKeyPattern = regexp.MustCompile(`^[0-9a-f]{2}/[0-9a-f]{2}/[0-9a-f]{64}(_[a-z]+)?\.[a-z]+$`)
+
+// imageExtensions maps the sniffed MIME type of supported images to their file extension
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+// SniffImageType inspects the leading bytes of the data and returns its MIME type and file extension.
+// Only PNG, JPEG and WebP are accepted.
+func SniffImageType(data []byte) (string, string, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported image type: %s", contentType)
+	}
+	return contentType, ext, nil
+}
+
+// ContentKey returns the content-addressed storage key for the data.
+// Keys are sharded by the first two bytes of the SHA-256 hash to keep directories small,
+// e.g. "ab/cd/abcd1234....png".
+func ContentKey(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return path.Join(hash[0:2], hash[2:4], hash+ext)
+}
+
+// IsContentKey reports whether the key was produced by ContentKey or derived from one
+func IsContentKey(key string) bool {
+	return contentKeyPattern.MatchString(key)
+}
+
+// CacheControl returns the Cache-Control policy for an image key
+func CacheControl(key string) string {
+	if IsContentKey(key) {
+		return ImmutableCacheControl
+	}
+	return DefaultCacheControl
+}
@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -32,17 +34,98 @@ func (s *localStorage) SaveImage(ctx context.Context, imageData []byte, filename
 		filename += ext
 	}
 
-	// Create the full file path
-	filePath := filepath.Join(s.baseDir, filename)
+	// Create the full file path, including any shard directories
+	filePath := filepath.Join(s.baseDir, filepath.FromSlash(filename))
 
-	// Write the file
-	if err := os.WriteFile(filePath, imageData, 0644); err != nil {
+	// Content-addressed keys never change, so an existing file can be reused as-is
+	exists, err := s.Exists(ctx, filename)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return filename, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+	}
+
+	if err := writeFileAtomic(filePath, imageData); err != nil {
 		return "", fmt.Errorf("failed to save image to %s: %w", filePath, err)
 	}
 
 	return filename, nil
 }
 
+// writeFileAtomic writes data to a temporary file next to path and renames it into place,
+// so a failed write never leaves a truncated file under a key that is later reused
+func writeFileAtomic(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Exists reports whether the file is already present on disk
+func (s *localStorage) Exists(ctx context.Context, filename string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.baseDir, filepath.FromSlash(filename)))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat %s: %w", filename, err)
+}
+
+// GetImage reads the file from disk
+func (s *localStorage) GetImage(ctx context.Context, filename string) ([]byte, error) {
+	// Keys come from URLs, so make sure they cannot escape the base directory
+	if !fs.ValidPath(filename) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.baseDir, filepath.FromSlash(filename)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return data, nil
+}
+
+// DeleteImage removes the file from disk
+func (s *localStorage) DeleteImage(ctx context.Context, filename string) error {
+	if !fs.ValidPath(filename) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.baseDir, filepath.FromSlash(filename)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", filename, err)
+	}
+	return nil
+}
+
 // GetImageURL returns the relative path to the image
 func (s *localStorage) GetImageURL(filename string) string {
 	// For local storage, we just return the relative path
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorageContentAddressedKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	data := []byte("\x89PNG\r\n\x1a\n fake image")
+	contentType, ext, err := SniffImageType(data)
+	if err != nil || contentType != "image/png" || ext != ".png" {
+		t.Fatalf("expected PNG, got %q %q (%v)", contentType, ext, err)
+	}
+
+	key := ContentKey(data, ext)
+	if key != ContentKey(data, ext) || filepath.Dir(key) != filepath.Join(key[0:2], key[3:5]) {
+		t.Fatalf("unexpected content key %q", key)
+	}
+
+	if _, err := s.SaveImage(ctx, data, key); err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+	path := filepath.Join(dir, filepath.FromSlash(key))
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected file in shard directory: %v", err)
+	}
+
+	// Saving the same content again must not rewrite the file
+	if err := os.Chmod(path, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveImage(ctx, data, key); err != nil {
+		t.Fatalf("expected duplicate save to be skipped, got %v", err)
+	}
+	if again, _ := os.Stat(path); !again.ModTime().Equal(info.ModTime()) {
+		t.Error("expected existing file to be left untouched")
+	}
+
+	if got, err := s.GetImage(ctx, key); err != nil || string(got) != string(data) {
+		t.Errorf("expected to read back the image, got %q (%v)", got, err)
+	}
+	if _, err := s.GetImage(ctx, "../"+filepath.Base(dir)+"/"+key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected path traversal to be rejected, got %v", err)
+	}
+
+	if _, _, err := SniffImageType([]byte("<html></html>")); err == nil {
+		t.Error("expected non-image data to be rejected")
+	}
+}
+
+func TestWriteFileAtomicCleansUpOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "image.png")
+	if err := writeFileAtomic(path, []byte("image")); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "image" {
+		t.Errorf("expected the file to be written, got %q", got)
+	}
+
+	// A non-empty directory in the way makes the rename fail
+	blocked := filepath.Join(dir, "blocked.png")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(blocked, []byte("image")); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected no temporary files to be left behind, got %v", entries)
+	}
+}
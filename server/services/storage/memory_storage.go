@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Faults configures failures injected into MemoryStorage operations
+type Faults struct {
+	// Latency delays every operation, honouring context cancellation
+	Latency time.Duration
+	// SaveErr makes SaveImage fail without storing anything
+	SaveErr error
+	// ExistsErr makes Exists, and therefore SaveImage, fail
+	ExistsErr error
+	// FailAfter lets the given number of saves succeed before SaveErr applies
+	FailAfter int
+}
+
+// MemoryStorage implements StorageProvider in memory, with optional fault injection.
+// It is intended for tests and throwaway local runs.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	faults  Faults
+	saves   int
+}
+
+// NewMemoryStorage creates a new empty in-memory storage provider
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string][]byte),
+	}
+}
+
+// SetFaults replaces the faults injected into subsequent operations
+func (s *MemoryStorage) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+	s.saves = 0
+}
+
+// SaveImage stores a copy of the image data under the filename
+func (s *MemoryStorage) SaveImage(ctx context.Context, imageData []byte, filename string) (string, error) {
+	if err := s.delay(ctx); err != nil {
+		return "", err
+	}
+
+	// Ensure the filename has an extension, like the other providers
+	if filepath.Ext(filename) == "" {
+		filename += ".png"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like the other providers, saving checks for an existing object first
+	if s.faults.ExistsErr != nil {
+		return "", s.faults.ExistsErr
+	}
+
+	s.saves++
+	if s.saves > s.faults.FailAfter && s.faults.SaveErr != nil {
+		return "", s.faults.SaveErr
+	}
+
+	if _, exists := s.objects[filename]; !exists {
+		s.objects[filename] = append([]byte(nil), imageData...)
+	}
+
+	return filename, nil
+}
+
+// GetImageURL returns a relative path like the local storage provider
+func (s *MemoryStorage) GetImageURL(filename string) string {
+	return "/images/" + filename
+}
+
+// Exists reports whether an object is stored under the key
+func (s *MemoryStorage) Exists(ctx context.Context, filename string) (bool, error) {
+	if err := s.delay(ctx); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.faults.ExistsErr != nil {
+		return false, s.faults.ExistsErr
+	}
+	_, exists := s.objects[filename]
+	return exists, nil
+}
+
+// GetImage returns a copy of the stored image data
+func (s *MemoryStorage) GetImage(ctx context.Context, filename string) ([]byte, error) {
+	if err := s.delay(ctx); err != nil {
+		return nil, err
+	}
+
+	data, exists := s.Object(filename)
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// DeleteImage removes the object
+func (s *MemoryStorage) DeleteImage(ctx context.Context, filename string) error {
+	if err := s.delay(ctx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, filename)
+	return nil
+}
+
+// Object returns a copy of the data stored under the key
+func (s *MemoryStorage) Object(filename string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.objects[filename]
+	if !exists {
+		return nil, false
+	}
+	return append([]byte(nil), data...), true
+}
+
+// Keys returns the sorted keys of all stored objects
+func (s *MemoryStorage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// delay waits for the configured latency or until the context is done
+func (s *MemoryStorage) delay(ctx context.Context) error {
+	s.mu.Lock()
+	latency := s.faults.Latency
+	s.mu.Unlock()
+
+	if latency <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
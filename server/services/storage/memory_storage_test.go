@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	key, err := s.SaveImage(ctx, []byte("data"), "ab/cd/abcd")
+	if err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+	if key != "ab/cd/abcd.png" {
+		t.Errorf("expected default extension, got %q", key)
+	}
+	if exists, _ := s.Exists(ctx, key); !exists {
+		t.Error("expected object to exist")
+	}
+	if data, _ := s.Object(key); !bytes.Equal(data, []byte("data")) {
+		t.Errorf("unexpected object data %q", data)
+	}
+	if url := s.GetImageURL(key); url != "/images/ab/cd/abcd.png" {
+		t.Errorf("unexpected URL %q", url)
+	}
+}
+
+func TestMemoryStorageFaults(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	s := NewMemoryStorage()
+	s.SetFaults(Faults{SaveErr: errBoom, FailAfter: 1})
+	if _, err := s.SaveImage(ctx, []byte("a"), "a.png"); err != nil {
+		t.Fatalf("expected first save to succeed, got %v", err)
+	}
+	if _, err := s.SaveImage(ctx, []byte("b"), "b.png"); !errors.Is(err, errBoom) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	if _, exists := s.Object("b.png"); exists {
+		t.Error("failed save must not store anything")
+	}
+
+	s.SetFaults(Faults{Latency: time.Second})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Exists(ctx, "a.png"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected latency to honour context deadline, got %v", err)
+	}
+}
@@ -3,10 +3,12 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -67,27 +69,91 @@ func (s *s3Storage) SaveImage(ctx context.Context, imageData []byte, filename st
 		filename += ext
 	}
 
-	// Create a unique filename with timestamp
-	timestamp := time.Now().Unix()
-	uniqueFilename := fmt.Sprintf("%d_%s", timestamp, filename)
+	// Content-addressed keys never change, so skip the upload if the object is already there
+	exists, err := s.Exists(ctx, filename)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return filename, nil
+	}
 
 	// Upload the file to S3
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(uniqueFilename),
-		Body:        bytes.NewReader(imageData),
-		ContentType: aws.String("image/" + strings.TrimPrefix(ext, ".")),
-		ACL:         types.ObjectCannedACLPublicRead, // Make the object publicly accessible
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucketName),
+		Key:          aws.String(filename),
+		Body:         bytes.NewReader(imageData),
+		ContentType:  aws.String(contentTypeForExt(ext)),
+		CacheControl: aws.String(CacheControl(filename)),
+		ACL:          types.ObjectCannedACLPublicRead, // Make the object publicly accessible
 	})
 
 	if err != nil {
 		return "", fmt.Errorf("failed to upload to S3: %w", err)
 	}
 
-	return uniqueFilename, nil
+	return filename, nil
+}
+
+// Exists checks for the object with a HEAD request
+func (s *s3Storage) Exists(ctx context.Context, filename string) (bool, error) {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(filename),
+	})
+	if err == nil {
+		return true, nil
+	}
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check S3 object %s: %w", filename, err)
+}
+
+// GetImage downloads the object from S3
+func (s *s3Storage) GetImage(ctx context.Context, filename string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s from S3: %w", filename, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from S3: %w", filename, err)
+	}
+	return data, nil
+}
+
+// DeleteImage deletes the object from S3, which succeeds even if it doesn't exist
+func (s *s3Storage) DeleteImage(ctx context.Context, filename string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from S3: %w", filename, err)
+	}
+	return nil
 }
 
 // GetImageURL returns the public URL for the image
 func (s *s3Storage) GetImageURL(filename string) string {
 	return fmt.Sprintf("%s/%s", s.publicURL, filename)
 }
+
+// contentTypeForExt returns the MIME type for a file extension, e.g. image/jpeg for .jpg
+func contentTypeForExt(ext string) string {
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "image/" + strings.TrimPrefix(ext, ".")
+}
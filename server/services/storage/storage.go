@@ -2,15 +2,33 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 )
 
+// ErrNotFound is returned when no object is stored under the requested key
+var ErrNotFound = errors.New("image not found")
+
 // StorageProvider defines the interface for different storage implementations
 type StorageProvider interface {
 	// SaveImage saves image data and returns the URL or path to access it
 	SaveImage(ctx context.Context, imageData []byte, filename string) (string, error)
 	// GetImageURL returns the URL or path to access the image
 	GetImageURL(filename string) string
+	// Exists reports whether an object is already stored under the key
+	Exists(ctx context.Context, filename string) (bool, error)
+	// GetImage returns the stored image data, or ErrNotFound
+	GetImage(ctx context.Context, filename string) ([]byte, error)
+	// DeleteImage removes the object. Deleting a missing object is not an error.
+	DeleteImage(ctx context.Context, filename string) error
+}
+
+// ImageKey returns the storage key for a URL returned by GetImageURL, or false if the URL
+// doesn't belong to the provider
+func ImageKey(provider StorageProvider, url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, provider.GetImageURL(""))
+	return key, ok && key != ""
 }
 
 // StorageType represents the type of storage to use
@@ -21,6 +39,8 @@ const (
 	StorageTypeLocal StorageType = "local"
 	// StorageTypeS3 represents AWS S3 or S3-compatible storage
 	StorageTypeS3 StorageType = "s3"
+	// StorageTypeMemory represents in-memory storage, used for tests and throwaway runs
+	StorageTypeMemory StorageType = "memory"
 )
 
 // Config holds configuration for storage providers
@@ -42,6 +62,8 @@ func NewStorage(cfg Config) (StorageProvider, error) {
 		return NewLocalStorage(cfg.LocalDirectory)
 	case StorageTypeS3:
 		return NewS3Storage(cfg)
+	case StorageTypeMemory:
+		return NewMemoryStorage(), nil
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Type)
 	}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Diff operation types
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffOp is a run of text that is unchanged, inserted or deleted
+type DiffOp struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// diffTokenPattern splits text into words and the whitespace between them, so joining the
+// tokens gives back the original text
+var diffTokenPattern = regexp.MustCompile(`\s+|\S+`)
+
+// DiffWords returns a word-level diff that turns a into b. Concatenating the equal and
+// delete runs gives a, and the equal and insert runs gives b.
+func DiffWords(a, b string) []DiffOp {
+	return diffTokens(diffTokenPattern.FindAllString(a, -1), diffTokenPattern.FindAllString(b, -1))
+}
+
+// diffTokens is Myers' O(ND) diff algorithm. It keeps the furthest reaching path for each
+// edit distance and walks back through them to recover the edit script.
+func diffTokens(a, b []string) []DiffOp {
+	// Trim the common prefix and suffix, which is most of the text for typical edits
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	ops = appendDiffOps(ops, DiffEqual, a[:prefix]...)
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	ops = appendDiffOps(ops, DiffEqual, a[len(a)-suffix:]...)
+	return mergeDiffOps(ops)
+}
+
+// maxDiffEdits caps the edit distance myers searches. The search keeps a snapshot per edit
+// step, so unrelated texts would otherwise cost time and memory quadratic in their length.
+const maxDiffEdits = 1000
+
+func myers(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	max := n + m
+	offset := max
+	v := make([]int, 2*max+2)
+	// trace[d] holds v for diagonals -d..d as it was before edit step d
+	var trace [][]int
+	found := false
+
+search:
+	for d := 0; d <= max && d <= maxDiffEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+	if !found {
+		// Too different to diff word by word, so replace the whole text
+		return append(appendDiffOps(nil, DiffDelete, a...), appendDiffOps(nil, DiffInsert, b...)...)
+	}
+
+	// Walk back from the end, collecting operations in reverse
+	var reversed []DiffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prevX, prevY := 0, 0
+		if d > 0 {
+			v := trace[d]
+			k := x - y
+			var prevK int
+			if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+				prevK = k + 1
+			} else {
+				prevK = k - 1
+			}
+			prevX = v[d+prevK]
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffOp{Type: DiffEqual, Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, DiffOp{Type: DiffInsert, Text: b[y-1]})
+			} else {
+				reversed = append(reversed, DiffOp{Type: DiffDelete, Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]DiffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+func appendDiffOps(ops []DiffOp, opType string, tokens ...string) []DiffOp {
+	for _, token := range tokens {
+		ops = append(ops, DiffOp{Type: opType, Text: token})
+	}
+	return ops
+}
+
+// mergeDiffOps joins adjacent operations of the same type into single runs
+func mergeDiffOps(ops []DiffOp) []DiffOp {
+	merged := make([]DiffOp, 0, len(ops))
+	var run strings.Builder
+	for i, op := range ops {
+		run.WriteString(op.Text)
+		if i == len(ops)-1 || ops[i+1].Type != op.Type {
+			merged = append(merged, DiffOp{Type: op.Type, Text: run.String()})
+			run.Reset()
+		}
+	}
+	return merged
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"dreams/models"
+)
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffOp
+	}{
+		{"identical", "a red door", "a red door", []DiffOp{{DiffEqual, "a red door"}}},
+		{"both empty", "", "", []DiffOp{}},
+		{"from empty", "", "a door", []DiffOp{{DiffInsert, "a door"}}},
+		{"to empty", "a door", "", []DiffOp{{DiffDelete, "a door"}}},
+		{
+			"replaced word",
+			"I opened a red door",
+			"I opened a blue door",
+			[]DiffOp{{DiffEqual, "I opened a "}, {DiffDelete, "red"}, {DiffInsert, "blue"}, {DiffEqual, " door"}},
+		},
+		{
+			"added detail",
+			"The school was flooded.",
+			"The old school was flooded. Fish swam past.",
+			[]DiffOp{{DiffEqual, "The "}, {DiffInsert, "old "}, {DiffEqual, "school was flooded."}, {DiffInsert, " Fish swam past."}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffWords(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffWords(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffWordsReconstructsBothTexts(t *testing.T) {
+	a := "We were on a train through the mountains and my brother kept losing his ticket"
+	b := "I was alone on a slow train through snowy mountains and kept losing my ticket again"
+
+	var before, after strings.Builder
+	for _, op := range DiffWords(a, b) {
+		if op.Type != DiffInsert {
+			before.WriteString(op.Text)
+		}
+		if op.Type != DiffDelete {
+			after.WriteString(op.Text)
+		}
+	}
+	if before.String() != a || after.String() != b {
+		t.Errorf("diff does not reconstruct the texts:\n%q\n%q", before.String(), after.String())
+	}
+}
+
+func TestDiffWordsUnrelatedLargeTexts(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; a.Len() < models.MaxDreamLength; i++ {
+		fmt.Fprintf(&a, "alpha%d ", i)
+		fmt.Fprintf(&b, "beta%d ", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops := DiffWords(a.String(), b.String())
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("expected a bounded diff, allocated %d MB", allocated>>20)
+	}
+	// Only the trailing space is shared
+	want := []DiffOp{
+		{DiffDelete, strings.TrimSuffix(a.String(), " ")},
+		{DiffInsert, strings.TrimSuffix(b.String(), " ")},
+		{DiffEqual, " "},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("expected the whole text to be replaced, got %d operations", len(ops))
+	}
+}
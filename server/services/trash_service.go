@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"dreams/database"
+	"dreams/models"
+	"dreams/services/storage"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTrashRetention is how long deleted dreams stay in the trash before they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashPurgeInterval is how often the purge job looks for expired dreams
+const trashPurgeInterval = time.Hour
+
+// TrashService permanently deletes dreams from the trash, either on request or once they
+// have been there longer than the retention period
+type TrashService struct {
+	db              *gorm.DB
+	storageProvider storage.StorageProvider
+	retention       time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
+}
+
+// NewTrashService creates a trash service. A retention of zero or less keeps deleted
+// dreams until they are purged by hand.
+func NewTrashService(db *gorm.DB, storageProvider storage.StorageProvider, retention time.Duration) *TrashService {
+	return &TrashService{
+		db:              db,
+		storageProvider: storageProvider,
+		retention:       retention,
+		stop:            make(chan struct{}),
+	}
+}
+
+// Retention returns how long deleted dreams are kept, or zero if they are kept forever
+func (s *TrashService) Retention() time.Duration {
+	if s.retention <= 0 {
+		return 0
+	}
+	return s.retention
+}
+
+// Start runs the purge job in the background until Stop is called
+func (s *TrashService) Start() {
+	if s.Retention() == 0 {
+		log.Println("Trash retention disabled, deleted dreams are kept until purged")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.PurgeExpired(context.Background()); err != nil {
+				log.Printf("Error purging trash: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	log.Printf("Trash purge job started, retention %s", s.retention)
+}
+
+// Stop stops the purge job
+func (s *TrashService) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// PurgeExpired permanently deletes dreams that were deleted longer ago than the retention
+// period and returns how many were purged. A dream that fails to purge is logged and skipped.
+func (s *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	if s.Retention() == 0 {
+		return 0, nil
+	}
+
+	var dreams []models.Dream
+	cutoff := time.Now().Add(-s.retention)
+	if err := s.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Find(&dreams).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired dreams: %w", err)
+	}
+
+	// One dream that can't be purged mustn't hold back the rest
+	purged := 0
+	for _, dream := range dreams {
+		if err := s.Purge(ctx, dream); err != nil {
+			log.Printf("Error purging dream %d: %v", dream.ID, err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		log.Printf("Purged %d dreams from the trash", purged)
+	}
+	if failed := len(dreams) - purged; failed > 0 {
+		return purged, fmt.Errorf("failed to purge %d expired dreams", failed)
+	}
+	return purged, nil
+}
+
+// Purge permanently deletes a dream with its tags, revisions, keyphrases, embedding and any
+// images no other dream uses
+func (s *TrashService) Purge(ctx context.Context, dream models.Dream) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM dream_tags WHERE dream_id = ?", dream.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("dream_id = ?", dream.ID).Delete(&models.DreamRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("dream_id = ?", dream.ID).Delete(&models.DreamKeyphrase{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("dream_id = ?", dream.ID).Delete(&models.DreamSignAnalysis{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("dream_id = ?", dream.ID).Delete(&models.DreamEmbedding{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("dream_id = ?", dream.ID).Delete(&models.DreamEmotion{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Dream{}, dream.ID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to purge dream %d: %w", dream.ID, err)
+	}
+
+	// The dream is gone either way, so a failed cleanup only leaves an orphaned image
+	urls := []string{dream.ImageURL}
+	for _, url := range dream.ImageVariants {
+		urls = append(urls, url)
+	}
+	for _, url := range urls {
+		if err := s.deleteUnusedImage(ctx, url); err != nil {
+			log.Printf("Error deleting image %s of purged dream %d: %v", url, dream.ID, err)
+		}
+	}
+	return nil
+}
+
+// deleteUnusedImage deletes the image behind the URL unless another dream, in the trash or
+// not, still uses it. Content-addressed keys mean identical images are shared.
+func (s *TrashService) deleteUnusedImage(ctx context.Context, url string) error {
+	key, ok := storage.ImageKey(s.storageProvider, url)
+	if !ok {
+		return nil
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Unscoped().Model(&models.Dream{}).
+		Where(`image_url = ? OR image_variants LIKE ? ESCAPE '\'`, url, `%"`+database.EscapeLike(url)+`"%`).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return s.storageProvider.DeleteImage(ctx, key)
+}
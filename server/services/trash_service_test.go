@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dreams/database"
+	"dreams/migrations"
+	"dreams/models"
+	"dreams/services/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens a migrated SQLite database in a temporary directory
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := database.Open("sqlite:"+filepath.Join(t.TempDir(), "dreams.db"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestTrashPurgeExpired(t *testing.T) {
+	db := openTestDB(t)
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	for _, key := range []string{"shared.png", "own.png", "own_thumbnail.png"} {
+		if _, err := store.SaveImage(ctx, []byte("image"), key); err != nil {
+			t.Fatalf("failed to save %s: %v", key, err)
+		}
+	}
+
+	expired := models.Dream{
+		Dream:         "Deleted long ago",
+		ImageURL:      "/images/own.png",
+		ImageVariants: models.ImageVariants{"thumbnail": "/images/own_thumbnail.png"},
+	}
+	sharing := models.Dream{Dream: "Also deleted long ago", ImageURL: "/images/shared.png"}
+	recent := models.Dream{Dream: "Deleted just now", ImageURL: "/images/shared.png"}
+	kept := models.Dream{Dream: "Not deleted"}
+	for _, dream := range []*models.Dream{&expired, &sharing, &recent, &kept} {
+		if err := db.Create(dream).Error; err != nil {
+			t.Fatalf("failed to create dream: %v", err)
+		}
+	}
+	db.Create(&models.DreamRevision{DreamID: expired.ID, Version: 1, Dream: expired.Dream})
+	db.Delete(&recent)
+	old := time.Now().Add(-48 * time.Hour)
+	db.Unscoped().Model(&models.Dream{}).Where("id IN ?", []uint{expired.ID, sharing.ID}).Update("deleted_at", old)
+
+	trash := NewTrashService(db, store, 24*time.Hour)
+	purged, err := trash.PurgeExpired(ctx)
+	if err != nil || purged != 2 {
+		t.Fatalf("expected 2 dreams purged, got %d, %v", purged, err)
+	}
+
+	var remaining []uint
+	db.Unscoped().Model(&models.Dream{}).Order("id").Pluck("id", &remaining)
+	if len(remaining) != 2 || remaining[0] != recent.ID || remaining[1] != kept.ID {
+		t.Errorf("expected the recent and kept dreams to remain, got %v", remaining)
+	}
+	var revisions int64
+	db.Model(&models.DreamRevision{}).Count(&revisions)
+	if revisions != 0 {
+		t.Errorf("expected revisions of purged dreams to be deleted, got %d", revisions)
+	}
+
+	// The shared image is still used by the dream that was deleted recently
+	if keys := store.Keys(); len(keys) != 1 || keys[0] != "shared.png" {
+		t.Errorf("expected only the shared image to remain, got %v", keys)
+	}
+
+	if purged, _ := NewTrashService(db, store, 0).PurgeExpired(ctx); purged != 0 {
+		t.Errorf("expected no purge with retention disabled, got %d", purged)
+	}
+}
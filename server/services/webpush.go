@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dreams/models"
+)
+
+const (
+	// webPushTTL is how long the push service keeps a reminder for an offline browser, as
+	// a reminder is pointless once the dream is forgotten
+	webPushTTL = 2 * time.Hour
+	// webPushRecordSize is the aes128gcm record size, larger than any reminder
+	webPushRecordSize = 4096
+)
+
+// WebPushNotifier sends reminders to browsers through their push service, encrypting the
+// payload as RFC 8291 requires and identifying the server with VAPID (RFC 8292)
+type WebPushNotifier struct {
+	client *http.Client
+	key    *ecdsa.PrivateKey
+	// publicKey is the uncompressed VAPID public key, which browsers need to subscribe
+	publicKey []byte
+	// subject is a mailto: or https: contact for push services, such as mailto:admin@example.com
+	subject string
+	now     func() time.Time
+}
+
+// NewWebPushNotifier creates a Web Push notifier from a base64url-encoded VAPID private
+// key, the format web-push libraries generate
+func NewWebPushNotifier(privateKey, subject string) (*WebPushNotifier, error) {
+	raw, err := models.DecodePushKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	publicKey := key.PublicKey().Bytes()
+	return &WebPushNotifier{
+		client: &http.Client{Timeout: 30 * time.Second},
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(publicKey[1:33]),
+				Y:     new(big.Int).SetBytes(publicKey[33:]),
+			},
+			D: new(big.Int).SetBytes(raw),
+		},
+		publicKey: publicKey,
+		subject:   subject,
+		now:       time.Now,
+	}, nil
+}
+
+// PublicKey returns the base64url VAPID public key for PushManager.subscribe
+func (n *WebPushNotifier) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(n.publicKey)
+}
+
+func (n *WebPushNotifier) Notify(ctx context.Context, reminder models.Reminder, notification Notification) error {
+	if reminder.Subscription == nil {
+		return fmt.Errorf("reminder %d has no push subscription", reminder.ID)
+	}
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	body, err := encryptPushPayload(*reminder.Subscription, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := n.vapidAuthorization(reminder.Subscription.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reminder.Subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach push service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrSubscriptionGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("push service returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// vapidAuthorization signs a VAPID token for the push service at endpoint
+func (n *WebPushNotifier) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": n.now().Add(12 * time.Hour).Unix(),
+		"sub": n.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, n.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	// JWS signatures are the fixed-size r and s rather than ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", token, n.PublicKey()), nil
+}
+
+// encryptPushPayload encrypts payload for the subscription as a single aes128gcm record
+// (RFC 8188), keyed as described in RFC 8291
+func encryptPushPayload(subscription models.PushSubscription, payload []byte) ([]byte, error) {
+	browserKeyBytes, err := models.DecodePushKey(subscription.Keys.P256DH)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %w", err)
+	}
+	browserKey, err := ecdh.P256().NewPublicKey(browserKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %w", err)
+	}
+	authSecret, err := models.DecodePushKey(subscription.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription secret: %w", err)
+	}
+
+	// A fresh key pair and salt for every message
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(browserKey)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	contentKey, nonce, err := pushContentKeys(sharedSecret, authSecret, salt, browserKeyBytes, serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The 0x02 delimiter marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > webPushRecordSize {
+		return nil, fmt.Errorf("push payload of %d bytes is too large", len(payload))
+	}
+
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// pushContentKeys derives the content encryption key and nonce of a push message from the
+// ECDH secret, the subscription's auth secret and the record salt
+func pushContentKeys(sharedSecret, authSecret, salt, browserPublic, serverPublic []byte) (key, nonce []byte, err error) {
+	prk, err := hkdf.Extract(sha256.New, sharedSecret, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(browserPublic) + string(serverPublic)
+	ikm, err := hkdf.Expand(sha256.New, prk, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err = hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	if nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12); err != nil {
+		return nil, nil, err
+	}
+	return key, nonce, nil
+}
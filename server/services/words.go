@@ -0,0 +1,84 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minWordLength drops words too short to say much about a dream
+const minWordLength = 3
+
+// stopwords are common English words left out of word counts
+var stopwords = makeWordSet(`a about above after again against all also am an and any are as at be
+because been before being below between both but by can could did do does doing down during each
+even ever every few for from further get got had has have having he her here hers herself him
+himself his how i if in into is it its itself just like made make me more most much must my myself
+never no nor not now of off on once only or other our ours ourselves out over own really same saw
+say said see seemed she should so some something still such than that the their theirs them
+themselves then there these they thing things this those though through to too under until up
+upon us very was we were what when where which while who whom why will with would you your yours
+yourself yourselves back around again went going go came come started felt feel know knew think
+thought remember remembered looked look one two someone somewhere trying tried kept dream dreams
+dreamt dreamed dreaming`)
+
+func makeWordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// contentWords splits text into lowercase words, dropping stopwords, contractions, numbers
+// and very short words
+func contentWords(text string) []string {
+	fields := wordFields(text)
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if word, ok := contentWord(field); ok {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// wordFields splits text into lowercase runs of letters and apostrophes
+func wordFields(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\'' && r != '’'
+	})
+}
+
+// contentWord normalises a field from wordFields, reporting false for words that carry
+// little meaning
+func contentWord(field string) (string, bool) {
+	word := strings.Trim(strings.ReplaceAll(field, "’", "'"), "'")
+	if len([]rune(word)) < minWordLength || stopwords[word] {
+		return "", false
+	}
+	// Possessives count as the word itself
+	word = strings.TrimSuffix(word, "'s")
+	if stopwords[word] || strings.Contains(word, "'") {
+		return "", false
+	}
+	return word, true
+}
+
+// stemWord strips common English suffixes so that "flying" and "flies" match "fly". It
+// is deliberately crude, as stems are only compared with each other and never shown.
+func stemWord(word string) string {
+	for _, rule := range []struct {
+		suffix, replacement string
+		minStem             int
+	}{{"ies", "y", 2}, {"ing", "", 3}, {"ed", "", 3}, {"es", "", 3}, {"s", "", 3}} {
+		if stem, ok := strings.CutSuffix(word, rule.suffix); ok && len([]rune(stem)) >= rule.minStem && !strings.HasSuffix(word, "ss") {
+			stem += rule.replacement
+			// Undo the doubled consonant of "running" and "stopped"
+			if n := len(stem); rule.replacement == "" && n > 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiousl", rune(stem[n-1])) {
+				stem = stem[:n-1]
+			}
+			return stem
+		}
+	}
+	return word
+}
@@ -1,29 +1,53 @@
 'use client';
 
-import { useEffect, useState } from 'react';
+import { useCallback, useEffect, useRef, useState } from 'react';
 import { Dream } from '@/lib/types/dream';
 import { DreamService } from '@/lib/services/dream-service';
 import Link from 'next/link';
 import { ChevronRightIcon } from './icons/ChevronRightIcon';
+import { thumbnailUrl } from '@/lib/image-variants';
 
 export default function DreamList() {
   const dreamService = new DreamService();
   const [dreams, setDreams] = useState<Dream[]>([]);
   const [error, setError] = useState<string | null>(null);
+  const [nextCursor, setNextCursor] = useState<string | undefined>(undefined);
+  const [hasMore, setHasMore] = useState(true);
+  const [loading, setLoading] = useState(false);
+  const sentinelRef = useRef<HTMLDivElement | null>(null);
 
+  const loadMore = useCallback(async () => {
+    if (loading || !hasMore) {
+      return;
+    }
+    setLoading(true);
+    try {
+      const page = await dreamService.list({ cursor: nextCursor });
+      setDreams((current) => [...current, ...page.dreams]);
+      setNextCursor(page.next_cursor);
+      setHasMore(Boolean(page.next_cursor));
+    } catch (err) {
+      setError('Failed to load dreams');
+      console.error('Error loading dreams:', err);
+    } finally {
+      setLoading(false);
+    }
+  }, [loading, hasMore, nextCursor]);
+
+  // Load the next page whenever the sentinel below the list scrolls into view
   useEffect(() => {
-    const loadDreams = async () => {
-      try {
-        const fetchedDreams = await dreamService.getAll();
-        setDreams(fetchedDreams);
-      } catch (err) {
-        setError('Failed to load dreams');
-        console.error('Error loading dreams:', err);
+    const sentinel = sentinelRef.current;
+    if (!sentinel) {
+      return;
+    }
+    const observer = new IntersectionObserver((entries) => {
+      if (entries[0].isIntersecting) {
+        loadMore();
       }
-    };
-
-    loadDreams();
-  }, []);
+    });
+    observer.observe(sentinel);
+    return () => observer.disconnect();
+  }, [loadMore]);
 
   if (error) {
     return (
@@ -36,7 +60,7 @@ export default function DreamList() {
   return (
     <div className="space-y-4">
       <h2 className="text-2xl font-semibold mb-4 text-purple-300">Your Dreams</h2>
-      {dreams.length === 0 ? (
+      {dreams.length === 0 && !hasMore ? (
         <p className="text-gray-500">No dreams recorded yet.</p>
       ) : (
         <div className="space-y-4">
@@ -46,11 +70,21 @@ export default function DreamList() {
               href={`/dream/${dream.id}`}
               className="group relative block p-4 border border-gray-700 rounded hover:bg-gray-800/50 transition-all cursor-pointer"
             >
-              <div className="pr-8">
-                <p className="text-gray-200 whitespace-pre-wrap line-clamp-3">{dream.dream}</p>
-                <p className="text-sm text-gray-400 mt-2">
-                  {new Date(dream.created_at).toLocaleDateString()}
-                </p>
+              <div className="pr-8 flex gap-4">
+                {thumbnailUrl(dream) && (
+                  <img
+                    src={thumbnailUrl(dream)}
+                    alt=""
+                    loading="lazy"
+                    className="w-20 h-20 object-cover rounded flex-shrink-0"
+                  />
+                )}
+                <div className="min-w-0">
+                  <p className="text-gray-200 whitespace-pre-wrap line-clamp-3">{dream.dream}</p>
+                  <p className="text-sm text-gray-400 mt-2">
+                    {new Date(dream.created_at).toLocaleDateString()}
+                  </p>
+                </div>
               </div>
               <div className="absolute right-4 top-1/2 -translate-y-1/2">
                 <ChevronRightIcon className="w-5 h-5 text-gray-500 opacity-0 group-hover:opacity-100 group-hover:text-purple-400 transition-all duration-200" />
@@ -59,6 +93,11 @@ export default function DreamList() {
           ))}
         </div>
       )}
+      {hasMore && (
+        <div ref={sentinelRef} className="py-4 text-center text-sm text-gray-500">
+          {loading ? 'Loading more dreams...' : ''}
+        </div>
+      )}
     </div>
   );
 }
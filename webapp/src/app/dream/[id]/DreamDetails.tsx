@@ -5,10 +5,16 @@ import { useRouter, useParams } from 'next/navigation';
 import Link from 'next/link';
 import { Dream } from '@/lib/types/dream';
 import { DreamService } from '@/lib/services/dream-service';
+import { ApiError } from '@/lib/services/api';
+import { imageSrcSet } from '@/lib/image-variants';
 
 // Icons
 import { PencilIcon, TrashIcon, XMarkIcon, CheckIcon } from '@heroicons/react/24/outline';
 
+// The server answers 412 with this code when the If-Match version is stale
+const isConflict = (err: unknown) =>
+  err instanceof ApiError && err.code === 'version_conflict';
+
 type GenerationStatus = {
   isGenerating: boolean;
   message: string;
@@ -121,12 +127,14 @@ export default function DreamDetails() {
     
     try {
       // Pass the edited dream content as a string directly
-      const updatedDream = await dreamService.update(dream.id, editedDream);
+      const updatedDream = await dreamService.update(dream.id, editedDream, dream.version);
       setDream(updatedDream);
       setIsEditing(false);
     } catch (err) {
       console.error('Error updating dream:', err);
-      setError('Failed to update dream. Please try again.');
+      setError(isConflict(err)
+        ? 'This dream was changed somewhere else. Reload the page to see the latest version.'
+        : 'Failed to update dream. Please try again.');
     }
   };
 
@@ -144,11 +152,13 @@ export default function DreamDetails() {
     
     try {
       // Use removeDelete with string ID
-      await dreamService.removeDelete(dream.id.toString());
+      await dreamService.removeDelete(dream.id.toString(), dream.version);
       router.push('/dreams');
     } catch (err) {
       console.error('Error deleting dream:', err);
-      setError('Failed to delete dream. Please try again.');
+      setError(isConflict(err)
+        ? 'This dream was changed somewhere else. Reload the page before deleting it.'
+        : 'Failed to delete dream. Please try again.');
     }
   };
 
@@ -289,6 +299,8 @@ export default function DreamDetails() {
               <div className="relative">
                 <img
                   src={dream.image_url}
+                  srcSet={imageSrcSet(dream)}
+                  sizes="(max-width: 768px) 100vw, 768px"
                   alt="Generated from dream"
                   className="w-full h-auto rounded-lg"
                   onError={(e) => {
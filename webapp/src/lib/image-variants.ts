@@ -0,0 +1,22 @@
+import { Dream } from '@/lib/types/dream';
+
+// Widths must match the variant sizes rendered by the server
+const VARIANT_WIDTHS = {
+  thumbnail: 256,
+  medium: 768,
+} as const;
+
+export function imageSrcSet(dream: Dream): string | undefined {
+  const variants = dream.image_variants;
+  if (!variants) {
+    return undefined;
+  }
+  const entries = (Object.keys(VARIANT_WIDTHS) as (keyof typeof VARIANT_WIDTHS)[])
+    .filter((name) => variants[name])
+    .map((name) => `${variants[name]} ${VARIANT_WIDTHS[name]}w`);
+  return entries.length > 0 ? entries.join(', ') : undefined;
+}
+
+export function thumbnailUrl(dream: Dream): string | undefined {
+  return dream.image_variants?.thumbnail || dream.image_variants?.medium || dream.image_url;
+}
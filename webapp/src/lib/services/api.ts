@@ -1,3 +1,11 @@
+// ApiError carries the status and machine-readable code of an RFC 7807 problem response
+export class ApiError extends Error {
+  constructor(message: string, public status: number, public code?: string) {
+    super(message);
+    this.name = 'ApiError';
+  }
+}
+
 export abstract class Api {
   protected baseUrl = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
 
@@ -20,14 +28,16 @@ export abstract class Api {
 
       if (!response.ok) {
         let errorMessage = 'An error occurred';
+        let code: string | undefined;
         try {
-          const error = JSON.parse(responseText);
-          errorMessage = error.message || errorMessage;
+          const problem = JSON.parse(responseText);
+          errorMessage = problem.detail || problem.title || errorMessage;
+          code = problem.code;
         } catch (e) {
           errorMessage = responseText || errorMessage;
         }
-        console.error('API Error:', { url, status: response.status, message: errorMessage });
-        throw new Error(errorMessage);
+        console.error('API Error:', { url, status: response.status, code, message: errorMessage });
+        throw new ApiError(errorMessage, response.status, code);
       }
 
       return new Response(responseText, {
@@ -47,9 +57,10 @@ export abstract class Api {
     return response.json();
   }
 
-  protected async post<T>(endpoint: string, data: unknown): Promise<T> {
+  protected async post<T>(endpoint: string, data: unknown, headers?: HeadersInit): Promise<T> {
     const response = await this.fetchWithError(`${this.baseUrl}${endpoint}`, {
       method: 'POST',
+      headers,
       body: JSON.stringify(data),
     });
     return response.json();
@@ -69,9 +80,25 @@ export abstract class Api {
     return undefined as T;
   }
 
-  protected async delete<T>(endpoint: string): Promise<T> {
+  protected async patch<T>(endpoint: string, data: unknown, headers?: HeadersInit): Promise<T> {
+    const response = await this.fetchWithError(`${this.baseUrl}${endpoint}`, {
+      method: 'PATCH',
+      headers: { 'Content-Type': 'application/merge-patch+json', ...headers },
+      body: JSON.stringify(data),
+    });
+    if (response.status === 204) {
+      return undefined as T;
+    }
+    if (response.headers.get('content-type')?.includes('application/json')) {
+      return response.json();
+    }
+    return undefined as T;
+  }
+
+  protected async delete<T>(endpoint: string, headers?: HeadersInit): Promise<T> {
     const response = await this.fetchWithError(`${this.baseUrl}${endpoint}`, {
       method: 'DELETE',
+      headers,
     });
     if (response.status === 204) {
       return undefined as T;
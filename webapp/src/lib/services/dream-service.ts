@@ -1,4 +1,4 @@
-import { Dream } from '@/lib/types/dream';
+import { Dream, DreamListParams, DreamPage, DreamRevision, DreamRevisionDiff, DreamEmotion, DreamSigns, DreamStats, ImportJob, ImportOptions, MoodTrends, SimilarDream, TrashedDream } from '@/lib/types/dream';
 import { Api } from './api';
 
 export class DreamService extends Api {
@@ -15,8 +15,15 @@ export class DreamService extends Api {
     await this.post<void>('/api/dreams', { dream: content });
   }
 
-  async getAll(): Promise<Dream[]> {
-    return await this.get<Dream[]>('/api/dreams');
+  async list(params: DreamListParams = {}): Promise<DreamPage> {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') {
+        query.set(key, String(value));
+      }
+    });
+    const suffix = query.toString() ? `?${query.toString()}` : '';
+    return await this.get<DreamPage>(`/api/dreams${suffix}`);
   }
 
   async getById(id: string | number): Promise<Dream> {
@@ -58,7 +65,7 @@ export class DreamService extends Api {
 
       if (!startResponse.ok) {
         const error = await startResponse.json().catch(() => ({}));
-        throw new Error(error.message || 'Failed to start image generation');
+        throw new Error(error.detail || 'Failed to start image generation');
       }
 
       const { queuePosition, message } = await startResponse.json();
@@ -108,7 +115,7 @@ export class DreamService extends Api {
           } else {
             // Handle other status codes
             const error = await statusResponse.json().catch(() => ({}));
-            throw new Error(error.message || 'Error checking image generation status');
+            throw new Error(error.detail || 'Error checking image generation status');
           }
         } catch (error) {
           console.error('Error polling image status:', error);
@@ -129,19 +136,118 @@ export class DreamService extends Api {
     }
   }
 
-  async update(id: string | number, dream: string): Promise<Dream> {
-    return await this.put<Dream>(`/api/dreams/${id}`, { dream });
+  // The version is sent as If-Match so edits from another tab aren't silently overwritten
+  async update(id: string | number, dream: string, version: number): Promise<Dream> {
+    return await this.patch<Dream>(`/api/dreams/${id}`, { dream }, { 'If-Match': `"${version}"` });
   }
 
-  async removeDelete(id: string | number): Promise<void> {
+  async removeDelete(id: string | number, version: number): Promise<void> {
     try {
-      await this.delete(`/api/dreams/${id}`);
+      await this.delete(`/api/dreams/${id}`, { 'If-Match': `"${version}"` });
     } catch (error) {
       console.error('Error deleting dream:', error);
       throw error;
     }
   }
 
+  async listRevisions(id: string | number): Promise<DreamRevision[]> {
+    return await this.get<DreamRevision[]>(`/api/dreams/${id}/revisions`);
+  }
+
+  async diffRevisions(id: string | number, from: number, to?: number): Promise<DreamRevisionDiff> {
+    const query = new URLSearchParams({ from: String(from) });
+    if (to !== undefined) {
+      query.set('to', String(to));
+    }
+    return await this.get<DreamRevisionDiff>(`/api/dreams/${id}/revisions/diff?${query.toString()}`);
+  }
+
+  async restoreRevision(id: string | number, revision: number, version: number): Promise<Dream> {
+    return await this.post<Dream>(`/api/dreams/${id}/revisions/${revision}/restore`, {}, { 'If-Match': `"${version}"` });
+  }
+
+  async listTrash(): Promise<TrashedDream[]> {
+    return await this.get<TrashedDream[]>('/api/trash');
+  }
+
+  async restoreFromTrash(id: string | number): Promise<Dream> {
+    return await this.post<Dream>(`/api/dreams/${id}/restore`, {});
+  }
+
+  async purge(id: string | number): Promise<void> {
+    await this.delete(`/api/trash/${id}`);
+  }
+
+  // Exports are downloaded by navigating to the URL so the browser streams them to disk
+  exportUrl(format: 'json' | 'markdown' | 'zip' = 'json'): string {
+    return `${this.baseUrl}/api/export?format=${format}`;
+  }
+
+  // Books cover the dreams between two YYYY-MM-DD dates, both optional and inclusive
+  bookUrl(format: 'epub' | 'pdf' = 'epub', options: { from?: string; to?: string; title?: string } = {}): string {
+    const params = new URLSearchParams({ format });
+    if (options.from) params.set('from', options.from);
+    if (options.to) params.set('to', options.to);
+    if (options.title) params.set('title', options.title);
+    return `${this.baseUrl}/api/export/book?${params}`;
+  }
+
+  // Imports run in the background, poll importStatus until the job completes or fails
+  async startImport(file: File, options: ImportOptions = {}): Promise<ImportJob> {
+    const form = new FormData();
+    form.append('file', file);
+    if (options.format) form.append('format', options.format);
+    if (options.dryRun) form.append('dry_run', 'true');
+    if (options.mapping) form.append('mapping', JSON.stringify(options.mapping));
+
+    // Sent with fetch directly so the browser sets the multipart boundary
+    const response = await fetch(`${this.baseUrl}/api/import`, {
+      method: 'POST',
+      body: form,
+      credentials: 'include',
+    });
+    if (!response.ok) {
+      const error = await response.json().catch(() => ({}));
+      throw new Error(error.detail || 'Failed to start import');
+    }
+    return await response.json();
+  }
+
+  async importStatus(id: string): Promise<ImportJob> {
+    return await this.get<ImportJob>(`/api/import/${id}`);
+  }
+
+  // from and to are optional, inclusive YYYY-MM-DD dates
+  async getStats(range: { from?: string; to?: string } = {}): Promise<DreamStats> {
+    const params = new URLSearchParams();
+    if (range.from) params.set('from', range.from);
+    if (range.to) params.set('to', range.to);
+    const query = params.toString();
+    return await this.get<DreamStats>(`/api/stats${query ? `?${query}` : ''}`);
+  }
+
+  async getMoods(range: { from?: string; to?: string; period?: MoodTrends['period'] } = {}): Promise<MoodTrends> {
+    const params = new URLSearchParams();
+    if (range.from) params.set('from', range.from);
+    if (range.to) params.set('to', range.to);
+    if (range.period) params.set('period', range.period);
+    const query = params.toString();
+    return await this.get<MoodTrends>(`/api/stats/moods${query ? `?${query}` : ''}`);
+  }
+
+  async getEmotions(id: string | number): Promise<DreamEmotion> {
+    return await this.get<DreamEmotion>(`/api/dreams/${id}/emotions`);
+  }
+
+  async getSimilar(id: string | number, limit = 5): Promise<SimilarDream[]> {
+    return await this.get<SimilarDream[]>(`/api/dreams/${id}/similar?limit=${limit}`);
+  }
+
+  // Signs are refreshed in the background, so new dreams show up after a minute or so
+  async getDreamSigns(minCount = 2, limit = 20): Promise<DreamSigns> {
+    return await this.get<DreamSigns>(`/api/dream-signs?min_count=${minCount}&limit=${limit}`);
+  }
+
   async checkImageStatus(id: string): Promise<{ 
     isGenerating: boolean; 
     position?: number; 
@@ -181,7 +287,7 @@ export class DreamService extends Api {
       } else {
         // Handle other status codes
         const error = await response.json().catch(() => ({}));
-        const errorMessage = error.message || 'Error checking image status';
+        const errorMessage = error.detail || 'Error checking image status';
         return {
           isGenerating: false,
           message: errorMessage,
@@ -0,0 +1,45 @@
+import { Reminder, ReminderInput, ReminderPushSubscription } from '@/lib/types/reminder';
+import { Api } from './api';
+
+export class ReminderService extends Api {
+  private static instance: ReminderService;
+
+  static getInstance(): ReminderService {
+    if (!ReminderService.instance) {
+      ReminderService.instance = new ReminderService();
+    }
+    return ReminderService.instance;
+  }
+
+  async list(): Promise<Reminder[]> {
+    return await this.get<Reminder[]>('/api/reminders');
+  }
+
+  async create(reminder: ReminderInput): Promise<Reminder> {
+    return await this.post<Reminder>('/api/reminders', reminder);
+  }
+
+  async update(id: number, reminder: ReminderInput): Promise<Reminder> {
+    return await this.put<Reminder>(`/api/reminders/${id}`, reminder);
+  }
+
+  async remove(id: number): Promise<void> {
+    await this.delete<void>(`/api/reminders/${id}`);
+  }
+
+  // sendTest sends the reminder straight away, throwing if its channel fails
+  async sendTest(id: number): Promise<void> {
+    await this.fetchWithError(`${this.baseUrl}/api/reminders/${id}/test`, { method: 'POST' });
+  }
+
+  // subscribe subscribes the service worker to Web Push with the server's VAPID key
+  async subscribe(registration: ServiceWorkerRegistration): Promise<ReminderPushSubscription> {
+    const { public_key } = await this.get<{ public_key: string }>('/api/reminders/push-key');
+    const padded = public_key.replace(/-/g, '+').replace(/_/g, '/').padEnd(Math.ceil(public_key.length / 4) * 4, '=');
+    const subscription = await registration.pushManager.subscribe({
+      userVisibleOnly: true,
+      applicationServerKey: Uint8Array.from(atob(padded), (c) => c.charCodeAt(0)),
+    });
+    return subscription.toJSON() as ReminderPushSubscription;
+  }
+}
@@ -4,6 +4,181 @@ export interface Dream {
   created_at: string;
   updated_at: string;
   image_url?: string;
+  image_variants?: ImageVariants;
+  tags?: Tag[];
+  version: number;
+  dreamt_on?: string;
+  lucid: boolean;
+  nightmare: boolean;
+  recurring: boolean;
+  mood?: number;
+  vividness?: number;
+  sleep_quality?: number;
+}
+
+export interface Tag {
+  id: number;
+  name: string;
+}
+
+export interface TagCount extends Tag {
+  count: number;
+}
+
+export interface ImageVariants {
+  thumbnail?: string;
+  medium?: string;
+  jpeg?: string;
+}
+
+export interface DreamRevision {
+  dream_id: number;
+  version: number;
+  dream: string;
+  created_at: string;
+}
+
+export interface DiffOp {
+  type: 'equal' | 'insert' | 'delete';
+  text: string;
+}
+
+export interface DreamRevisionDiff {
+  dream_id: number;
+  from: number;
+  to: number;
+  changes: DiffOp[];
+}
+
+export interface TrashedDream {
+  dream: Dream;
+  deleted_at: string;
+  purge_at?: string;
+}
+
+export interface ImportJob {
+  id: string;
+  format: 'json' | 'zip' | 'csv';
+  dry_run: boolean;
+  status: 'queued' | 'running' | 'completed' | 'failed';
+  progress: number;
+  processed: number;
+  imported: number;
+  duplicates: number;
+  failed: number;
+  errors?: { source: string; message: string }[];
+  preview?: Partial<Dream>[];
+  error?: string;
+  created_at: string;
+  finished_at?: string;
+}
+
+export interface ImportOptions {
+  format?: 'json' | 'zip' | 'csv';
+  dryRun?: boolean;
+  // Maps dream fields to CSV column names
+  mapping?: Record<string, string>;
+}
+
+export interface PeriodCount {
+  // ISO week (2024-W05) or month (2024-02)
+  period: string;
+  count: number;
+}
+
+export interface DreamStats {
+  from?: string;
+  to?: string;
+  total_dreams: number;
+  per_week: PeriodCount[];
+  per_month: PeriodCount[];
+  current_streak: number;
+  longest_streak: number;
+  lucid_count: number;
+  lucid_ratio: number;
+  nightmare_count: number;
+  nightmare_ratio: number;
+  top_words: { word: string; count: number }[];
+  top_tags: TagCount[];
+  average_length: number;
+  average_words: number;
+  images_generated: number;
+}
+
+// Emotion scores run from 0 to 1
+export interface Emotions {
+  fear: number;
+  joy: number;
+  sadness: number;
+  anger: number;
+  surprise: number;
+}
+
+export interface DreamEmotion extends Emotions {
+  dream_id: number;
+  dream_version: number;
+  source: 'lexicon' | 'llm';
+  updated_at: string;
+}
+
+export interface MoodPeriod extends Emotions {
+  period: string;
+  dreams: number;
+}
+
+export interface MoodTrends {
+  from?: string;
+  to?: string;
+  period: 'day' | 'week' | 'month';
+  periods: MoodPeriod[];
+  average: Emotions;
+  dreams: number;
+}
+
+export interface SimilarDream {
+  dream: Dream;
+  // Cosine similarity, higher is closer
+  similarity: number;
+}
+
+export interface DreamSign {
+  label: string;
+  phrases: string[];
+  count: number;
+  score: number;
+  dreams: { id: number; dreamt_on?: string; excerpt: string }[];
+}
+
+export interface DreamSigns {
+  signs: DreamSign[];
+  analyzed_at?: string;
+}
+
+export interface DreamPage {
+  dreams: Dream[];
+  next_cursor?: string;
+}
+
+export interface DreamListParams {
+  cursor?: string;
+  limit?: number;
+  order?: 'asc' | 'desc';
+  from?: string;
+  to?: string;
+  has_image?: boolean;
+  tags?: string;
+  tag_mode?: 'and' | 'or';
+  lucid?: boolean;
+  nightmare?: boolean;
+  recurring?: boolean;
+  dreamt_from?: string;
+  dreamt_to?: string;
+  mood_min?: number;
+  mood_max?: number;
+  vividness_min?: number;
+  vividness_max?: number;
+  sleep_quality_min?: number;
+  sleep_quality_max?: number;
 }
 
 export default Dream;
\ No newline at end of file
@@ -0,0 +1,36 @@
+export type ReminderChannel = 'email' | 'webhook' | 'webpush';
+
+export type Weekday = 'sun' | 'mon' | 'tue' | 'wed' | 'thu' | 'fri' | 'sat';
+
+// ReminderPushSubscription is the shape returned by PushSubscription.toJSON()
+export interface ReminderPushSubscription {
+  endpoint: string;
+  keys: {
+    p256dh: string;
+    auth: string;
+  };
+}
+
+export interface Reminder {
+  id: number;
+  time_of_day: string;
+  time_zone: string;
+  weekdays: Weekday[];
+  channel: ReminderChannel;
+  target?: string;
+  subscription?: ReminderPushSubscription;
+  enabled: boolean;
+  last_sent_on?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ReminderInput {
+  time_of_day: string;
+  time_zone: string;
+  weekdays: Weekday[];
+  channel: ReminderChannel;
+  target?: string;
+  subscription?: ReminderPushSubscription;
+  enabled?: boolean;
+}